@@ -0,0 +1,207 @@
+// Package catalog 描述支持的小票打印机型号：驱动安装包、USB厂商和产品ID、PPD匹配规则和纸张，
+// 检测、安装和创建队列都按配置的型号从这里取规则，不再写死某个厂商。
+package catalog
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// USBID USB厂商或产品ID，YAML中按十六进制书写，如 0x20d1 或 "20d1"
+type USBID uint16
+
+// UnmarshalYAML 解析十六进制的ID
+func (id *USBID) UnmarshalYAML(value *yaml.Node) error {
+	text := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value.Value)), "0x")
+	n, err := strconv.ParseUint(text, 16, 16)
+	if err != nil {
+		return fmt.Errorf("USB ID %q 无效，应为4位十六进制数，如 0x20d1", value.Value)
+	}
+	*id = USBID(n)
+	return nil
+}
+
+func (id USBID) String() string {
+	return fmt.Sprintf("0x%04x", uint16(id))
+}
+
+// Model 一个打印机型号
+type Model struct {
+	Name          string  `yaml:"name"`            // 型号，与 printer.model 相同
+	Vendor        string  `yaml:"vendor"`          // 厂商显示名称，如 HPRT、Xprinter、Epson
+	Keyword       string  `yaml:"keyword"`         // 在CUPS打印机名称、设备URI和USB设备名中识别该厂商的关键词
+	DriverFile    string  `yaml:"driver_file"`     // 驱动安装包文件名，printer.driver_file 优先
+	USBVendorID   USBID   `yaml:"usb_vendor_id"`   // 为0时按关键词识别USB设备
+	USBProductIDs []USBID `yaml:"usb_product_ids"` // 为空时该厂商的任意设备都算
+	PPDPattern    string  `yaml:"ppd_pattern"`     // 匹配 lpinfo -m 和PPD文件名的正则，不区分大小写
+	Paper         string  `yaml:"paper"`           // 纸张规格名称，见 layout 包
+
+	ppd      *regexp.Regexp
+	prefixes []string // 厂商的型号名称前缀，用于归类未登记的型号
+}
+
+// vendors 厂商默认值，未登记的型号按名称前缀归到对应厂商
+var vendors = []Model{
+	{Vendor: "HPRT", Keyword: "hprt", DriverFile: "hprt-pos-printer-driver-v1.2.16.pkg", USBVendorID: 0x20d1, PPDPattern: `hprt`,
+		prefixes: []string{"hprt"}},
+	// Xprinter不同批次使用不同的USB芯片，不按厂商ID识别
+	{Vendor: "Xprinter", Keyword: "xprinter", PPDPattern: `xprinter|xp-?[0-9]`,
+		prefixes: []string{"xprinter", "xp"}},
+	{Vendor: "Epson", Keyword: "epson", USBVendorID: 0x04b8, PPDPattern: `epson.*tm|tm-?[tmu][0-9]`,
+		prefixes: []string{"epson", "tm"}},
+}
+
+// builtinModels 内置型号，Vendor对应 vendors 中的默认值
+var builtinModels = []Model{
+	{Name: "HPRT_TP80B", Vendor: "HPRT", Paper: "80mm"},
+	{Name: "XP-58", Vendor: "Xprinter", Paper: "58mm"},
+	{Name: "XP-80", Vendor: "Xprinter", Paper: "80mm"},
+	{Name: "TM-T20", Vendor: "Epson", Paper: "80mm"},
+	{Name: "TM-T82", Vendor: "Epson", Paper: "80mm"},
+}
+
+// Lookup 按型号查找，依次使用 custom 中的同名配置、内置型号、名称前缀相同的内置型号(如 XP-58IIH)
+// 和按名称前缀归类的厂商默认值(如 HPRT_TP806、TM-T88VI)
+func Lookup(name string, custom map[string]Model) (Model, error) {
+	model, ok := custom[name]
+	if !ok {
+		model, ok = findBuiltin(name)
+	}
+	if !ok {
+		return Model{}, fmt.Errorf("未知的打印机型号 %s，请在 printer.catalog 中登记（内置型号: %s）", name, strings.Join(Names(), "、"))
+	}
+
+	model.Name = name
+	model = withVendorDefaults(model)
+	if model.Keyword == "" {
+		model.Keyword = strings.ToLower(model.Vendor)
+	}
+	if model.Keyword == "" {
+		return Model{}, fmt.Errorf("打印机型号 %s 需要填写 vendor 或 keyword", name)
+	}
+	if model.PPDPattern == "" {
+		model.PPDPattern = regexp.QuoteMeta(model.Keyword)
+	}
+	ppd, err := regexp.Compile("(?i)" + model.PPDPattern)
+	if err != nil {
+		return Model{}, fmt.Errorf("打印机型号 %s 的 ppd_pattern 无效: %v", name, err)
+	}
+	model.ppd = ppd
+	return model, nil
+}
+
+// findBuiltin 按完整名称、最长的名称前缀、厂商的型号前缀查找内置型号
+func findBuiltin(name string) (Model, bool) {
+	key := Normalize(name)
+	if key == "" {
+		return Model{}, false
+	}
+
+	var best Model
+	for _, m := range builtinModels {
+		builtin := Normalize(m.Name)
+		if builtin == key {
+			return m, true
+		}
+		if strings.HasPrefix(key, builtin) && len(builtin) > len(Normalize(best.Name)) {
+			best = m
+		}
+	}
+	if best.Name != "" {
+		return best, true
+	}
+
+	for _, v := range vendors {
+		for _, prefix := range v.prefixes {
+			if strings.HasPrefix(key, prefix) {
+				return Model{Vendor: v.Vendor}, true
+			}
+		}
+	}
+	return Model{}, false
+}
+
+// withVendorDefaults 用厂商默认值补全未填写的项
+func withVendorDefaults(m Model) Model {
+	for _, v := range vendors {
+		if !strings.EqualFold(v.Vendor, m.Vendor) {
+			continue
+		}
+		if m.Keyword == "" {
+			m.Keyword = v.Keyword
+		}
+		if m.DriverFile == "" {
+			m.DriverFile = v.DriverFile
+		}
+		if m.USBVendorID == 0 {
+			m.USBVendorID = v.USBVendorID
+		}
+		if m.PPDPattern == "" {
+			m.PPDPattern = v.PPDPattern
+		}
+		break
+	}
+	return m
+}
+
+// Names 内置型号名称，按字母排序
+func Names() []string {
+	names := make([]string, 0, len(builtinModels))
+	for _, m := range builtinModels {
+		names = append(names, m.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DisplayName 日志中显示的名称，如 "HPRT HPRT_TP80B"，型号已包含厂商名时不重复
+func (m Model) DisplayName() string {
+	if m.Vendor == "" || strings.HasPrefix(Normalize(m.Name), Normalize(m.Vendor)) {
+		return m.Name
+	}
+	return m.Vendor + " " + m.Name
+}
+
+// MatchPPD PPD名称、型号描述或文件名是否属于该型号的驱动
+func (m Model) MatchPPD(text string) bool {
+	return m.ppd != nil && m.ppd.MatchString(text)
+}
+
+// MatchName 打印机名称、型号描述或设备URI中是否带有该厂商的关键词
+func (m Model) MatchName(text string) bool {
+	return m.Keyword != "" && strings.Contains(Normalize(text), Normalize(m.Keyword))
+}
+
+// MatchUSB USB厂商和产品ID是否属于该型号，未配置厂商ID时返回false，由调用方按名称识别
+func (m Model) MatchUSB(vendor, product USBID) bool {
+	if m.USBVendorID == 0 || vendor != m.USBVendorID {
+		return false
+	}
+	if len(m.USBProductIDs) == 0 {
+		return true
+	}
+	for _, id := range m.USBProductIDs {
+		if id == product {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize 转小写并去掉字母数字以外的字符，"HPRT TP80B" 与 "HPRT_TP80B" 视为相同
+func Normalize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,99 @@
+// Package clodop 提供与C-Lodop配合所需的工具：生成LODOP打印指令、读取和校验CLodopfuncs.js、解析版本号。
+//
+// 真实C-Lodop只与浏览器中的 CLodopfuncs.js 通过 /c_webskt/ 的WebSocket交换数据，报文格式没有公开，
+// 本包不实现该协议：打印机列表和打印都在浏览器测试页中经LODOP完成，Client只做普通的GET请求。
+package clodop
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ScriptPath Clodop脚本路径
+const ScriptPath = "/CLodopfuncs.js"
+
+// PostPath 浏览器脚本与C-Lodop通信的路径，真实服务在此接受WebSocket连接
+const PostPath = "/c_webskt/"
+
+// Client C-Lodop客户端
+type Client struct {
+	BaseURL    string // 如 https://localhost:8443
+	HTTPClient *http.Client
+}
+
+// NewClient 创建客户端，C-Lodop使用自签名证书，因此跳过证书校验
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+			Timeout:   10 * time.Second,
+		},
+	}
+}
+
+// Script 获取CLodopfuncs.js原文
+func (c *Client) Script(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+ScriptPath, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求Clodop脚本失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Clodop脚本返回状态 %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return "", fmt.Errorf("读取Clodop脚本失败: %v", err)
+	}
+	return string(data), nil
+}
+
+// Version 从CLodopfuncs.js中解析C-Lodop版本
+func (c *Client) Version(ctx context.Context) (string, error) {
+	script, err := c.Script(ctx)
+	if err != nil {
+		return "", err
+	}
+	version := ParseVersion(script)
+	if version == "" {
+		return "", fmt.Errorf("无法从Clodop脚本中识别版本号")
+	}
+	return version, nil
+}
+
+// versionPattern 匹配脚本中的 CVERSION:"6.5.6.8" 或 VERSION="6.2.1.5"
+var versionPattern = regexp.MustCompile(`C?VERSION["']?\s*[:=]\s*["'](\d+(?:\.\d+)+)["']`)
+
+// ParseVersion 从CLodopfuncs.js中解析版本号，找不到时返回空字符串
+func ParseVersion(script string) string {
+	m := versionPattern.FindStringSubmatch(script)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// headerVersionPattern 匹配响应头中的版本号，如 "C-Lodop(Windows)/6.5.6.8"
+var headerVersionPattern = regexp.MustCompile(`\d+(?:\.\d+){2,}`)
+
+// ParseServerHeader 从Server响应头中解析版本号，找不到时返回空字符串
+func ParseServerHeader(server string) string {
+	if !strings.Contains(strings.ToLower(server), "lodop") {
+		return ""
+	}
+	return headerVersionPattern.FindString(server)
+}
@@ -0,0 +1,67 @@
+package clodop_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"macos-clodop-schoolpal/clodop"
+	"macos-clodop-schoolpal/clodop/mock"
+)
+
+func TestClientVersionFromMockScript(t *testing.T) {
+	opts := mock.DefaultOptions()
+	ts := httptest.NewServer(mock.NewServer(opts).Handler())
+	defer ts.Close()
+
+	version, err := clodop.NewClient(ts.URL).Version(context.Background())
+	if err != nil || version != opts.Version {
+		t.Fatalf("Version() = %q, %v, want %q", version, err, opts.Version)
+	}
+}
+
+// 版本号只从脚本中解析，不向 /c_webskt/ 发送任何请求
+func TestClientVersionFromScript(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		if r.URL.Path == clodop.ScriptPath {
+			w.Write([]byte(`var CLODOP={CVERSION:"6.5.6.8"};`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	version, err := clodop.NewClient(ts.URL).Version(context.Background())
+	if err != nil || version != "6.5.6.8" {
+		t.Errorf("Version() = %q, %v", version, err)
+	}
+	if len(paths) != 1 || paths[0] != "GET "+clodop.ScriptPath {
+		t.Errorf("请求 = %q", paths)
+	}
+}
+
+func TestClientVersionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"脚本返回500", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "C-Lodop internal error", http.StatusInternalServerError)
+		}},
+		{"脚本中没有版本号", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`function getCLodop(){}`))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(tt.handler)
+			defer ts.Close()
+			if version, err := clodop.NewClient(ts.URL).Version(context.Background()); err == nil {
+				t.Errorf("Version() = %q, 应返回错误", version)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package clodop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Integrity 脚本内容与TLS证书的SHA-256指纹
+type Integrity struct {
+	ScriptSHA256 string
+	CertSHA256   string // 非HTTPS服务时为空
+}
+
+// IntegrityError 指纹与固定值不符，脚本或证书可能被篡改
+type IntegrityError struct {
+	Kind     string // "脚本" 或 "证书"
+	Actual   string
+	Expected []string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("Clodop%s指纹不符，可能已被篡改: 实际 %s，允许 %s",
+		e.Kind, e.Actual, strings.Join(e.Expected, ", "))
+}
+
+// ChangedError 未配置固定指纹时，指纹与本次运行首次看到的不同。
+// 升级或重装C-Lodop也会这样，不能据此判定被篡改
+type ChangedError struct {
+	Kind   string // "脚本" 或 "证书"
+	Actual string
+	First  string
+}
+
+func (e *ChangedError) Error() string {
+	return fmt.Sprintf("Clodop%s指纹自首次看到后已变化（未配置固定指纹，可能是升级或重装了C-Lodop）: 首次 %s，现在 %s",
+		e.Kind, e.First, e.Actual)
+}
+
+// Integrity 获取CLodopfuncs.js并计算脚本和证书指纹
+func (c *Client) Integrity(ctx context.Context) (*Integrity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+ScriptPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求Clodop脚本失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Clodop脚本返回状态 %s", resp.Status)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.LimitReader(resp.Body, 4<<20)); err != nil {
+		return nil, fmt.Errorf("读取Clodop脚本失败: %v", err)
+	}
+
+	integrity := &Integrity{ScriptSHA256: hex.EncodeToString(hash.Sum(nil))}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		sum := sha256.Sum256(resp.TLS.PeerCertificates[0].Raw)
+		integrity.CertSHA256 = hex.EncodeToString(sum[:])
+	}
+	return integrity, nil
+}
+
+// Verify 与固定的指纹比较，对应列表为空时不检查
+func (i *Integrity) Verify(scriptPins, certPins []string) error {
+	if len(scriptPins) > 0 && !pinned(i.ScriptSHA256, scriptPins) {
+		return &IntegrityError{Kind: "脚本", Actual: i.ScriptSHA256, Expected: scriptPins}
+	}
+	if len(certPins) > 0 && i.CertSHA256 != "" && !pinned(i.CertSHA256, certPins) {
+		return &IntegrityError{Kind: "证书", Actual: i.CertSHA256, Expected: certPins}
+	}
+	return nil
+}
+
+// NormalizeFingerprint 统一指纹格式，允许 "AB:CD:..." 或带空格的写法
+func NormalizeFingerprint(fp string) string {
+	fp = strings.ToLower(strings.TrimSpace(fp))
+	fp = strings.ReplaceAll(fp, ":", "")
+	return strings.ReplaceAll(fp, " ", "")
+}
+
+// pinned 判断指纹是否在允许列表中
+func pinned(actual string, pins []string) bool {
+	for _, pin := range pins {
+		if NormalizeFingerprint(pin) == actual {
+			return true
+		}
+	}
+	return false
+}
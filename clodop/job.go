@@ -0,0 +1,83 @@
+package clodop
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Command 一条LODOP指令，如 ADD_PRINT_TEXT(10, 10, 200, 20, "文字")
+type Command struct {
+	Name string
+	Args []interface{}
+}
+
+// String 按JavaScript调用语法输出指令（不含对象前缀）
+func (c Command) String() string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		data, err := json.Marshal(arg)
+		if err != nil {
+			data = []byte(`""`)
+		}
+		args[i] = string(data)
+	}
+	return fmt.Sprintf("%s(%s)", c.Name, strings.Join(args, ","))
+}
+
+// Job 一个打印任务，由一组LODOP指令组成
+type Job struct {
+	Name     string
+	Commands []Command
+}
+
+// NewJob 创建打印任务，自动添加 PRINT_INIT
+func NewJob(name string) *Job {
+	job := &Job{Name: name}
+	job.Add("PRINT_INIT", name)
+	return job
+}
+
+// Add 追加任意LODOP指令
+func (j *Job) Add(name string, args ...interface{}) *Job {
+	j.Commands = append(j.Commands, Command{Name: name, Args: args})
+	return j
+}
+
+// SetPageSize 设置纸张，pageName 形如 "80mm*120mm"
+func (j *Job) SetPageSize(orient int, width, height int, pageName string) *Job {
+	return j.Add("SET_PRINT_PAGESIZE", orient, width, height, pageName)
+}
+
+// SetPrinter 指定打印机名称
+func (j *Job) SetPrinter(name string) *Job {
+	return j.Add("SET_PRINTER_INDEX", name)
+}
+
+// AddText 添加文本项，位置和尺寸可以是像素整数或 "10mm" 这样的字符串
+func (j *Job) AddText(top, left, width, height interface{}, text string) *Job {
+	return j.Add("ADD_PRINT_TEXT", top, left, width, height, text)
+}
+
+// SetStyleA 设置某个打印项的样式，index为0表示刚添加的项
+func (j *Job) SetStyleA(index int, name string, value interface{}) *Job {
+	return j.Add("SET_PRINT_STYLEA", index, name, value)
+}
+
+// JS 生成浏览器中执行的JavaScript语句，obj为LODOP对象的变量名
+func (j *Job) JS(obj string) string {
+	var b strings.Builder
+	for _, cmd := range j.Commands {
+		fmt.Fprintf(&b, "%s.%s;\n", obj, cmd.String())
+	}
+	return b.String()
+}
+
+// Size 指令文本的总字节数，用于记录任务大小
+func (j *Job) Size() int {
+	size := 0
+	for _, cmd := range j.Commands {
+		size += len(cmd.String()) + 1
+	}
+	return size
+}
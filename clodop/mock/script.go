@@ -0,0 +1,68 @@
+package mock
+
+// clodopScript 模拟的CLodopfuncs.js，浏览器中的测试页可以像真实C-Lodop一样调用。
+// 打印机列表在生成脚本时写入；与真实服务一样，打印任务经 /c_webskt/ 的WebSocket提交，
+// 结果通过On_Return异步返回。WebSocket上的消息格式是模拟服务自定义的（见包说明）
+const clodopScript = `(function () {
+    var base = (document.currentScript && document.currentScript.src) || '';
+    base = base.replace(/\/CLodopfuncs\.js.*$/, '');
+
+    var printers = {{PRINTERS}};
+    var socket = null, outbox = [], pending = {}, seq = 0;
+
+    function connect() {
+        socket = new WebSocket(base.replace(/^http/, 'ws') + '/c_webskt/');
+        socket.onopen = function () {
+            while (outbox.length) { socket.send(outbox.shift()); }
+        };
+        socket.onmessage = function (e) {
+            var reply = JSON.parse(e.data);
+            var cb = pending[reply.tid];
+            delete pending[reply.tid];
+            if (cb) { cb(reply); }
+        };
+        socket.onclose = function () { socket = null; };
+    }
+
+    function send(msg, cb) {
+        pending[msg.tid] = cb;
+        if (socket && socket.readyState === 1) {
+            socket.send(JSON.stringify(msg));
+            return;
+        }
+        outbox.push(JSON.stringify(msg));
+        if (!socket) { connect(); }
+    }
+
+    function quote(v) { return JSON.stringify(v); }
+
+    var names = ['PRINT_INIT', 'SET_PRINT_PAGESIZE', 'SET_PRINTER_INDEX', 'ADD_PRINT_TEXT',
+        'ADD_PRINT_LINE', 'ADD_PRINT_BARCODE', 'ADD_PRINT_HTM', 'SET_PRINT_STYLE', 'SET_PRINT_STYLEA'];
+
+    var CLODOP = { CVERSION: "{{VERSION}}", VERSION: "{{VERSION}}", cmds: [], On_Return: null };
+    names.forEach(function (name) {
+        CLODOP[name] = function () {
+            var args = Array.prototype.slice.call(arguments).map(quote);
+            if (name === 'PRINT_INIT') { CLODOP.cmds = []; }
+            CLODOP.cmds.push(name + '(' + args.join(',') + ')');
+            return true;
+        };
+    });
+    CLODOP.GET_PRINTER_COUNT = function () { return printers.length; };
+    CLODOP.GET_PRINTER_NAME = function (i) { return printers[i]; };
+    CLODOP.PRINT = function () {
+        var tid = 'mock_' + Date.now() + '_' + (++seq);
+        var cb = CLODOP.On_Return;
+        CLODOP.On_Return = null;
+        send({ tid: tid, cmds: CLODOP.cmds.concat(['PRINT()']) }, function (reply) {
+            if (typeof cb === 'function') { cb(tid, !reply.error); }
+        });
+        return tid;
+    };
+
+    connect();
+    window.CLODOP = CLODOP;
+    window.getCLodop = function () { return CLODOP; };
+    window.getLodop = function () { return CLODOP; };
+})();
+`
@@ -0,0 +1,387 @@
+// Package mock 模拟C-Lodop服务，用于在没有Windows电脑时测试和演示整条打印链路。
+//
+// 与真实C-Lodop一样，所有应答都带 Server 头，CLodopfuncs.js 中写有版本号，
+// /c_webskt/ 只接受WebSocket连接（普通GET返回200供探测，不接受表单POST），
+// 打印只能由浏览器中的脚本经WebSocket提交，本程序的Go代码不直接与之通信。
+// 真实服务在WebSocket上的报文格式没有公开，也没有可用的抓包记录，模拟脚本与模拟服务之间使用自定义的JSON消息：
+//
+//	→ {"tid": "<任务号>", "cmds": ["PRINT_INIT(\"标题\")", ..., "PRINT()"]}
+//	← {"tid": "<任务号>", "result": "<序号>"} 或 {"tid": "<任务号>", "error": "<原因>"}
+//
+// 模拟脚本把打印机列表写在脚本中，GET_PRINTER_COUNT 和 GET_PRINTER_NAME 可以同步返回。
+// 因此用它验证的是浏览器测试页、转发和探测等环节的配合，不能代替与真实C-Lodop的联调。
+package mock
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"macos-clodop-schoolpal/clodop"
+)
+
+// Fault 故障模式
+type Fault string
+
+const (
+	FaultNone      Fault = "none"      // 正常工作
+	FaultSlow      Fault = "slow"      // 每个请求延迟 Options.Delay
+	FaultError500  Fault = "error500"  // 所有请求返回500
+	FaultBadCert   Fault = "badcert"   // HTTPS使用已过期的证书
+	FaultNoPrinter Fault = "noprinter" // 没有任何打印机
+)
+
+// Faults 所有故障模式
+var Faults = []Fault{FaultNone, FaultSlow, FaultError500, FaultBadCert, FaultNoPrinter}
+
+// ParseFault 解析故障模式名称，未知名称返回错误
+func ParseFault(name string) (Fault, error) {
+	for _, fault := range Faults {
+		if string(fault) == name {
+			return fault, nil
+		}
+	}
+	names := make([]string, len(Faults))
+	for i, fault := range Faults {
+		names[i] = string(fault)
+	}
+	return "", fmt.Errorf("未知的故障模式 %q，可用: %s", name, strings.Join(names, ", "))
+}
+
+// Options 模拟服务配置，端口为0时不启动对应协议
+type Options struct {
+	Host      string
+	HTTPPort  int
+	HTTPSPort int
+	Version   string
+	Printers  []string
+	Fault     Fault
+	Delay     time.Duration
+}
+
+// Job 收到的打印任务
+type Job struct {
+	TID      string    `json:"tid"`
+	JobID    string    `json:"jobId"`
+	Name     string    `json:"name"`
+	Printer  string    `json:"printer"`
+	Commands []string  `json:"commands"`
+	Received time.Time `json:"received"`
+}
+
+// Server 模拟的C-Lodop服务
+type Server struct {
+	opts Options
+
+	mu      sync.Mutex
+	jobs    []Job
+	servers []*http.Server
+	addrs   []string
+}
+
+// DefaultOptions 默认配置，与C-Lodop的默认端口一致
+func DefaultOptions() Options {
+	return Options{
+		Host:      "127.0.0.1",
+		HTTPPort:  8000,
+		HTTPSPort: 8443,
+		Version:   "6.5.6.8",
+		Printers:  []string{"HPRT TP80B", "Microsoft Print to PDF"},
+		Fault:     FaultNone,
+		Delay:     5 * time.Second,
+	}
+}
+
+// NewServer 创建模拟服务
+func NewServer(opts Options) *Server {
+	if opts.Host == "" {
+		opts.Host = "127.0.0.1"
+	}
+	if opts.Fault == "" {
+		opts.Fault = FaultNone
+	}
+	return &Server{opts: opts}
+}
+
+// Start 启动HTTP和HTTPS监听
+func (s *Server) Start() error {
+	if s.opts.HTTPPort == 0 && s.opts.HTTPSPort == 0 {
+		return fmt.Errorf("HTTP和HTTPS端口不能都为0")
+	}
+
+	if s.opts.HTTPPort != 0 {
+		if err := s.listen(s.opts.HTTPPort, nil); err != nil {
+			s.Close()
+			return err
+		}
+	}
+
+	if s.opts.HTTPSPort != 0 {
+		cert, err := selfSignedCert(s.opts.Fault == FaultBadCert)
+		if err != nil {
+			s.Close()
+			return fmt.Errorf("无法生成证书: %v", err)
+		}
+		if err := s.listen(s.opts.HTTPSPort, &tls.Config{Certificates: []tls.Certificate{cert}}); err != nil {
+			s.Close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Addrs 实际监听的地址，端口传-1时可用来获取随机端口
+func (s *Server) Addrs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.addrs...)
+}
+
+// Close 关闭所有监听
+func (s *Server) Close() {
+	s.mu.Lock()
+	servers := s.servers
+	s.servers = nil
+	s.mu.Unlock()
+
+	for _, server := range servers {
+		server.Close()
+	}
+}
+
+// Jobs 返回已收到的打印任务
+func (s *Server) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Job(nil), s.jobs...)
+}
+
+// listen 在指定端口启动一个HTTP或HTTPS服务，port为-1时使用随机端口
+func (s *Server) listen(port int, tlsConfig *tls.Config) error {
+	if port < 0 {
+		port = 0
+	}
+	addr := net.JoinHostPort(s.opts.Host, fmt.Sprint(port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("无法监听 %s: %v", addr, err)
+	}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		scheme = "https"
+	}
+
+	server := &http.Server{Handler: s.Handler()}
+	s.mu.Lock()
+	s.servers = append(s.servers, server)
+	s.addrs = append(s.addrs, fmt.Sprintf("%s://%s", scheme, listener.Addr()))
+	s.mu.Unlock()
+
+	go server.Serve(listener)
+	return nil
+}
+
+// Handler 构建C-Lodop的HTTP接口
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(clodop.ScriptPath, s.handleScript)
+	mux.HandleFunc(clodop.PostPath, s.handleSocket)
+	mux.HandleFunc("/mock/jobs", s.handleJobs)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "C-Lodop(mock)/"+s.opts.Version)
+		switch s.opts.Fault {
+		case FaultSlow:
+			time.Sleep(s.opts.Delay)
+		case FaultError500:
+			http.Error(w, "C-Lodop internal error", http.StatusInternalServerError)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// handleScript 返回模拟的CLodopfuncs.js，其中写有版本号和打印机列表
+func (s *Server) handleScript(w http.ResponseWriter, r *http.Request) {
+	printers, _ := json.Marshal(s.printers())
+	script := strings.NewReplacer("{{VERSION}}", s.opts.Version, "{{PRINTERS}}", string(printers)).Replace(clodopScript)
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Write([]byte(script))
+}
+
+// message 模拟脚本经WebSocket发送的任务和服务的应答，格式见包说明
+type message struct {
+	TID    string   `json:"tid"`
+	Cmds   []string `json:"cmds,omitempty"`
+	Result string   `json:"result,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// handleSocket 处理 /c_webskt/：WebSocket握手后逐条接收打印任务，普通GET只用于探测
+func (s *Server) handleSocket(w http.ResponseWriter, r *http.Request) {
+	if !isWebSocketUpgrade(r) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("C-Lodop " + s.opts.Version))
+		return
+	}
+
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg message
+		reply := message{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			reply.Error = fmt.Sprintf("无法解析消息: %v", err)
+		} else {
+			reply.TID = msg.TID
+			if job, err := s.acceptJob(msg.TID, msg.Cmds); err != nil {
+				reply.Error = err.Error()
+			} else {
+				reply.Result = job.JobID
+			}
+		}
+		out, _ := json.Marshal(reply)
+		if err := conn.WriteMessage(out); err != nil {
+			return
+		}
+	}
+}
+
+// handleJobs 以JSON列出已收到的任务
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(s.Jobs())
+}
+
+// printers 当前可用的打印机
+func (s *Server) printers() []string {
+	if s.opts.Fault == FaultNoPrinter {
+		return []string{}
+	}
+	return s.opts.Printers
+}
+
+// acceptJob 解析并记录一个打印任务
+func (s *Server) acceptJob(tid string, cmds []string) (*Job, error) {
+	printers := s.printers()
+	if len(printers) == 0 {
+		return nil, fmt.Errorf("没有可用的打印机")
+	}
+
+	job := Job{TID: tid, Printer: printers[0], Received: time.Now()}
+	for _, line := range cmds {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		job.Commands = append(job.Commands, line)
+
+		name, args, err := parseCommand(line)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "PRINT_INIT":
+			if len(args) > 0 {
+				job.Name = fmt.Sprint(args[0])
+			}
+		case "SET_PRINTER_INDEX":
+			if len(args) > 0 {
+				job.Printer = fmt.Sprint(args[0])
+			}
+		}
+	}
+
+	if !contains(printers, job.Printer) {
+		return nil, fmt.Errorf("打印机不存在: %s", job.Printer)
+	}
+
+	s.mu.Lock()
+	job.JobID = fmt.Sprintf("%d", len(s.jobs)+1)
+	s.jobs = append(s.jobs, job)
+	s.mu.Unlock()
+
+	return &job, nil
+}
+
+// parseCommand 解析 NAME(arg1,arg2) 形式的指令，参数为JSON字面量
+func parseCommand(line string) (string, []interface{}, error) {
+	open := strings.Index(line, "(")
+	if open <= 0 || !strings.HasSuffix(line, ")") {
+		return "", nil, fmt.Errorf("无法识别的指令: %s", line)
+	}
+
+	var args []interface{}
+	if err := json.Unmarshal([]byte("["+line[open+1:len(line)-1]+"]"), &args); err != nil {
+		return "", nil, fmt.Errorf("指令参数无效: %s: %v", line, err)
+	}
+	return line[:open], args, nil
+}
+
+// selfSignedCert 生成localhost的自签名证书，expired为true时生成已过期的证书
+func selfSignedCert(expired bool) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := notBefore.Add(365 * 24 * time.Hour)
+	if expired {
+		notBefore = time.Now().Add(-60 * 24 * time.Hour)
+		notAfter = time.Now().Add(-30 * 24 * time.Hour)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost", Organization: []string{"C-Lodop mock"}},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// contains 判断列表中是否有指定字符串
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
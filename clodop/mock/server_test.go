@@ -0,0 +1,174 @@
+package mock
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// dialSocket 以浏览器的方式握手连接 /c_webskt/
+func dialSocket(t *testing.T, ts *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	io.WriteString(conn, "GET /c_webskt/ HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: "+key+"\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("握手返回 %s", resp.Status)
+	}
+	// RFC 6455 第1.3节的示例值
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept = %q", accept)
+	}
+	return conn, reader
+}
+
+// sendFrame 发送带掩码的文本帧
+func sendFrame(t *testing.T, conn net.Conn, payload []byte) {
+	t.Helper()
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x81}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, byte(len(payload)>>8), byte(len(payload)))
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readReply 读取一个服务端文本帧并解析
+func readReply(t *testing.T, reader *bufio.Reader) message {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(reader, head[:]); err != nil {
+		t.Fatal(err)
+	}
+	if head[0] != 0x81 || head[1]&0x80 != 0 {
+		t.Fatalf("帧头 % X", head)
+	}
+	length := int(head[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(reader, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	var reply message
+	if err := json.Unmarshal(payload, &reply); err != nil {
+		t.Fatalf("无法解析应答 %q: %v", payload, err)
+	}
+	return reply
+}
+
+func TestPrintOverWebSocket(t *testing.T) {
+	server := NewServer(DefaultOptions())
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	conn, reader := dialSocket(t, ts)
+	job, _ := json.Marshal(message{TID: "t1", Cmds: []string{`PRINT_INIT("小票")`, `SET_PRINTER_INDEX("HPRT TP80B")`, `PRINT()`}})
+	sendFrame(t, conn, job)
+	if reply := readReply(t, reader); reply.TID != "t1" || reply.Result != "1" || reply.Error != "" {
+		t.Fatalf("应答 %+v", reply)
+	}
+
+	bad, _ := json.Marshal(message{TID: "t2", Cmds: []string{`SET_PRINTER_INDEX("不存在")`, `PRINT()`}})
+	sendFrame(t, conn, bad)
+	if reply := readReply(t, reader); reply.TID != "t2" || reply.Error == "" {
+		t.Fatalf("应答 %+v", reply)
+	}
+
+	jobs := server.Jobs()
+	if len(jobs) != 1 || jobs[0].Name != "小票" || jobs[0].Printer != "HPRT TP80B" {
+		t.Errorf("收到的任务 %+v", jobs)
+	}
+}
+
+func TestSocketRejectsPost(t *testing.T) {
+	ts := httptest.NewServer(NewServer(DefaultOptions()).Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/c_webskt/", "application/x-www-form-urlencoded", strings.NewReader("act=print"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("表单POST返回 %s", resp.Status)
+	}
+
+	// 普通GET用于探测，带有C-Lodop的Server头
+	resp, err = http.Get(ts.URL + "/c_webskt/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Server"), "C-Lodop") {
+		t.Errorf("GET返回 %s, Server %q", resp.Status, resp.Header.Get("Server"))
+	}
+}
+
+func TestScriptPrinters(t *testing.T) {
+	for _, tt := range []struct {
+		fault Fault
+		want  string
+	}{
+		{FaultNone, `var printers = ["HPRT TP80B","Microsoft Print to PDF"];`},
+		{FaultNoPrinter, `var printers = [];`},
+	} {
+		opts := DefaultOptions()
+		opts.Fault = tt.fault
+		ts := httptest.NewServer(NewServer(opts).Handler())
+		resp, err := http.Get(ts.URL + "/CLodopfuncs.js")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		ts.Close()
+
+		script := string(body)
+		if !strings.Contains(script, tt.want) || !strings.Contains(script, `CVERSION: "6.5.6.8"`) {
+			t.Errorf("%s: 脚本中没有 %s", tt.fault, tt.want)
+		}
+	}
+}
+
+func TestParseFault(t *testing.T) {
+	for _, fault := range Faults {
+		if got, err := ParseFault(string(fault)); err != nil || got != fault {
+			t.Errorf("ParseFault(%q) = %q, %v", fault, got, err)
+		}
+	}
+	for _, name := range []string{"", "timeout", "Slow"} {
+		if _, err := ParseFault(name); err == nil {
+			t.Errorf("ParseFault(%q) 应返回错误", name)
+		}
+	}
+}
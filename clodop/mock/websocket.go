@@ -0,0 +1,172 @@
+package mock
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// websocketGUID RFC 6455 握手中拼接在 Sec-WebSocket-Key 之后的固定值
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxFrameSize 单个消息的大小上限
+const maxFrameSize = 8 << 20
+
+// WebSocket操作码
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+// isWebSocketUpgrade 判断请求是否为WebSocket握手
+func isWebSocketUpgrade(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		headerContains(r.Header, "Connection", "upgrade") &&
+		headerContains(r.Header, "Upgrade", "websocket") &&
+		r.Header.Get("Sec-WebSocket-Key") != ""
+}
+
+// WebSocketAccept 按RFC 6455计算 Sec-WebSocket-Accept
+func WebSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// wsConn 服务端的WebSocket连接，只支持不分片的文本消息
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// upgradeWebSocket 完成握手并接管连接
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("连接不支持接管")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		WebSocketAccept(r.Header.Get("Sec-WebSocket-Key")))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+// ReadMessage 读取下一条文本消息，自动应答ping，对方关闭时返回io.EOF
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	for {
+		var head [2]byte
+		if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+			return nil, err
+		}
+		fin := head[0]&0x80 != 0
+		opcode := head[0] & 0x0F
+		masked := head[1]&0x80 != 0
+
+		length := uint64(head[1] & 0x7F)
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+				return nil, err
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+				return nil, err
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+		if length > maxFrameSize {
+			return nil, fmt.Errorf("消息过大: %d字节", length)
+		}
+		// 浏览器发出的帧必须带掩码
+		if !masked {
+			return nil, fmt.Errorf("客户端帧没有掩码")
+		}
+
+		var mask [4]byte
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return nil, err
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.reader, payload); err != nil {
+			return nil, err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		switch opcode {
+		case opText:
+			if !fin {
+				return nil, fmt.Errorf("不支持分片消息")
+			}
+			return payload, nil
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+		case opClose:
+			c.writeFrame(opClose, nil)
+			return nil, io.EOF
+		case opPong:
+		default:
+			return nil, fmt.Errorf("不支持的操作码: %d", opcode)
+		}
+	}
+}
+
+// WriteMessage 发送一条文本消息
+func (c *wsConn) WriteMessage(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// writeFrame 发送一个不带掩码的完整帧
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	_, err := c.conn.Write(append(frame, payload...))
+	return err
+}
+
+// Close 关闭连接
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
+
+// headerContains 判断逗号分隔的请求头中是否有指定的值，不区分大小写
+func headerContains(h http.Header, name, value string) bool {
+	for _, field := range h.Values(name) {
+		for _, v := range strings.Split(field, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package clodop
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PrinterNotFoundError C-Lodop上没有匹配的打印机
+type PrinterNotFoundError struct {
+	Name     string
+	Printers []string
+}
+
+func (e *PrinterNotFoundError) Error() string {
+	return fmt.Sprintf("Clodop上没有匹配 %q 的打印机，可用的打印机: %s", e.Name, strings.Join(e.Printers, ", "))
+}
+
+// PrinterPattern 把打印机名称转为正则，支持 * 和 ? 通配符，不含通配符时要求完全一致
+func PrinterPattern(name string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(name)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.MustCompile("^" + quoted + "$")
+}
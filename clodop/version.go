@@ -0,0 +1,31 @@
+package clodop
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions 比较两个点分版本号，a<b返回-1，相等返回0，a>b返回1。
+// 缺少的段按0处理，无法解析的段也按0处理。
+func CompareVersions(a, b string) int {
+	pa := strings.Split(a, ".")
+	pb := strings.Split(b, ".")
+	for len(pa) < len(pb) {
+		pa = append(pa, "0")
+	}
+	for len(pb) < len(pa) {
+		pb = append(pb, "0")
+	}
+
+	for i := range pa {
+		na, _ := strconv.Atoi(pa[i])
+		nb, _ := strconv.Atoi(pb[i])
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+// mock-clodop 启动一个模拟的C-Lodop服务，用于在Linux或没有打印机的电脑上测试和演示。
+//
+// 用法:
+//
+//	go run ./cmd/mock-clodop -http 8000 -https 8443 -fault slow -delay 3s
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"macos-clodop-schoolpal/clodop/mock"
+)
+
+func main() {
+	defaults := mock.DefaultOptions()
+
+	host := flag.String("host", defaults.Host, "监听地址")
+	httpPort := flag.Int("http", defaults.HTTPPort, "HTTP端口，0表示不启动")
+	httpsPort := flag.Int("https", defaults.HTTPSPort, "HTTPS端口，0表示不启动")
+	version := flag.String("version", defaults.Version, "模拟的C-Lodop版本号")
+	printers := flag.String("printers", strings.Join(defaults.Printers, ","), "打印机列表，逗号分隔，第一个为默认打印机")
+	fault := flag.String("fault", string(defaults.Fault), "故障模式: none, slow, error500, badcert, noprinter")
+	delay := flag.Duration("delay", defaults.Delay, "slow模式下每个请求的延迟")
+	flag.Parse()
+
+	faultMode, err := mock.ParseFault(*fault)
+	if err != nil {
+		log.Fatalf("参数错误: %v", err)
+	}
+
+	opts := mock.Options{
+		Host:      *host,
+		HTTPPort:  *httpPort,
+		HTTPSPort: *httpsPort,
+		Version:   *version,
+		Printers:  strings.Split(*printers, ","),
+		Fault:     faultMode,
+		Delay:     *delay,
+	}
+
+	server := mock.NewServer(opts)
+	if err := server.Start(); err != nil {
+		log.Fatalf("启动模拟C-Lodop失败: %v", err)
+	}
+	defer server.Close()
+
+	for _, addr := range server.Addrs() {
+		log.Printf("🖨️ 模拟C-Lodop已启动: %s/CLodopfuncs.js", addr)
+	}
+	log.Printf("📋 打印机: %v, 故障模式: %s", opts.Printers, opts.Fault)
+
+	// 定期输出新收到的打印任务
+	go func() {
+		seen := 0
+		for range time.Tick(time.Second) {
+			jobs := server.Jobs()
+			for _, job := range jobs[seen:] {
+				log.Printf("📄 收到打印任务 #%s %q → %s (%d条指令)", job.JobID, job.Name, job.Printer, len(job.Commands))
+			}
+			seen = len(jobs)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+}
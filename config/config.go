@@ -1,10 +1,19 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"os"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"macos-clodop-schoolpal/catalog"
+	"macos-clodop-schoolpal/clodop"
+	"macos-clodop-schoolpal/layout"
 )
 
 // Config 应用程序配置结构
@@ -17,14 +26,128 @@ type Config struct {
 		LocalPort  string `yaml:"local_port"`
 		RemoteHost string `yaml:"remote_host"`
 		RemotePort string `yaml:"remote_port"`
+
+		ForwardMode    string        `yaml:"forward_mode"`     // tcp: 使用socat原样转发；http: 使用内置转发并缓存Clodop脚本
+		ForwardTLSCert string        `yaml:"forward_tls_cert"` // http模式下本地解密HTTPS使用的证书，可选
+		ForwardTLSKey  string        `yaml:"forward_tls_key"`  // 与证书对应的私钥
+		ScriptCacheTTL time.Duration `yaml:"script_cache_ttl"` // 缓存的脚本在此时间内不向远程校验
 	} `yaml:"network"`
 
 	Printer struct {
 		Model      string `yaml:"model"`
 		DriverFile string `yaml:"driver_file"`
+		RemoteName string `yaml:"remote_name"` // Clodop端的打印机名称，支持*和?通配符，留空使用默认打印机
+		RawAddress string `yaml:"raw_address"` // 网口型号的地址，直连测试经TCP 9100发送；留空时发给本机CUPS队列
+
+		MonitorInterval time.Duration `yaml:"monitor_interval"` // 配置完成后检查缺纸、开盖、离线的间隔，0表示不检查
+
+		Drivers map[string]DriverManifest `yaml:"drivers"` // 驱动文件名 → 期望的SHA-256、安装包标识和版本
+		Catalog map[string]catalog.Model  `yaml:"catalog"` // 自定义型号，可覆盖内置型号
+
+		Queue struct {
+			Name     string            `yaml:"name"`     // 本机CUPS队列名称，默认按型号生成
+			Location string            `yaml:"location"` // 位置说明
+			Options  map[string]string `yaml:"options"`  // lpadmin -o 默认选项，如纸宽、切刀
+		} `yaml:"queue"`
 	} `yaml:"printer"`
+
+	CUPS struct {
+		AllowFrom   []string `yaml:"allow_from"`   // 允许访问共享打印机的地址、网段或 @IF(接口)，默认只有 remote_host
+		RemoteAdmin bool     `yaml:"remote_admin"` // 是否允许上述地址访问CUPS管理页面
+	} `yaml:"cups"`
+
+	Clodop struct {
+		Ports            []int         `yaml:"ports"`             // 候选端口，本地端口总是最先尝试
+		Paths            []string      `yaml:"paths"`             // 候选路径
+		DiscoveryTimeout time.Duration `yaml:"discovery_timeout"` // 整个探测过程的超时时间
+
+		Compat struct {
+			MinVersion  string          `yaml:"min_version"`  // 低于此版本提示升级
+			BadVersions []string        `yaml:"bad_versions"` // 已知有问题的版本
+			Flavours    []ClodopFlavour `yaml:"flavours"`     // 按版本选择测试页写法，从上到下取第一个满足的
+		} `yaml:"compat"`
+
+		Pin struct {
+			ScriptSHA256 []string `yaml:"script_sha256"` // 允许的CLodopfuncs.js指纹，空表示不检查
+			CertSHA256   []string `yaml:"cert_sha256"`   // 允许的TLS证书指纹，空表示不检查
+		} `yaml:"pin"`
+
+		HealthInterval time.Duration `yaml:"health_interval"` // 配置完成后定期检查的间隔，0表示不检查
+	} `yaml:"clodop"`
+
+	TestPage struct {
+		Title    string   `yaml:"title"`
+		Fields   []string `yaml:"fields"`   // 依次打印的内容行，未指定模板时使用
+		Template string   `yaml:"template"` // YAML/JSON模板文件，可选
+	} `yaml:"test_page"`
+
+	Paper struct {
+		Profile  string                         `yaml:"profile"`  // 直接指定纸张，优先于按型号选择
+		Models   map[string]string              `yaml:"models"`   // 打印机型号 → 纸张名称
+		Profiles map[string]layout.PaperProfile `yaml:"profiles"` // 自定义纸张，可覆盖内置规格
+	} `yaml:"paper"`
+
+	PrintAPI struct {
+		Enabled bool   `yaml:"enabled"`
+		Listen  string `yaml:"listen"` // 只能是回环地址
+		Token   string `yaml:"token"`  // 请求头 Authorization: Bearer <token>
+
+		QueueExpiry      time.Duration `yaml:"queue_expiry"`       // 打印机不可用时任务在队列中保留的时间
+		RetryMaxInterval time.Duration `yaml:"retry_max_interval"` // 重试间隔上限
+	} `yaml:"print_api"`
+
+	History struct {
+		RetentionDays int `yaml:"retention_days"` // 打印记录保留天数，0表示永久保留
+	} `yaml:"history"`
+
+	model catalog.Model // printer.model 在型号目录中对应的规则，加载时确定
+}
+
+// ClodopFlavour 某个版本起适用的测试页写法
+type ClodopFlavour struct {
+	Since    string `yaml:"since"`    // 适用的最低版本
+	Getter   string `yaml:"getter"`   // 获取LODOP对象的函数: getCLodop 或 getLodop
+	Priority bool   `yaml:"priority"` // 是否优先加载 CLodopfuncs.js?priority=1
+}
+
+// DriverManifest 一个驱动安装包的期望值，留空的项不检查
+type DriverManifest struct {
+	SHA256    string `yaml:"sha256"`     // 支持 "AB:CD:..." 写法
+	PackageID string `yaml:"package_id"` // 如 com.hprt.esc.printer.driver
+	Version   string `yaml:"version"`
 }
 
+// 端口转发方式
+const (
+	ForwardModeTCP  = "tcp"
+	ForwardModeHTTP = "http"
+)
+
+const defaultScriptCacheTTL = 5 * time.Minute
+
+// 默认的Clodop兼容表
+var (
+	defaultClodopMinVersion = "4.0.0.0"
+	defaultClodopFlavours   = []ClodopFlavour{
+		{Since: "6.0", Getter: "getCLodop", Priority: true},
+		{Since: "0", Getter: "getLodop", Priority: false},
+	}
+)
+
+// 默认的Clodop探测参数，包含Lodop扩展端口18000/18443
+var (
+	defaultClodopPorts = []int{8443, 8000, 18443, 18000, 8080, 9000}
+	defaultClodopPaths = []string{"/CLodopfuncs.js?priority=1", "/CLodopfuncs.js", "/c_webskt/"}
+)
+
+const defaultDiscoveryTimeout = 5 * time.Second
+
+// defaultRetentionDays 未配置时的打印记录保留天数。0表示永久保留，无法在解析后与未配置区分，因此在解析前填入
+const defaultRetentionDays = 90
+
+// 默认的测试页内容
+var defaultTestPageFields = []string{"✓ 打印机工作正常！", "✓ VPN连接正常", "✓ 端口转发正常", "✓ 网络通信正常"}
+
 // LoadConfig 从YAML文件加载配置
 func LoadConfig(filename string) (*Config, error) {
 	data, err := os.ReadFile(filename)
@@ -33,6 +156,7 @@ func LoadConfig(filename string) (*Config, error) {
 	}
 
 	var config Config
+	config.History.RetentionDays = defaultRetentionDays
 	err = yaml.Unmarshal(data, &config)
 	if err != nil {
 		return nil, fmt.Errorf("无法解析配置文件: %v", err)
@@ -47,9 +171,145 @@ func LoadConfig(filename string) (*Config, error) {
 		return nil, fmt.Errorf("请在config.yaml中设置Windows电脑的IP地址")
 	}
 
+	model, err := catalog.Lookup(config.Printer.Model, config.Printer.Catalog)
+	if err != nil {
+		return nil, err
+	}
+	config.model = model
+	config.applyDefaults()
+
+	if config.Printer.DriverFile == "" {
+		return nil, fmt.Errorf("型号 %s 没有默认驱动，请在config.yaml中设置 printer.driver_file", config.Printer.Model)
+	}
+
+	if config.Network.ForwardMode != ForwardModeTCP && config.Network.ForwardMode != ForwardModeHTTP {
+		return nil, fmt.Errorf("network.forward_mode 只能是 %s 或 %s", ForwardModeTCP, ForwardModeHTTP)
+	}
+
+	for file, manifest := range config.Printer.Drivers {
+		if manifest.SHA256 == "" {
+			continue
+		}
+		if sum, err := hex.DecodeString(clodop.NormalizeFingerprint(manifest.SHA256)); err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("printer.drivers.%s.sha256 不是有效的SHA-256: %s", file, manifest.SHA256)
+		}
+	}
+
+	for _, entry := range config.CUPS.AllowFrom {
+		if err := ValidateAllowEntry(entry); err != nil {
+			return nil, fmt.Errorf("cups.allow_from: %v", err)
+		}
+	}
+
 	return &config, nil
 }
 
+// applyDefaults 为可选配置项填充默认值
+func (c *Config) applyDefaults() {
+	if c.Printer.DriverFile == "" {
+		c.Printer.DriverFile = c.model.DriverFile
+	}
+	if c.Printer.Queue.Name == "" {
+		c.Printer.Queue.Name = QueueName(c.Printer.Model)
+	}
+	if len(c.CUPS.AllowFrom) == 0 {
+		c.CUPS.AllowFrom = []string{c.Network.RemoteHost}
+	}
+	if c.Network.ForwardMode == "" {
+		c.Network.ForwardMode = ForwardModeTCP
+	}
+	if c.Network.ScriptCacheTTL <= 0 {
+		c.Network.ScriptCacheTTL = defaultScriptCacheTTL
+	}
+	if len(c.Clodop.Ports) == 0 {
+		c.Clodop.Ports = defaultClodopPorts
+	}
+	if len(c.Clodop.Paths) == 0 {
+		c.Clodop.Paths = defaultClodopPaths
+	}
+	if c.Clodop.DiscoveryTimeout <= 0 {
+		c.Clodop.DiscoveryTimeout = defaultDiscoveryTimeout
+	}
+	if c.Clodop.Compat.MinVersion == "" {
+		c.Clodop.Compat.MinVersion = defaultClodopMinVersion
+	}
+	if len(c.Clodop.Compat.Flavours) == 0 {
+		c.Clodop.Compat.Flavours = defaultClodopFlavours
+	}
+	if c.TestPage.Title == "" {
+		c.TestPage.Title = c.model.Vendor + "打印机测试页"
+	}
+	if len(c.TestPage.Fields) == 0 {
+		c.TestPage.Fields = defaultTestPageFields
+	}
+	if c.PrintAPI.Listen == "" {
+		c.PrintAPI.Listen = "127.0.0.1:18888"
+	}
+	if c.PrintAPI.QueueExpiry <= 0 {
+		c.PrintAPI.QueueExpiry = 24 * time.Hour
+	}
+	if c.PrintAPI.RetryMaxInterval <= 0 {
+		c.PrintAPI.RetryMaxInterval = 5 * time.Minute
+	}
+}
+
+// ValidateAllowEntry 检查一项CUPS访问规则，支持IP、CIDR网段、主机名、@IF(接口名) 和 @LOCAL。
+// 不接受 all/*，共享范围必须明确
+func ValidateAllowEntry(entry string) error {
+	switch {
+	case strings.EqualFold(entry, "all"), strings.EqualFold(entry, "none"):
+		return fmt.Errorf("不允许使用 %q，请列出具体的地址", entry)
+	case entry == "@LOCAL":
+		return nil
+	case strings.HasPrefix(entry, "@IF(") && strings.HasSuffix(entry, ")") && len(entry) > len("@IF()"):
+		return nil
+	case net.ParseIP(entry) != nil:
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(entry); err == nil {
+		return nil
+	}
+	if entry != "" && strings.Trim(entry, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.-") == "" {
+		return nil // 主机名
+	}
+	return fmt.Errorf("无法识别 %q，请使用IP地址、网段(如10.8.0.0/24)、主机名、@IF(utun0) 或 @LOCAL", entry)
+}
+
+// QueueName 按型号生成CUPS队列名，只保留字母、数字、下划线和短横线
+func QueueName(model string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(model))
+	if name == "" {
+		return "HPRT"
+	}
+	return name
+}
+
+// PrinterModel 返回当前打印机型号的驱动、USB和PPD识别规则
+func (c *Config) PrinterModel() catalog.Model {
+	return c.model
+}
+
+// PaperProfile 返回当前打印机型号使用的纸张规格
+func (c *Config) PaperProfile() (layout.PaperProfile, error) {
+	name := c.Paper.Profile
+	if name == "" {
+		name = c.Paper.Models[c.Printer.Model]
+	}
+	if name == "" {
+		name = c.model.Paper
+	}
+	if name == "" {
+		name = layout.GuessProfileName(c.Printer.Model)
+	}
+	return layout.Profile(name, c.Paper.Profiles)
+}
+
 // Validate 验证配置是否完整
 func (c *Config) Validate() error {
 	if c.VPN.Name == "" {
@@ -69,7 +329,7 @@ func (c *Config) Validate() error {
 	}
 
 	if c.Printer.DriverFile == "" {
-		return fmt.Errorf("打印机驱动文件名不能为空")
+		return fmt.Errorf("型号 %s 没有默认驱动，请设置 printer.driver_file", c.Printer.Model)
 	}
 
 	return nil
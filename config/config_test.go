@@ -0,0 +1,35 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistoryRetention(t *testing.T) {
+	base := "vpn:\n  name: \"Office\"\nnetwork:\n  remote_host: \"192.168.1.200\"\nprinter:\n  model: \"HPRT_TP80B\"\n"
+	tests := []struct {
+		name string
+		yaml string
+		want int
+	}{
+		{"未配置时保留90天", "", defaultRetentionDays},
+		{"0表示永久保留", "history:\n  retention_days: 0\n", 0},
+		{"指定天数", "history:\n  retention_days: 30\n", 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(base+tt.yaml), 0600); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := LoadConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.History.RetentionDays != tt.want {
+				t.Errorf("保留天数 %d，期望 %d", cfg.History.RetentionDays, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"macos-clodop-schoolpal/steps"
+)
+
+// showCUPSBackupWindow 列出修改CUPS前保存的快照，可查看与当前配置的差异并恢复
+func showCUPSBackupWindow(addLog func(string)) {
+	window := fyne.CurrentApp().NewWindow("CUPS备份")
+	window.Resize(fyne.NewSize(720, 460))
+
+	var backups []steps.CUPSBackup
+	var selected *steps.CUPSBackup
+	summary := widget.NewLabel("")
+
+	diffText := widget.NewEntry()
+	diffText.MultiLine = true
+	diffText.Wrapping = fyne.TextWrapOff
+	diffText.Disable() // 只读
+	diffText.SetPlaceHolder("选择一个快照查看与当前配置的差异")
+
+	restoreButton := widget.NewButton("恢复所选快照", nil)
+	folderButton := widget.NewButton("打开目录", nil)
+	restoreButton.Disable()
+	folderButton.Disable()
+
+	list := widget.NewList(
+		func() int {
+			return len(backups)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			if id >= len(backups) {
+				return
+			}
+			text := backups[id].String()
+			if !backups[id].Complete() {
+				text += " (不完整)"
+			}
+			item.(*widget.Label).SetText(text)
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		if id >= len(backups) {
+			return
+		}
+		backup := backups[id]
+		selected = &backup
+		restoreButton.Enable()
+		folderButton.Enable()
+		diffText.SetText("正在比较...")
+		go func() {
+			diff, err := steps.DiffCUPSBackup(&backup)
+			if err != nil {
+				diff = fmt.Sprintf("无法比较: %v", err)
+			}
+			diffText.SetText(diff)
+		}()
+	}
+
+	reload := func() {
+		list.UnselectAll()
+		selected = nil
+		restoreButton.Disable()
+		folderButton.Disable()
+		diffText.SetText("")
+
+		var err error
+		backups, err = steps.ListCUPSBackups()
+		if err != nil {
+			addLog(fmt.Sprintf("❌ 读取CUPS备份失败: %v", err))
+		}
+		summary.SetText(fmt.Sprintf("共 %d 个快照，每次修改CUPS前自动保存", len(backups)))
+		list.Refresh()
+	}
+	reload()
+
+	restoreButton.OnTapped = func() {
+		if selected == nil {
+			return
+		}
+		backup := *selected
+		message := fmt.Sprintf("用 %s 的快照覆盖当前CUPS配置并重启CUPS？\n恢复前会先为当前配置保存一份快照。", backup.Created.Format("2006-01-02 15:04:05"))
+		dialog.ShowConfirm("恢复CUPS配置", message, func(ok bool) {
+			if !ok {
+				return
+			}
+			go func() {
+				current, err := steps.RestoreCUPSBackup(&backup)
+				if err != nil {
+					addLog(fmt.Sprintf("❌ %v", err))
+					return
+				}
+				addLog(fmt.Sprintf("♻️ 已恢复CUPS配置到 %s，恢复前的配置保存在 %s", backup.ID, current.ID))
+				reload()
+			}()
+		}, window)
+	}
+	folderButton.OnTapped = func() {
+		if selected != nil {
+			exec.Command("open", selected.Dir).Start()
+		}
+	}
+
+	split := container.NewHSplit(list, container.NewScroll(diffText))
+	split.Offset = 0.35
+	bottom := container.NewHBox(widget.NewButton("刷新", reload), restoreButton, folderButton)
+	window.SetContent(container.NewBorder(summary, bottom, nil, nil, split))
+	window.Show()
+}
@@ -0,0 +1,226 @@
+// Package escpos 生成热敏小票打印机使用的ESC/POS指令，不依赖驱动和Clodop。
+package escpos
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 控制字符
+const (
+	esc = 0x1B
+	fs  = 0x1C
+	gs  = 0x1D
+	lf  = 0x0A
+)
+
+// Align 对齐方式
+type Align byte
+
+const (
+	AlignLeft   Align = 0
+	AlignCenter Align = 1
+	AlignRight  Align = 2
+)
+
+// Symbology 一维条码类型，取值为 GS k 的第二种格式的m
+type Symbology byte
+
+const (
+	EAN13   Symbology = 67
+	Code39  Symbology = 69
+	Code128 Symbology = 73
+)
+
+// 常用代码页，ESC t n
+const (
+	CodePagePC437   byte = 0
+	CodePagePC850   byte = 2
+	CodePageWPC1252 byte = 16
+)
+
+// Encoder 按顺序拼接ESC/POS指令。与bufio.Writer一样只记录第一个错误，
+// 可以连续调用，最后通过Err检查
+type Encoder struct {
+	buf     bytes.Buffer
+	chinese bool // 是否处于汉字模式，非ASCII文本按GB18030编码
+	err     error
+}
+
+// NewEncoder 创建编码器，并写入初始化指令
+func NewEncoder() *Encoder {
+	e := &Encoder{}
+	return e.Init()
+}
+
+// Bytes 返回已生成的指令
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// Err 返回生成过程中的第一个错误
+func (e *Encoder) Err() error {
+	return e.err
+}
+
+// Init 恢复打印机默认设置 (ESC @)，汉字模式随之关闭
+func (e *Encoder) Init() *Encoder {
+	e.chinese = false
+	return e.Raw(esc, '@')
+}
+
+// Raw 原样写入字节
+func (e *Encoder) Raw(b ...byte) *Encoder {
+	if e.err == nil {
+		e.buf.Write(b)
+	}
+	return e
+}
+
+// Chinese 进入 (FS &) 或退出 (FS .) 汉字模式。汉字模式下高位字节按双字节汉字解释，
+// 测试代码页前必须退出
+func (e *Encoder) Chinese(on bool) *Encoder {
+	e.chinese = on
+	if on {
+		return e.Raw(fs, '&')
+	}
+	return e.Raw(fs, '.')
+}
+
+// Text 写入文本，不换行。汉字模式下按GB18030编码，否则只接受ASCII
+func (e *Encoder) Text(s string) *Encoder {
+	if e.err != nil {
+		return e
+	}
+	if !e.chinese {
+		for _, r := range s {
+			if r >= utf8.RuneSelf {
+				e.err = fmt.Errorf("文本 %q 包含非ASCII字符，请先调用Chinese(true)", s)
+				return e
+			}
+		}
+		return e.Raw([]byte(s)...)
+	}
+
+	encoded, err := simplifiedchinese.GB18030.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		e.err = fmt.Errorf("无法编码文本 %q: %v", s, err)
+		return e
+	}
+	return e.Raw(encoded...)
+}
+
+// Line 写入一行文本
+func (e *Encoder) Line(s string) *Encoder {
+	return e.Text(s).Raw(lf)
+}
+
+// Align 设置对齐方式 (ESC a n)，对之后的整行生效
+func (e *Encoder) Align(a Align) *Encoder {
+	return e.Raw(esc, 'a', byte(a))
+}
+
+// Bold 加粗 (ESC E n)
+func (e *Encoder) Bold(on bool) *Encoder {
+	return e.Raw(esc, 'E', boolByte(on))
+}
+
+// Size 设置字符放大倍数 (GS ! n)，宽高各为1到8倍
+func (e *Encoder) Size(width, height int) *Encoder {
+	if width < 1 || width > 8 || height < 1 || height > 8 {
+		return e.fail("字符倍数 %dx%d 超出范围1-8", width, height)
+	}
+	return e.Raw(gs, '!', byte((width-1)<<4|(height-1)))
+}
+
+// Feed 走纸n行 (ESC d n)
+func (e *Encoder) Feed(lines int) *Encoder {
+	if lines < 0 || lines > 255 {
+		return e.fail("走纸行数 %d 超出范围0-255", lines)
+	}
+	return e.Raw(esc, 'd', byte(lines))
+}
+
+// CodePage 选择单字节字符的代码页 (ESC t n)，只在非汉字模式下生效
+func (e *Encoder) CodePage(page byte) *Encoder {
+	return e.Raw(esc, 't', page)
+}
+
+// Barcode 打印一维条码，高度单位为点，条码下方显示内容 (GS h, GS w, GS H, GS k)。
+// Code128未指定代码集时默认使用B集 ("{B")
+func (e *Encoder) Barcode(sym Symbology, data string, height int) *Encoder {
+	if height < 1 || height > 255 {
+		return e.fail("条码高度 %d 超出范围1-255", height)
+	}
+	for _, r := range data {
+		if r < 0x20 || r > 0x7E {
+			return e.fail("条码内容 %q 只能包含可打印ASCII字符", data)
+		}
+	}
+
+	payload := []byte(data)
+	switch sym {
+	case EAN13:
+		if len(payload) != 12 && len(payload) != 13 {
+			return e.fail("EAN13条码需要12或13位数字，收到 %q", data)
+		}
+	case Code128:
+		if len(payload) < 2 || payload[0] != '{' {
+			payload = append([]byte("{B"), payload...)
+		}
+	}
+	if len(payload) == 0 || len(payload) > 255 {
+		return e.fail("条码内容长度 %d 超出范围1-255", len(payload))
+	}
+
+	e.Raw(gs, 'h', byte(height))
+	e.Raw(gs, 'w', 2)
+	e.Raw(gs, 'H', 2)
+	e.Raw(gs, 'k', byte(sym), byte(len(payload)))
+	return e.Raw(payload...).Raw(lf)
+}
+
+// QRCode 打印二维码 (GS ( k)，module为每个模块的点数1-16，纠错等级固定为M
+func (e *Encoder) QRCode(data string, module int) *Encoder {
+	if module < 1 || module > 16 {
+		return e.fail("二维码模块大小 %d 超出范围1-16", module)
+	}
+	if len(data) == 0 || len(data) > 7089 {
+		return e.fail("二维码内容长度 %d 超出范围", len(data))
+	}
+
+	e.Raw(gs, '(', 'k', 4, 0, '1', 'A', '2', 0)       // 模型2
+	e.Raw(gs, '(', 'k', 3, 0, '1', 'C', byte(module)) // 模块大小
+	e.Raw(gs, '(', 'k', 3, 0, '1', 'E', '1')          // 纠错等级M
+	n := len(data) + 3
+	e.Raw(gs, '(', 'k', byte(n&0xFF), byte(n>>8), '1', 'P', '0') // 存储数据
+	e.Raw([]byte(data)...)
+	e.Raw(gs, '(', 'k', 3, 0, '1', 'Q', '0') // 打印
+	return e.Raw(lf)
+}
+
+// Cut 走纸到切刀位置并切纸 (GS V m 0)，partial为半切
+func (e *Encoder) Cut(partial bool) *Encoder {
+	if partial {
+		return e.Raw(gs, 'V', 66, 0)
+	}
+	return e.Raw(gs, 'V', 65, 0)
+}
+
+// fail 记录错误，之后的调用不再写入
+func (e *Encoder) fail(format string, args ...interface{}) *Encoder {
+	if e.err == nil {
+		e.err = fmt.Errorf(format, args...)
+	}
+	return e
+}
+
+func boolByte(on bool) byte {
+	if on {
+		return 1
+	}
+	return 0
+}
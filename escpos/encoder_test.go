@@ -0,0 +1,107 @@
+package escpos
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncoderBytes(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(e *Encoder)
+		want  []byte
+	}{
+		{"初始化", func(e *Encoder) {}, []byte{0x1B, 0x40}},
+		{"居中", func(e *Encoder) { e.Align(AlignCenter) }, []byte{0x1B, 0x40, 0x1B, 0x61, 0x01}},
+		{"右对齐", func(e *Encoder) { e.Align(AlignRight) }, []byte{0x1B, 0x40, 0x1B, 0x61, 0x02}},
+		{"加粗倍高", func(e *Encoder) { e.Bold(true).Size(2, 2) }, []byte{0x1B, 0x40, 0x1B, 0x45, 0x01, 0x1D, 0x21, 0x11}},
+		{"走纸", func(e *Encoder) { e.Feed(3) }, []byte{0x1B, 0x40, 0x1B, 0x64, 0x03}},
+		{"代码页", func(e *Encoder) { e.CodePage(CodePageWPC1252) }, []byte{0x1B, 0x40, 0x1B, 0x74, 0x10}},
+		{"全切", func(e *Encoder) { e.Cut(false) }, []byte{0x1B, 0x40, 0x1D, 0x56, 0x41, 0x00}},
+		{"半切", func(e *Encoder) { e.Cut(true) }, []byte{0x1B, 0x40, 0x1D, 0x56, 0x42, 0x00}},
+		{"ASCII文本", func(e *Encoder) { e.Line("OK") }, []byte{0x1B, 0x40, 'O', 'K', 0x0A}},
+		{"GBK文本", func(e *Encoder) { e.Chinese(true).Line("测试￥1") }, []byte{
+			0x1B, 0x40,
+			0x1C, 0x26, // FS &
+			0xB2, 0xE2, 0xCA, 0xD4, 0xA3, 0xA4, '1', // 测 试 ￥ 1
+			0x0A,
+		}},
+		{"退出汉字模式", func(e *Encoder) { e.Chinese(true).Chinese(false) }, []byte{0x1B, 0x40, 0x1C, 0x26, 0x1C, 0x2E}},
+		{"Code128条码", func(e *Encoder) { e.Barcode(Code128, "AB12", 60) }, []byte{
+			0x1B, 0x40,
+			0x1D, 0x68, 60, // GS h 高度
+			0x1D, 0x77, 0x02, // GS w 宽度
+			0x1D, 0x48, 0x02, // GS H 下方显示内容
+			0x1D, 0x6B, 73, 6, '{', 'B', 'A', 'B', '1', '2', // GS k m n 数据
+			0x0A,
+		}},
+		{"EAN13条码", func(e *Encoder) { e.Barcode(EAN13, "690123456789", 50) }, []byte{
+			0x1B, 0x40,
+			0x1D, 0x68, 50,
+			0x1D, 0x77, 0x02,
+			0x1D, 0x48, 0x02,
+			0x1D, 0x6B, 67, 12, '6', '9', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+			0x0A,
+		}},
+		{"二维码", func(e *Encoder) { e.QRCode("hi", 6) }, []byte{
+			0x1B, 0x40,
+			0x1D, 0x28, 0x6B, 0x04, 0x00, 0x31, 0x41, 0x32, 0x00, // 模型2
+			0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x43, 0x06, // 模块大小6
+			0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x45, 0x31, // 纠错等级M
+			0x1D, 0x28, 0x6B, 0x05, 0x00, 0x31, 0x50, 0x30, 'h', 'i', // 存储数据，长度为数据+3
+			0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x51, 0x30, // 打印
+			0x0A,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEncoder()
+			tt.build(e)
+			if err := e.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if got := e.Bytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("得到 % X\n期望 % X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQRCodeLongData(t *testing.T) {
+	// 数据超过252字节时长度的高位写入pH
+	data := bytes.Repeat([]byte("a"), 300)
+	got := NewEncoder().QRCode(string(data), 4).Bytes()
+	want := []byte{0x1D, 0x28, 0x6B, 0x2F, 0x01, 0x31, 0x50, 0x30}
+	if !bytes.Contains(got, want) {
+		t.Errorf("存储指令长度错误: % X", got[:40])
+	}
+}
+
+func TestEncoderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(e *Encoder)
+	}{
+		{"非汉字模式写中文", func(e *Encoder) { e.Text("中文") }},
+		{"字符倍数超出范围", func(e *Encoder) { e.Size(9, 1) }},
+		{"走纸行数超出范围", func(e *Encoder) { e.Feed(256) }},
+		{"EAN13位数错误", func(e *Encoder) { e.Barcode(EAN13, "123", 50) }},
+		{"条码包含控制字符", func(e *Encoder) { e.Barcode(Code39, "A\nB", 50) }},
+		{"条码高度为0", func(e *Encoder) { e.Barcode(Code128, "A", 0) }},
+		{"二维码内容为空", func(e *Encoder) { e.QRCode("", 6) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEncoder()
+			tt.build(e)
+			e.Line("after")
+			if e.Err() == nil {
+				t.Fatal("期望错误")
+			}
+			// 出错后不再写入
+			if got := e.Bytes(); !bytes.Equal(got, []byte{0x1B, 0x40}) {
+				t.Errorf("出错后仍写入了 % X", got)
+			}
+		})
+	}
+}
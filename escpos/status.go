@@ -0,0 +1,67 @@
+package escpos
+
+import (
+	"fmt"
+	"io"
+)
+
+// dle 实时指令前缀
+const dle = 0x10
+
+// 实时状态请求 DLE EOT n 中的n
+const (
+	StatusPrinter byte = 1 // 打印机状态，含脱机
+	StatusOffline byte = 2 // 脱机原因，含开盖和缺纸停止
+	StatusError   byte = 3 // 错误状态
+	StatusPaper   byte = 4 // 纸传感器
+)
+
+// StatusRequest 生成实时状态请求 (DLE EOT n)，打印机收到后立即回一个字节，不进入打印缓冲
+func StatusRequest(n byte) []byte {
+	return []byte{dle, 0x04, n}
+}
+
+// RealtimeStatus DLE EOT 应答的解析结果
+type RealtimeStatus struct {
+	Offline      bool
+	CoverOpen    bool
+	PaperNearEnd bool
+	PaperOut     bool
+}
+
+// Parse 解析请求n的应答字节并合并到结果中。应答固定位为 bit0=0、bit1=1、bit4=1、bit7=0，
+// 不符时说明读到的不是状态应答
+func (s *RealtimeStatus) Parse(n, b byte) error {
+	if b&0x93 != 0x12 {
+		return fmt.Errorf("无效的实时状态应答 0x%02x (DLE EOT %d)", b, n)
+	}
+	switch n {
+	case StatusPrinter:
+		s.Offline = b&0x08 != 0
+	case StatusOffline:
+		s.CoverOpen = b&0x04 != 0
+		s.PaperOut = s.PaperOut || b&0x20 != 0
+	case StatusPaper:
+		s.PaperNearEnd = b&0x0C != 0
+		s.PaperOut = s.PaperOut || b&0x60 != 0
+	}
+	return nil
+}
+
+// QueryStatus 依次发送 DLE EOT 1、2、4 并读取应答，读写超时由调用方设置
+func QueryStatus(rw io.ReadWriter) (*RealtimeStatus, error) {
+	status := &RealtimeStatus{}
+	reply := make([]byte, 1)
+	for _, n := range []byte{StatusPrinter, StatusOffline, StatusPaper} {
+		if _, err := rw.Write(StatusRequest(n)); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(rw, reply); err != nil {
+			return nil, fmt.Errorf("打印机没有应答实时状态请求: %v", err)
+		}
+		if err := status.Parse(n, reply[0]); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
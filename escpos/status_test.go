@@ -0,0 +1,90 @@
+package escpos
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRealtimeStatusParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		n     byte
+		reply byte
+		want  RealtimeStatus
+	}{
+		{"正常", StatusPrinter, 0x12, RealtimeStatus{}},
+		{"脱机", StatusPrinter, 0x1A, RealtimeStatus{Offline: true}},
+		{"开盖", StatusOffline, 0x16, RealtimeStatus{CoverOpen: true}},
+		{"缺纸停止", StatusOffline, 0x32, RealtimeStatus{PaperOut: true}},
+		{"纸将尽(bit2)", StatusPaper, 0x16, RealtimeStatus{PaperNearEnd: true}},
+		{"纸将尽(bit3)", StatusPaper, 0x1A, RealtimeStatus{PaperNearEnd: true}},
+		{"纸尽(bit5)", StatusPaper, 0x32, RealtimeStatus{PaperOut: true}},
+		{"纸尽(bit6)", StatusPaper, 0x52, RealtimeStatus{PaperOut: true}},
+		{"纸将尽且纸尽", StatusPaper, 0x7E, RealtimeStatus{PaperNearEnd: true, PaperOut: true}},
+		{"错误状态不影响结果", StatusError, 0x7E, RealtimeStatus{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got RealtimeStatus
+			if err := got.Parse(tt.n, tt.reply); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%d, 0x%02x) = %+v，期望 %+v", tt.n, tt.reply, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRealtimeStatusParseInvalid(t *testing.T) {
+	// 固定位不符: bit0=1、bit1=0、bit4=0、bit7=1
+	for _, reply := range []byte{0x13, 0x10, 0x02, 0x92, 0x00, 0xFF} {
+		var s RealtimeStatus
+		if err := s.Parse(StatusPrinter, reply); err == nil {
+			t.Errorf("0x%02x 应当是无效应答", reply)
+		}
+	}
+}
+
+func TestRealtimeStatusParseMerge(t *testing.T) {
+	// DLE EOT 2 报告缺纸后，DLE EOT 4 的纸传感器正常不能清除缺纸
+	var s RealtimeStatus
+	if err := s.Parse(StatusOffline, 0x32); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Parse(StatusPaper, 0x12); err != nil {
+		t.Fatal(err)
+	}
+	if !s.PaperOut {
+		t.Error("后一个应答清除了缺纸")
+	}
+}
+
+// statusPrinter 按顺序应答实时状态请求
+type statusPrinter struct {
+	requests bytes.Buffer
+	replies  *bytes.Reader
+}
+
+func (p *statusPrinter) Write(b []byte) (int, error) { return p.requests.Write(b) }
+func (p *statusPrinter) Read(b []byte) (int, error)  { return p.replies.Read(b) }
+
+func TestQueryStatus(t *testing.T) {
+	p := &statusPrinter{replies: bytes.NewReader([]byte{0x1A, 0x16, 0x12})}
+	status, err := QueryStatus(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (RealtimeStatus{Offline: true, CoverOpen: true}); *status != want {
+		t.Errorf("状态 %+v，期望 %+v", *status, want)
+	}
+	want := []byte{0x10, 0x04, 1, 0x10, 0x04, 2, 0x10, 0x04, 4}
+	if !bytes.Equal(p.requests.Bytes(), want) {
+		t.Errorf("请求 % x，期望 % x", p.requests.Bytes(), want)
+	}
+
+	// 打印机不应答时返回错误
+	if _, err := QueryStatus(&statusPrinter{replies: bytes.NewReader(nil)}); err == nil {
+		t.Error("没有应答时应当返回错误")
+	}
+}
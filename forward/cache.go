@@ -0,0 +1,194 @@
+package forward
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"macos-clodop-schoolpal/clodop"
+)
+
+// maxScriptSize 缓存的脚本大小上限
+const maxScriptSize = 4 << 20
+
+// errScriptTooLarge 上游脚本超过maxScriptSize，截断后缓存会让页面脚本出错，因此不缓存
+var errScriptTooLarge = fmt.Errorf("上游脚本超过 %d 字节，不缓存", maxScriptSize)
+
+// Stats 脚本缓存统计
+type Stats struct {
+	Hits        uint64 `json:"hits"`        // 缓存未过期，直接返回
+	Revalidated uint64 `json:"revalidated"` // 上游返回304，继续使用缓存
+	Misses      uint64 `json:"misses"`      // 从上游重新下载
+	Stale       uint64 `json:"stale"`       // 上游不可用，返回过期缓存
+	Passthrough uint64 `json:"passthrough"` // 未解密的TLS连接，直接转发
+}
+
+// String 便于日志显示
+func (s Stats) String() string {
+	return fmt.Sprintf("命中 %d, 304复用 %d, 未命中 %d, 过期复用 %d, TLS直通 %d",
+		s.Hits, s.Revalidated, s.Misses, s.Stale, s.Passthrough)
+}
+
+// cacheEntry 一份缓存的CLodopfuncs.js
+type cacheEntry struct {
+	body    []byte
+	header  http.Header
+	etag    string
+	sha256  string
+	fetched time.Time
+}
+
+// scriptCache 按 Host+请求URI 缓存脚本，过期后向上游校验ETag或内容哈希
+type scriptCache struct {
+	ttl   time.Duration
+	fetch func(req *http.Request) (*http.Response, error)
+	pass  http.Handler // 脚本过大无法缓存时直接转发
+	pins  []string     // 允许的脚本指纹，空表示不检查
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+
+	hits, revalidated, misses, stale, passthrough uint64
+}
+
+// stats 返回当前统计
+func (c *scriptCache) stats() Stats {
+	return Stats{
+		Hits:        atomic.LoadUint64(&c.hits),
+		Revalidated: atomic.LoadUint64(&c.revalidated),
+		Misses:      atomic.LoadUint64(&c.misses),
+		Stale:       atomic.LoadUint64(&c.stale),
+		Passthrough: atomic.LoadUint64(&c.passthrough),
+	}
+}
+
+// countPassthrough 记录一次未解密的TLS直通连接
+func (c *scriptCache) countPassthrough() {
+	atomic.AddUint64(&c.passthrough, 1)
+}
+
+// serve 返回缓存的脚本，必要时向上游获取或校验
+func (c *scriptCache) serve(w http.ResponseWriter, r *http.Request) {
+	key := r.Host + r.URL.RequestURI()
+
+	c.mu.Lock()
+	entry := c.entries[key]
+	c.mu.Unlock()
+
+	if entry != nil && time.Since(entry.fetched) < c.ttl {
+		atomic.AddUint64(&c.hits, 1)
+		writeEntry(w, r, entry)
+		return
+	}
+
+	fresh, err := c.refresh(r, entry)
+	if errors.Is(err, errScriptTooLarge) && c.pass != nil {
+		c.pass.ServeHTTP(w, r)
+		return
+	}
+	if err != nil {
+		if entry != nil {
+			atomic.AddUint64(&c.stale, 1)
+			writeEntry(w, r, entry)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	c.mu.Lock()
+	c.entries[key] = fresh
+	c.mu.Unlock()
+	writeEntry(w, r, fresh)
+}
+
+// refresh 向上游请求脚本，已有缓存时带上If-None-Match
+func (c *scriptCache) refresh(r *http.Request, entry *cacheEntry) (*cacheEntry, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, r.URL.RequestURI(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Host = r.Host
+	if entry != nil && entry.etag != "" {
+		req.Header.Set("If-None-Match", entry.etag)
+	}
+
+	resp, err := c.fetch(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		atomic.AddUint64(&c.revalidated, 1)
+		renewed := *entry
+		renewed.fetched = time.Now()
+		return &renewed, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("上游返回状态 %s", resp.Status)
+	}
+
+	// 多读一个字节，超过上限时拒绝缓存而不是缓存被截断的脚本
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxScriptSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取上游脚本失败: %v", err)
+	}
+	if len(body) > maxScriptSize {
+		return nil, errScriptTooLarge
+	}
+
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	if len(c.pins) > 0 && !pinned(hash, c.pins) {
+		return nil, fmt.Errorf("上游脚本指纹 %s 不在允许列表中，拒绝缓存", hash)
+	}
+
+	// 上游没有ETag时，内容哈希相同也算作复用
+	if entry != nil && entry.sha256 == hash {
+		atomic.AddUint64(&c.revalidated, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+
+	header := make(http.Header)
+	for _, name := range []string{"Content-Type", "Server", "Last-Modified"} {
+		if v := resp.Header.Get(name); v != "" {
+			header.Set(name, v)
+		}
+	}
+	return &cacheEntry{
+		body:    body,
+		header:  header,
+		etag:    resp.Header.Get("ETag"),
+		sha256:  hash,
+		fetched: time.Now(),
+	}, nil
+}
+
+// writeEntry 写出缓存内容，ETag使用内容哈希便于浏览器自身缓存
+func writeEntry(w http.ResponseWriter, r *http.Request, entry *cacheEntry) {
+	for name, values := range entry.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("ETag", `"`+entry.sha256+`"`)
+	w.Header().Set("X-Forward-Cache", entry.fetched.Format(time.RFC3339))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(entry.body))
+}
+
+// pinned 判断指纹是否在允许列表中
+func pinned(actual string, pins []string) bool {
+	for _, pin := range pins {
+		if clodop.NormalizeFingerprint(pin) == actual {
+			return true
+		}
+	}
+	return false
+}
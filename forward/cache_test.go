@@ -0,0 +1,58 @@
+package forward
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestCache 上游返回size字节的脚本，过大时转发到pass
+func newTestCache(size int, pass http.Handler) *scriptCache {
+	return &scriptCache{
+		entries: make(map[string]*cacheEntry),
+		pass:    pass,
+		fetch: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {"application/javascript"}},
+				Body:       io.NopCloser(bytes.NewReader(bytes.Repeat([]byte("a"), size))),
+			}, nil
+		},
+	}
+}
+
+func TestScriptCacheSizeLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		cached bool
+	}{
+		{"上限以内", maxScriptSize, true},
+		{"超过上限", maxScriptSize + 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passed := false
+			cache := newTestCache(tt.size, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				passed = true
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/CLodopfuncs.js", nil)
+			rec := httptest.NewRecorder()
+			cache.serve(rec, req)
+
+			if passed == tt.cached {
+				t.Errorf("直接转发 = %v", passed)
+			}
+			if got := len(cache.entries); (got == 1) != tt.cached {
+				t.Errorf("缓存了 %d 份脚本", got)
+			}
+			if tt.cached && rec.Body.Len() != tt.size {
+				t.Errorf("返回 %d 字节，期望 %d", rec.Body.Len(), tt.size)
+			}
+		})
+	}
+}
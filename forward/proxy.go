@@ -0,0 +1,267 @@
+// Package forward 在本机提供理解HTTP的端口转发，可代替socat。
+//
+// 明文HTTP请求经反向代理转发到远程Clodop，其中 CLodopfuncs.js 缓存在本地，
+// 打印指令等其他请求仍然实时转发。以表单POST到 /c_webskt/ 的打印任务写入打印记录；
+// 浏览器中的C-Lodop脚本通常改用WebSocket连接，其报文不解析，也不记录。TLS连接在配置了证书时于本地解密后同样处理，
+// 否则按字节原样转发，不做缓存和记录。
+package forward
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"macos-clodop-schoolpal/clodop"
+)
+
+// StatsPath 查询缓存统计的路径
+const StatsPath = "/__forward/stats"
+
+// tlsRecordHandshake TLS握手记录的首字节
+const tlsRecordHandshake = 0x16
+
+// Options 转发参数
+type Options struct {
+	Listen     string        // 本地监听地址，如 127.0.0.1:8443
+	Upstream   string        // 远程Clodop地址，如 192.168.1.252:8443
+	TLSCert    string        // 本地解密TLS使用的证书，可选
+	TLSKey     string        // 与TLSCert对应的私钥
+	CacheTTL   time.Duration // 缓存的脚本在此时间内不向上游校验
+	ScriptPins []string      // 允许缓存的脚本指纹，空表示不检查
+}
+
+// Proxy HTTP感知的端口转发
+type Proxy struct {
+	opts      Options
+	upstream  *url.URL
+	tlsConfig *tls.Config
+	transport *http.Transport
+	proxy     *httputil.ReverseProxy
+	cache     *scriptCache
+
+	listener net.Listener
+	conns    *connListener
+	server   *http.Server
+}
+
+// New 创建转发，通过一次TLS握手判断上游使用HTTPS还是HTTP
+func New(opts Options) (*Proxy, error) {
+	upstream := &url.URL{Scheme: detectScheme(opts.Upstream), Host: opts.Upstream}
+
+	p := &Proxy{
+		opts:     opts,
+		upstream: upstream,
+		// C-Lodop使用自签名证书，指纹由调用方另行校验
+		transport: &http.Transport{
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+			MaxIdleConnsPerHost: 8,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+
+	if opts.TLSCert != "" || opts.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(opts.TLSCert, opts.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("无法加载本地TLS证书: %v", err)
+		}
+		p.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	p.proxy = httputil.NewSingleHostReverseProxy(upstream)
+	p.proxy.Transport = p.transport
+
+	p.cache = &scriptCache{
+		ttl:     opts.CacheTTL,
+		pass:    p.proxy,
+		pins:    opts.ScriptPins,
+		entries: make(map[string]*cacheEntry),
+		fetch: func(req *http.Request) (*http.Response, error) {
+			req.URL.Scheme = upstream.Scheme
+			req.URL.Host = upstream.Host
+			return p.transport.RoundTrip(req)
+		},
+	}
+	return p, nil
+}
+
+// Upstream 返回上游地址，如 https://192.168.1.252:8443
+func (p *Proxy) Upstream() string {
+	return p.upstream.String()
+}
+
+// TerminatesTLS 是否在本地解密HTTPS，此时浏览器看到的是本地证书
+func (p *Proxy) TerminatesTLS() bool {
+	return p.tlsConfig != nil
+}
+
+// Start 开始监听
+func (p *Proxy) Start() error {
+	listener, err := net.Listen("tcp", p.opts.Listen)
+	if err != nil {
+		return fmt.Errorf("无法监听 %s: %v", p.opts.Listen, err)
+	}
+
+	p.listener = listener
+	p.conns = newConnListener(listener.Addr())
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: 30 * time.Second}
+
+	go p.server.Serve(p.conns)
+	go p.acceptLoop()
+	return nil
+}
+
+// Close 停止监听
+func (p *Proxy) Close() {
+	if p.listener != nil {
+		p.listener.Close()
+	}
+	if p.server != nil {
+		p.server.Close()
+	}
+	p.transport.CloseIdleConnections()
+}
+
+// Stats 返回脚本缓存统计
+func (p *Proxy) Stats() Stats {
+	return p.cache.stats()
+}
+
+// ServeHTTP 脚本走缓存，其余请求转发到上游
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == StatsPath:
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(p.Stats())
+	case r.Method == http.MethodGet && r.URL.Path == clodop.ScriptPath:
+		p.cache.serve(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == clodop.PostPath:
+		p.forwardPost(w, r)
+	default:
+		p.proxy.ServeHTTP(w, r)
+	}
+}
+
+// acceptLoop 按首字节区分TLS和明文连接
+func (p *Proxy) acceptLoop() {
+	defer p.conns.Close()
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.dispatch(conn)
+	}
+}
+
+// dispatch 明文交给HTTP服务；TLS有证书时解密，否则直接转发
+func (p *Proxy) dispatch(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	first, err := reader.Peek(1)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	peeked := &peekedConn{Conn: conn, reader: reader}
+	if first[0] != tlsRecordHandshake {
+		p.conns.push(peeked)
+		return
+	}
+	if p.tlsConfig != nil {
+		p.conns.push(tls.Server(peeked, p.tlsConfig))
+		return
+	}
+	p.passthrough(peeked)
+}
+
+// passthrough 像socat一样在两端之间复制字节
+func (p *Proxy) passthrough(conn net.Conn) {
+	defer conn.Close()
+	p.cache.countPassthrough()
+
+	upstream, err := net.DialTimeout("tcp", p.opts.Upstream, 10*time.Second)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// detectScheme 上游能完成TLS握手时使用https，否则使用http
+func detectScheme(addr string) string {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return "http"
+	}
+	conn.Close()
+	return "https"
+}
+
+// peekedConn 先返回已预读的数据，再读取原连接
+type peekedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// connListener 把分流后的连接交给http.Server
+type connListener struct {
+	addr  net.Addr
+	ch    chan net.Conn
+	done  chan struct{}
+	close sync.Once
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{addr: addr, ch: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *connListener) push(conn net.Conn) {
+	select {
+	case l.ch <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.ch:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.close.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
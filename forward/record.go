@@ -0,0 +1,86 @@
+package forward
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"macos-clodop-schoolpal/history"
+)
+
+// maxPostSize 网页提交的指令大小上限
+const maxPostSize = 8 << 20
+
+// printInitPattern 从指令中取出任务名，如 PRINT_INIT("签到小票")
+var printInitPattern = regexp.MustCompile(`PRINT_INIT\(\s*("(?:[^"\\]|\\.)*")`)
+
+// forwardPost 转发以表单POST提交的指令，其中包含打印任务时写入打印记录。
+// WebSocket和未解密的TLS连接不经过这里
+func (p *Proxy) forwardPost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPostSize))
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+
+	title, ok := parsePrintJob(body)
+	if !ok {
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	p.proxy.ServeHTTP(recorder, r)
+
+	record := history.Record{
+		Source:    history.SourceProxy,
+		Title:     title,
+		Size:      len(body),
+		Result:    "sent",
+		LatencyMS: time.Since(start).Milliseconds(),
+	}
+	if recorder.status >= http.StatusBadRequest {
+		record.Result = "failed"
+		record.Error = "Clodop返回状态 " + strconv.Itoa(recorder.status)
+	}
+	history.Add(record)
+}
+
+// parsePrintJob 判断提交的内容是否包含LODOP打印指令，并尽量取出任务名。
+// 表单编码的内容先解码再查找
+func parsePrintJob(body []byte) (title string, ok bool) {
+	text := string(body)
+	if decoded, err := url.QueryUnescape(text); err == nil {
+		text = decoded
+	}
+	if !strings.Contains(text, "PRINT_INIT") {
+		return "", false
+	}
+
+	if m := printInitPattern.FindStringSubmatch(text); m != nil {
+		if unquoted, err := strconv.Unquote(m[1]); err == nil {
+			title = unquoted
+		}
+	}
+	return title, true
+}
+
+// statusRecorder 记录上游返回的状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
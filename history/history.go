@@ -0,0 +1,273 @@
+// Package history 记录经过本工具的每个打印任务，回答"这张小票打出来了吗"。
+//
+// 记录按行追加到数据目录下的JSON Lines文件中，不依赖外部数据库；
+// 超过保留期的记录在打开时以及之后每天清理一次。
+package history
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 任务来源
+const (
+	SourceTestPage = "test_page" // 第9步的测试页
+	SourceAPI      = "api"       // 本地打印接口
+	SourceProxy    = "proxy"     // HTTP转发模式下经过的网页打印
+	SourceRaw      = "raw"       // 绕过Clodop的ESC/POS直连测试
+)
+
+// Record 一条打印记录
+type Record struct {
+	Time      time.Time `json:"time"`
+	Source    string    `json:"source"`
+	JobID     string    `json:"job_id,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Printer   string    `json:"printer,omitempty"`
+	Size      int       `json:"size"`   // 指令字节数
+	Result    string    `json:"result"` // printed/failed/queued/...
+	Error     string    `json:"error,omitempty"`
+	LatencyMS int64     `json:"latency_ms"`
+}
+
+// Store 打印记录文件
+type Store struct {
+	path      string
+	retention time.Duration
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// Open 打开记录文件并清理过期记录，retention为0表示永久保留
+func Open(path string, retention time.Duration) (*Store, error) {
+	s := &Store{path: path, retention: retention}
+	if err := s.Prune(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Append 追加一条记录
+func (s *Store) Append(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+
+	s.mu.Lock()
+	needPrune := time.Since(s.lastPrune) > 24*time.Hour
+	err := s.appendLine(r)
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if needPrune {
+		return s.Prune()
+	}
+	return nil
+}
+
+// Update 用新的结果替换同一来源、同一任务ID的记录，没有时追加。
+// 先排队、之后才打印的任务由此只保留一条记录
+func (s *Store) Update(r Record) error {
+	if r.JobID == "" {
+		return s.Append(r)
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.read()
+	if err != nil {
+		return err
+	}
+	for i := range records {
+		if records[i].Source == r.Source && records[i].JobID == r.JobID {
+			records[i] = r
+			if err := s.write(records); err != nil {
+				return fmt.Errorf("无法更新打印记录: %v", err)
+			}
+			return nil
+		}
+	}
+	return s.appendLine(r)
+}
+
+// appendLine 在文件末尾写入一条记录，调用方持有锁
+func (s *Store) appendLine(r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = f.Write(append(data, '\n'))
+		f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("无法写入打印记录: %v", err)
+	}
+	return nil
+}
+
+// List 返回所有记录，最新的在前
+func (s *Store) List() ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.After(records[j].Time) })
+	return records, nil
+}
+
+// Prune 删除超过保留期的记录
+func (s *Store) Prune() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastPrune = time.Now()
+	if s.retention <= 0 {
+		return nil
+	}
+
+	records, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-s.retention)
+	kept := records[:0]
+	for _, r := range records {
+		if r.Time.After(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == len(records) {
+		return nil
+	}
+	if err := s.write(kept); err != nil {
+		return fmt.Errorf("无法清理打印记录: %v", err)
+	}
+	return nil
+}
+
+// write 先写临时文件再改名，用records替换整个文件，调用方持有锁
+func (s *Store) write(records []Record) error {
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+	for _, r := range records {
+		encoder.Encode(r)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	return os.Rename(tmp, s.path)
+}
+
+// read 读取全部记录，跳过无法解析的行（如写到一半时断电）
+func (s *Store) read() ([]Record, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无法读取打印记录: %v", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err == nil {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// WriteCSV 按表格导出记录，便于用Excel查看
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"时间", "来源", "任务ID", "标题", "打印机", "字节数", "结果", "错误", "耗时(毫秒)"})
+	for _, r := range records {
+		cw.Write([]string{
+			r.Time.Format("2006-01-02 15:04:05"),
+			r.Source,
+			r.JobID,
+			r.Title,
+			r.Printer,
+			strconv.Itoa(r.Size),
+			r.Result,
+			r.Error,
+			strconv.FormatInt(r.LatencyMS, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// 进程内默认的记录文件，未打开时不记录
+var (
+	defaultMu    sync.Mutex
+	defaultStore *Store
+)
+
+// SetDefault 设置默认的记录文件
+func SetDefault(s *Store) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultStore = s
+}
+
+// Default 返回默认的记录文件，未设置时返回nil
+func Default() *Store {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultStore
+}
+
+// Add 向默认记录文件追加一条记录，写入失败只输出日志，不影响打印
+func Add(r Record) {
+	s := Default()
+	if s == nil {
+		return
+	}
+	if err := s.Append(r); err != nil {
+		fmt.Printf("⚠️ %v\n", err)
+	}
+}
+
+// Update 更新默认记录文件中同一任务的记录，写入失败只输出日志，不影响打印
+func Update(r Record) {
+	s := Default()
+	if s == nil {
+		return
+	}
+	if err := s.Update(r); err != nil {
+		fmt.Printf("⚠️ %v\n", err)
+	}
+}
@@ -0,0 +1,169 @@
+package history
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openStore 在临时目录中打开记录文件
+func openStore(t *testing.T, retention time.Duration) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "history.jsonl"), retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAppendAndList(t *testing.T) {
+	s := openStore(t, 0)
+	old := time.Now().Add(-time.Hour)
+	if err := s.Append(Record{Time: old, Source: SourceAPI, JobID: "a", Result: "printed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(Record{Source: SourceRaw, JobID: "b", Result: "failed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("记录 %d 条: %+v", len(records), records)
+	}
+	if records[0].JobID != "b" || records[1].JobID != "a" {
+		t.Errorf("顺序 %s, %s，期望最新的在前", records[0].JobID, records[1].JobID)
+	}
+	if records[0].Time.IsZero() {
+		t.Error("未指定时间的记录没有填入当前时间")
+	}
+}
+
+func TestListSkipsBrokenLines(t *testing.T) {
+	s := openStore(t, 0)
+	if err := s.Append(Record{Source: SourceAPI, JobID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	// 写到一半时断电留下的残行
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2024-`)
+	f.Close()
+
+	records, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Errorf("记录 %d 条，期望跳过残行", len(records))
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	s := openStore(t, 0)
+	created := time.Now().Add(-time.Minute)
+	if err := s.Append(Record{Time: created, Source: SourceAPI, JobID: "a", Result: "queued"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(Record{Source: SourceRaw, JobID: "a", Result: "printed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Update(Record{Time: created, Source: SourceAPI, JobID: "a", Result: "printed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(Record{Source: SourceAPI, JobID: "c", Result: "failed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := map[string]string{}
+	for _, r := range records {
+		results[r.Source+"/"+r.JobID] = r.Result
+	}
+	want := map[string]string{"api/a": "printed", "raw/a": "printed", "api/c": "failed"}
+	if len(records) != len(want) {
+		t.Fatalf("记录 %d 条: %+v", len(records), records)
+	}
+	for key, result := range want {
+		if results[key] != result {
+			t.Errorf("%s 结果 %q，期望 %q", key, results[key], result)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	records := []Record{
+		{Time: now.Add(-100 * 24 * time.Hour), Source: SourceAPI, JobID: "old"},
+		{Time: now.Add(-time.Hour), Source: SourceAPI, JobID: "new"},
+	}
+
+	tests := []struct {
+		name      string
+		retention time.Duration
+		want      []string
+	}{
+		{"保留90天", 90 * 24 * time.Hour, []string{"new"}},
+		{"永久保留", 0, []string{"new", "old"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openStore(t, tt.retention)
+			for _, r := range records {
+				if err := s.Append(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Prune(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, r := range got {
+				ids = append(ids, r.JobID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("保留 %v，期望 %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	records := []Record{{
+		Time:      time.Date(2024, 5, 1, 9, 30, 0, 0, time.Local),
+		Source:    SourceAPI,
+		JobID:     "job-1",
+		Title:     "小票, 第1张",
+		Printer:   "HPRT_TP80B",
+		Size:      128,
+		Result:    "failed",
+		Error:     `打印机"缺纸"`,
+		LatencyMS: 42,
+	}}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	want := "时间,来源,任务ID,标题,打印机,字节数,结果,错误,耗时(毫秒)\n" +
+		`2024-05-01 09:30:00,api,job-1,"小票, 第1张",HPRT_TP80B,128,failed,"打印机""缺纸""",42` + "\n"
+	if buf.String() != want {
+		t.Errorf("CSV内容\n%s\n期望\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"macos-clodop-schoolpal/config"
+	"macos-clodop-schoolpal/history"
+	"macos-clodop-schoolpal/utils"
+)
+
+// historySources 记录来源的显示名称
+var historySources = map[string]string{
+	history.SourceTestPage: "测试页",
+	history.SourceAPI:      "打印接口",
+	history.SourceProxy:    "网页打印",
+	history.SourceRaw:      "直连测试",
+}
+
+// openHistory 打开打印记录文件，失败时不影响其他功能
+func openHistory(cfg *config.Config) (*history.Store, error) {
+	dir, err := utils.GetDataDir()
+	if err != nil {
+		return nil, fmt.Errorf("无法创建数据目录: %v", err)
+	}
+	retention := time.Duration(cfg.History.RetentionDays) * 24 * time.Hour
+	store, err := history.Open(filepath.Join(dir, "history.jsonl"), retention)
+	if err != nil {
+		return nil, err
+	}
+	history.SetDefault(store)
+	return store, nil
+}
+
+// showHistoryWindow 显示打印记录，可按标题、打印机或任务ID搜索并导出
+func showHistoryWindow(store *history.Store, addLog func(string)) {
+	window := fyne.CurrentApp().NewWindow("打印记录")
+	window.Resize(fyne.NewSize(640, 420))
+
+	var all, shown []history.Record
+	summary := widget.NewLabel("")
+	search := widget.NewEntry()
+	search.SetPlaceHolder("搜索标题、打印机、任务ID或结果")
+
+	list := widget.NewList(
+		func() int {
+			return len(shown)
+		},
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Wrapping = fyne.TextWrapWord
+			return label
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			if id >= len(shown) {
+				return
+			}
+			r := shown[id]
+			source := historySources[r.Source]
+			if source == "" {
+				source = r.Source
+			}
+			text := fmt.Sprintf("%s  [%s] %s\n%s · 打印机 %s · %d字节 · %dms",
+				r.Time.Format("01-02 15:04:05"), source, r.Title, r.Result, r.Printer, r.Size, r.LatencyMS)
+			if r.JobID != "" {
+				text += " · " + r.JobID
+			}
+			if r.Error != "" {
+				text += "\n" + r.Error
+			}
+			item.(*widget.Label).SetText(text)
+		},
+	)
+
+	filter := func() {
+		keyword := strings.ToLower(strings.TrimSpace(search.Text))
+		shown = shown[:0]
+		for _, r := range all {
+			text := strings.ToLower(strings.Join([]string{r.Title, r.Printer, r.JobID, r.Result, r.Source}, " "))
+			if keyword == "" || strings.Contains(text, keyword) {
+				shown = append(shown, r)
+			}
+		}
+		summary.SetText(fmt.Sprintf("共 %d 条记录，显示 %d 条", len(all), len(shown)))
+		list.Refresh()
+	}
+	search.OnChanged = func(string) { filter() }
+
+	reload := func() {
+		records, err := store.List()
+		if err != nil {
+			addLog(fmt.Sprintf("❌ 读取打印记录失败: %v", err))
+			return
+		}
+		all = records
+		filter()
+	}
+	reload()
+
+	refreshButton := widget.NewButton("刷新", reload)
+	exportButton := widget.NewButton("导出CSV", func() {
+		path, err := exportHistory(shown)
+		if err != nil {
+			addLog(fmt.Sprintf("❌ 导出打印记录失败: %v", err))
+			return
+		}
+		addLog(fmt.Sprintf("📄 打印记录已导出: %s", path))
+	})
+
+	top := container.NewVBox(search, summary)
+	bottom := container.NewHBox(refreshButton, exportButton)
+	window.SetContent(container.NewBorder(top, bottom, nil, nil, list))
+	window.Show()
+}
+
+// exportHistory 把记录导出到下载目录，返回文件路径
+func exportHistory(records []history.Record) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(home, "Downloads", fmt.Sprintf("打印记录-%s.csv", time.Now().Format("20060102-150405")))
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// 写入BOM，Excel才能正确识别UTF-8中文
+	f.WriteString("\xef\xbb\xbf")
+	if err := history.WriteCSV(f, records); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,307 @@
+package ipp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSocket macOS上CUPS的本地套接字
+const DefaultSocket = "/private/var/run/cupsd"
+
+// 打印机状态 printer-state
+const (
+	PrinterIdle       = 3
+	PrinterProcessing = 4
+	PrinterStopped    = 5
+)
+
+// printerAttributes 查询打印机时请求的属性
+var printerAttributes = []string{
+	"printer-name", "printer-uri-supported", "printer-state", "printer-state-reasons",
+	"printer-state-message", "printer-make-and-model", "device-uri", "printer-info",
+	"printer-location", "printer-is-shared", "printer-is-accepting-jobs",
+}
+
+// jobAttributes 查询任务时请求的属性
+var jobAttributes = []string{
+	"job-id", "job-name", "job-state", "job-state-reasons", "job-originating-user-name",
+	"job-printer-uri", "job-k-octets", "time-at-creation",
+}
+
+// Printer 打印机属性
+type Printer struct {
+	Name          string
+	URI           string
+	State         int
+	StateReasons  []string
+	StateMessage  string
+	MakeAndModel  string
+	DeviceURI     string
+	Info          string
+	Location      string
+	Shared        bool
+	AcceptingJobs bool
+}
+
+// StateName 状态的中文名称
+func (p *Printer) StateName() string {
+	switch p.State {
+	case PrinterIdle:
+		return "空闲"
+	case PrinterProcessing:
+		return "打印中"
+	case PrinterStopped:
+		return "已停止"
+	}
+	return fmt.Sprintf("未知(%d)", p.State)
+}
+
+// Job 打印任务属性
+type Job struct {
+	ID           int
+	Name         string
+	State        int
+	StateReasons []string
+	User         string
+	PrinterURI   string
+	KOctets      int
+	Created      time.Time
+}
+
+// StatusError 服务端返回了非成功状态
+type StatusError struct {
+	Code    uint16
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("IPP错误 0x%04x: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("IPP错误 0x%04x", e.Code)
+}
+
+// HTTPError CUPS在IPP之前就拒绝了请求，如访问控制返回的403
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("CUPS返回HTTP状态 %s", e.Status)
+}
+
+// Client IPP客户端
+type Client struct {
+	BaseURL    string // 如 http://localhost:631
+	HTTPClient *http.Client
+
+	requestID uint32
+}
+
+// NewClient 通过HTTP连接指定地址，如 http://localhost:631
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NewSocketClient 通过本地套接字连接CUPS，不受Listen设置和防火墙影响
+func NewSocketClient(socket string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &Client{
+		BaseURL:    "http://localhost",
+		HTTPClient: &http.Client{Transport: transport, Timeout: 10 * time.Second},
+	}
+}
+
+// NewLocalClient 连接本机CUPS。与CUPS命令行工具一样优先使用环境变量CUPS_SERVER
+// （套接字路径或 host[:port]），其次是本地套接字，最后是 localhost:631
+func NewLocalClient() *Client {
+	if server := os.Getenv("CUPS_SERVER"); server != "" {
+		if strings.HasPrefix(server, "/") {
+			return NewSocketClient(server)
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "631")
+		}
+		return NewClient("http://" + server)
+	}
+	if _, err := os.Stat(DefaultSocket); err == nil {
+		return NewSocketClient(DefaultSocket)
+	}
+	return NewClient("http://localhost:631")
+}
+
+// PrinterURI 本机打印机的URI，用于printer-uri属性
+func PrinterURI(name string) string {
+	return "ipp://localhost/printers/" + url.PathEscape(name)
+}
+
+// Do 发送请求并返回应答，HTTP状态不是200时返回 *HTTPError，IPP状态不是成功时返回 *StatusError
+func (c *Client) Do(ctx context.Context, path string, req *Message) (*Message, error) {
+	return c.send(ctx, path, req, nil)
+}
+
+// send 发送请求，document不为空时紧跟在属性之后作为打印数据
+func (c *Client) send(ctx context.Context, path string, req *Message, document []byte) (*Message, error) {
+	body := append(req.Encode(), document...)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/ipp")
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("无法连接CUPS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	reply, err := Decode(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// 0x0000-0x00FF 都是成功
+	if reply.Code > 0x00FF {
+		return reply, &StatusError{Code: reply.Code, Message: reply.Group(TagOperation).String("status-message")}
+	}
+	return reply, nil
+}
+
+// Printers 列出所有打印机 (CUPS-Get-Printers)
+func (c *Client) Printers(ctx context.Context) ([]Printer, error) {
+	req := NewRequest(OpCUPSGetPrinters, c.nextID())
+	req.Add(TagOperation, "requested-attributes", TagKeyword, printerAttributes...)
+
+	reply, err := c.Do(ctx, "/", req)
+	if err != nil {
+		// 没有任何打印机时CUPS返回not-found
+		if se, ok := err.(*StatusError); ok && se.Code == StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var printers []Printer
+	for _, g := range reply.GroupsOf(TagPrinter) {
+		printers = append(printers, parsePrinter(g))
+	}
+	return printers, nil
+}
+
+// PrinterAttributes 查询一台打印机 (Get-Printer-Attributes)
+func (c *Client) PrinterAttributes(ctx context.Context, name string) (*Printer, error) {
+	req := NewRequest(OpGetPrinterAttributes, c.nextID())
+	req.Add(TagOperation, "printer-uri", TagURI, PrinterURI(name))
+	req.Add(TagOperation, "requested-attributes", TagKeyword, printerAttributes...)
+
+	reply, err := c.Do(ctx, "/printers/"+url.PathEscape(name), req)
+	if err != nil {
+		return nil, err
+	}
+	groups := reply.GroupsOf(TagPrinter)
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("CUPS没有返回打印机 %s 的属性", name)
+	}
+	printer := parsePrinter(groups[0])
+	return &printer, nil
+}
+
+// PrintJob 向打印机提交一个任务 (Print-Job)，返回任务ID。
+// format为文档类型，如 application/vnd.cups-raw 表示不经过滤器原样发给打印机
+func (c *Client) PrintJob(ctx context.Context, name, title, format string, document []byte) (int, error) {
+	req := NewRequest(OpPrintJob, c.nextID())
+	req.Add(TagOperation, "printer-uri", TagURI, PrinterURI(name))
+	if u, err := user.Current(); err == nil {
+		req.Add(TagOperation, "requesting-user-name", TagName, u.Username)
+	}
+	req.Add(TagOperation, "job-name", TagName, title)
+	req.Add(TagOperation, "document-format", TagMimeMediaType, format)
+
+	reply, err := c.send(ctx, "/printers/"+url.PathEscape(name), req, document)
+	if err != nil {
+		return 0, err
+	}
+	return reply.Group(TagJob).Int("job-id"), nil
+}
+
+// Jobs 查询打印任务 (Get-Jobs)，name为空表示所有打印机，
+// which为 not-completed、completed 或 all
+func (c *Client) Jobs(ctx context.Context, name, which string) ([]Job, error) {
+	uri, path := "ipp://localhost/", "/"
+	if name != "" {
+		uri, path = PrinterURI(name), "/printers/"+url.PathEscape(name)
+	}
+
+	req := NewRequest(OpGetJobs, c.nextID())
+	req.Add(TagOperation, "printer-uri", TagURI, uri)
+	if which != "" {
+		req.Add(TagOperation, "which-jobs", TagKeyword, which)
+	}
+	req.Add(TagOperation, "requested-attributes", TagKeyword, jobAttributes...)
+
+	reply, err := c.Do(ctx, path, req)
+	if err != nil {
+		if se, ok := err.(*StatusError); ok && se.Code == StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var jobs []Job
+	for _, g := range reply.GroupsOf(TagJob) {
+		jobs = append(jobs, Job{
+			ID:           g.Int("job-id"),
+			Name:         g.String("job-name"),
+			State:        g.Int("job-state"),
+			StateReasons: g.Strings("job-state-reasons"),
+			User:         g.String("job-originating-user-name"),
+			PrinterURI:   g.String("job-printer-uri"),
+			KOctets:      g.Int("job-k-octets"),
+			Created:      time.Unix(int64(g.Int("time-at-creation")), 0),
+		})
+	}
+	return jobs, nil
+}
+
+// nextID 生成递增的请求号
+func (c *Client) nextID() uint32 {
+	return atomic.AddUint32(&c.requestID, 1)
+}
+
+// parsePrinter 从打印机属性组中取出常用字段
+func parsePrinter(g *Group) Printer {
+	return Printer{
+		Name:          g.String("printer-name"),
+		URI:           g.String("printer-uri-supported"),
+		State:         g.Int("printer-state"),
+		StateReasons:  g.Strings("printer-state-reasons"),
+		StateMessage:  g.String("printer-state-message"),
+		MakeAndModel:  g.String("printer-make-and-model"),
+		DeviceURI:     g.String("device-uri"),
+		Info:          g.String("printer-info"),
+		Location:      g.String("printer-location"),
+		Shared:        g.Bool("printer-is-shared"),
+		AcceptingJobs: g.Bool("printer-is-accepting-jobs"),
+	}
+}
@@ -0,0 +1,201 @@
+package ipp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"macos-clodop-schoolpal/ipp"
+	"macos-clodop-schoolpal/ipp/stub"
+)
+
+// startStub 启动模拟CUPS，返回连接它的客户端
+func startStub(t *testing.T, printers []ipp.Printer) (*stub.Server, *ipp.Client) {
+	t.Helper()
+	server := stub.NewServer(printers)
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	return server, ipp.NewClient(server.URL())
+}
+
+var testPrinters = []ipp.Printer{
+	{
+		Name:          "HPRT_TP80B",
+		State:         ipp.PrinterIdle,
+		StateReasons:  []string{"none"},
+		MakeAndModel:  "HPRT TP80B",
+		DeviceURI:     "usb://HPRT/TP80B?serial=123",
+		Location:      "前台",
+		Shared:        true,
+		AcceptingJobs: true,
+	},
+	{
+		Name:         "XP_58",
+		State:        ipp.PrinterStopped,
+		StateReasons: []string{"media-empty-error", "paused"},
+		StateMessage: "缺纸",
+	},
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	m := ipp.NewRequest(ipp.OpGetJobs, 7)
+	m.Add(ipp.TagOperation, "requested-attributes", ipp.TagKeyword, "job-id", "job-name")
+	g := m.NewGroup(ipp.TagPrinter)
+	g.AddInt("printer-state", ipp.TagEnum, ipp.PrinterProcessing)
+	g.AddInt("job-k-octets", ipp.TagInteger, -1)
+	g.AddBool("printer-is-shared", true)
+	g.Add("printer-info", ipp.TagText, "小票打印机")
+
+	data := m.Encode()
+	if !bytes.HasPrefix(data, []byte{1, 1, 0x00, 0x0A, 0, 0, 0, 7, ipp.TagOperation}) || data[len(data)-1] != ipp.TagEnd {
+		t.Fatalf("编码错误: % X", data)
+	}
+
+	decoded, err := ipp.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, m) {
+		t.Errorf("解码结果不同:\n%+v\n%+v", decoded, m)
+	}
+
+	printer := decoded.Group(ipp.TagPrinter)
+	if printer.Int("printer-state") != ipp.PrinterProcessing || printer.Int("job-k-octets") != -1 ||
+		!printer.Bool("printer-is-shared") || printer.String("printer-info") != "小票打印机" {
+		t.Errorf("属性值错误: %+v", printer)
+	}
+	if got := decoded.Group(ipp.TagOperation).Strings("requested-attributes"); !reflect.DeepEqual(got, []string{"job-id", "job-name"}) {
+		t.Errorf("多值属性 %v", got)
+	}
+
+	// 截断的消息必须报错
+	for _, n := range []int{4, 9, len(data) - 1} {
+		if _, err := ipp.Decode(bytes.NewReader(data[:n])); err == nil {
+			t.Errorf("截断到 %d 字节时没有报错", n)
+		}
+	}
+}
+
+func TestPrinters(t *testing.T) {
+	_, client := startStub(t, testPrinters)
+
+	printers, err := client.Printers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(printers) != 2 {
+		t.Fatalf("得到 %d 台打印机", len(printers))
+	}
+	want := testPrinters[0]
+	want.URI = ipp.PrinterURI(want.Name)
+	if !reflect.DeepEqual(printers[0], want) {
+		t.Errorf("得到 %+v\n期望 %+v", printers[0], want)
+	}
+	if p := printers[1]; p.State != ipp.PrinterStopped || p.StateName() != "已停止" ||
+		!reflect.DeepEqual(p.StateReasons, []string{"media-empty-error", "paused"}) || p.StateMessage != "缺纸" {
+		t.Errorf("得到 %+v", p)
+	}
+}
+
+func TestPrintersEmpty(t *testing.T) {
+	_, client := startStub(t, nil)
+
+	// 没有打印机时CUPS返回not-found，视为空列表
+	printers, err := client.Printers(context.Background())
+	if err != nil || len(printers) != 0 {
+		t.Errorf("得到 %v, %v", printers, err)
+	}
+}
+
+func TestPrinterAttributes(t *testing.T) {
+	server, client := startStub(t, testPrinters)
+
+	printer, err := client.PrinterAttributes(context.Background(), "XP_58")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if printer.Name != "XP_58" || printer.State != ipp.PrinterStopped {
+		t.Errorf("得到 %+v", printer)
+	}
+	requests := server.Requests()
+	if uri := requests[len(requests)-1].Group(ipp.TagOperation).String("printer-uri"); uri != "ipp://localhost/printers/XP_58" {
+		t.Errorf("printer-uri = %q", uri)
+	}
+
+	_, err = client.PrinterAttributes(context.Background(), "missing")
+	var statusErr *ipp.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != ipp.StatusNotFound || statusErr.Message == "" {
+		t.Errorf("不存在的打印机返回 %v", err)
+	}
+}
+
+func TestPrintJobAndJobs(t *testing.T) {
+	server, client := startStub(t, testPrinters)
+	ctx := context.Background()
+	document := []byte{0x1B, 0x40, 'O', 'K', 0x0A, 0x1D, 0x56, 0x42, 0x00}
+
+	id, err := client.PrintJob(ctx, "HPRT_TP80B", "测试小票", "application/vnd.cups-raw", document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Errorf("任务ID %d", id)
+	}
+	if got := server.Document(id); !bytes.Equal(got, document) {
+		t.Errorf("打印数据 % X", got)
+	}
+	ops := server.Requests()[0].Group(ipp.TagOperation)
+	if ops.String("job-name") != "测试小票" || ops.String("document-format") != "application/vnd.cups-raw" {
+		t.Errorf("操作属性 %+v", ops)
+	}
+
+	server.AddJob("XP_58", ipp.Job{ID: 9, Name: "其他任务", State: 5, User: "admin", KOctets: 2, Created: time.Unix(1700000000, 0)})
+
+	jobs, err := client.Jobs(ctx, "HPRT_TP80B", "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != 1 || jobs[0].Name != "测试小票" || jobs[0].KOctets != 1 {
+		t.Errorf("HPRT_TP80B的任务 %+v", jobs)
+	}
+
+	all, err := client.Jobs(ctx, "", "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("所有任务 %+v", all)
+	}
+	if j := all[1]; j.ID != 9 || j.State != 5 || j.User != "admin" || !j.Created.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("得到 %+v", j)
+	}
+
+	// 不存在的打印机没有任务
+	if jobs, err := client.Jobs(ctx, "missing", "all"); err != nil || len(jobs) != 0 {
+		t.Errorf("得到 %v, %v", jobs, err)
+	}
+	if _, err := client.PrintJob(ctx, "missing", "x", "application/vnd.cups-raw", document); err == nil {
+		t.Error("向不存在的打印机提交应返回错误")
+	}
+}
+
+func TestHTTPForbidden(t *testing.T) {
+	// cupsd.conf 的访问控制在IPP之前返回403
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	}))
+	t.Cleanup(ts.Close)
+
+	_, err := ipp.NewClient(ts.URL).Printers(context.Background())
+	var httpErr *ipp.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusForbidden {
+		t.Errorf("得到 %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+// Package ipp 是一个精简的IPP/1.1客户端，通过631端口或本地套接字直接查询CUPS。
+//
+// lpstat等命令的输出会随系统语言变化，在中文系统上无法可靠解析；
+// IPP是二进制协议，字段名固定，不受语言影响。
+package ipp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// 操作码
+const (
+	OpPrintJob             uint16 = 0x0002
+	OpGetJobs              uint16 = 0x000A
+	OpGetPrinterAttributes uint16 = 0x000B
+	OpCUPSGetPrinters      uint16 = 0x4002
+)
+
+// 状态码
+const (
+	StatusOK       uint16 = 0x0000
+	StatusNotFound uint16 = 0x0406
+
+	StatusServiceUnavailable uint16 = 0x0502 // 调度程序暂时无法处理
+	StatusNotAcceptingJobs   uint16 = 0x0506 // 队列已被 cupsreject 停止接收任务
+	StatusPrinterBusy        uint16 = 0x0507
+)
+
+// 分组标签
+const (
+	TagOperation   byte = 0x01
+	TagJob         byte = 0x02
+	TagEnd         byte = 0x03
+	TagPrinter     byte = 0x04
+	TagUnsupported byte = 0x05
+)
+
+// 值标签
+const (
+	TagInteger          byte = 0x21
+	TagBoolean          byte = 0x22
+	TagEnum             byte = 0x23
+	TagText             byte = 0x41
+	TagName             byte = 0x42
+	TagKeyword          byte = 0x44
+	TagURI              byte = 0x45
+	TagCharset          byte = 0x47
+	TagNaturalLanguage  byte = 0x48
+	TagMimeMediaType    byte = 0x49
+	TagBeginCollection  byte = 0x34
+	TagEndCollection    byte = 0x37
+	TagMemberAttrName   byte = 0x4A
+	TagNoValue          byte = 0x13
+	TagTextWithLanguage byte = 0x35
+)
+
+// Value 一个属性值，Data为线上的原始字节
+type Value struct {
+	Tag  byte
+	Data []byte
+}
+
+// String 按文本解释
+func (v Value) String() string {
+	return string(v.Data)
+}
+
+// Int 按整数或枚举解释
+func (v Value) Int() int {
+	if len(v.Data) != 4 {
+		return 0
+	}
+	return int(int32(binary.BigEndian.Uint32(v.Data)))
+}
+
+// Bool 按布尔解释
+func (v Value) Bool() bool {
+	return len(v.Data) == 1 && v.Data[0] != 0
+}
+
+// Attribute 一个属性，可以有多个值
+type Attribute struct {
+	Name   string
+	Values []Value
+}
+
+// Group 一组属性，如操作属性、打印机属性
+type Group struct {
+	Tag   byte
+	Attrs []Attribute
+}
+
+// Get 返回指定属性，不存在时返回nil
+func (g *Group) Get(name string) *Attribute {
+	for i := range g.Attrs {
+		if g.Attrs[i].Name == name {
+			return &g.Attrs[i]
+		}
+	}
+	return nil
+}
+
+// String 返回属性的第一个文本值
+func (g *Group) String(name string) string {
+	if a := g.Get(name); a != nil && len(a.Values) > 0 {
+		return a.Values[0].String()
+	}
+	return ""
+}
+
+// Strings 返回属性的全部文本值
+func (g *Group) Strings(name string) []string {
+	a := g.Get(name)
+	if a == nil {
+		return nil
+	}
+	values := make([]string, 0, len(a.Values))
+	for _, v := range a.Values {
+		values = append(values, v.String())
+	}
+	return values
+}
+
+// Int 返回属性的第一个整数值
+func (g *Group) Int(name string) int {
+	if a := g.Get(name); a != nil && len(a.Values) > 0 {
+		return a.Values[0].Int()
+	}
+	return 0
+}
+
+// Bool 返回属性的第一个布尔值
+func (g *Group) Bool(name string) bool {
+	if a := g.Get(name); a != nil && len(a.Values) > 0 {
+		return a.Values[0].Bool()
+	}
+	return false
+}
+
+// Message 一个IPP请求或应答，Code在请求中是操作码，在应答中是状态码
+type Message struct {
+	Code      uint16
+	RequestID uint32
+	Groups    []Group
+}
+
+// NewRequest 创建请求，自动添加必需的字符集和语言属性
+func NewRequest(op uint16, requestID uint32) *Message {
+	m := &Message{Code: op, RequestID: requestID}
+	m.Add(TagOperation, "attributes-charset", TagCharset, "utf-8")
+	m.Add(TagOperation, "attributes-natural-language", TagNaturalLanguage, "en")
+	return m
+}
+
+// Group 返回第一个指定标签的分组，不存在时创建
+func (m *Message) Group(tag byte) *Group {
+	for i := range m.Groups {
+		if m.Groups[i].Tag == tag {
+			return &m.Groups[i]
+		}
+	}
+	m.Groups = append(m.Groups, Group{Tag: tag})
+	return &m.Groups[len(m.Groups)-1]
+}
+
+// GroupsOf 返回所有指定标签的分组，如每台打印机一组
+func (m *Message) GroupsOf(tag byte) []*Group {
+	var groups []*Group
+	for i := range m.Groups {
+		if m.Groups[i].Tag == tag {
+			groups = append(groups, &m.Groups[i])
+		}
+	}
+	return groups
+}
+
+// NewGroup 追加一个新分组，如应答中的每台打印机
+func (m *Message) NewGroup(tag byte) *Group {
+	m.Groups = append(m.Groups, Group{Tag: tag})
+	return &m.Groups[len(m.Groups)-1]
+}
+
+// Add 在指定分组中添加文本类属性
+func (m *Message) Add(group byte, name string, tag byte, values ...string) {
+	m.Group(group).Add(name, tag, values...)
+}
+
+// Add 添加文本类属性，没有值时不添加
+func (g *Group) Add(name string, tag byte, values ...string) {
+	if len(values) == 0 {
+		return
+	}
+	attr := Attribute{Name: name}
+	for _, v := range values {
+		attr.Values = append(attr.Values, Value{Tag: tag, Data: []byte(v)})
+	}
+	g.Attrs = append(g.Attrs, attr)
+}
+
+// AddInt 添加整数或枚举属性
+func (g *Group) AddInt(name string, tag byte, values ...int) {
+	attr := Attribute{Name: name}
+	for _, v := range values {
+		data := make([]byte, 4)
+		binary.BigEndian.PutUint32(data, uint32(int32(v)))
+		attr.Values = append(attr.Values, Value{Tag: tag, Data: data})
+	}
+	g.Attrs = append(g.Attrs, attr)
+}
+
+// AddBool 添加布尔属性
+func (g *Group) AddBool(name string, value bool) {
+	data := []byte{0}
+	if value {
+		data[0] = 1
+	}
+	g.Attrs = append(g.Attrs, Attribute{Name: name, Values: []Value{{Tag: TagBoolean, Data: data}}})
+}
+
+// Encode 编码为IPP/1.1二进制格式
+func (m *Message) Encode() []byte {
+	var b bytes.Buffer
+	b.Write([]byte{1, 1})
+	binary.Write(&b, binary.BigEndian, m.Code)
+	binary.Write(&b, binary.BigEndian, m.RequestID)
+
+	for _, g := range m.Groups {
+		b.WriteByte(g.Tag)
+		for _, attr := range g.Attrs {
+			for i, v := range attr.Values {
+				name := attr.Name
+				if i > 0 {
+					name = "" // 附加值的名称为空
+				}
+				b.WriteByte(v.Tag)
+				binary.Write(&b, binary.BigEndian, uint16(len(name)))
+				b.WriteString(name)
+				binary.Write(&b, binary.BigEndian, uint16(len(v.Data)))
+				b.Write(v.Data)
+			}
+		}
+	}
+	b.WriteByte(TagEnd)
+	return b.Bytes()
+}
+
+// Decode 解析IPP消息，集合类型的成员作为附加值平铺保存
+func Decode(r io.Reader) (*Message, error) {
+	var header struct {
+		Major, Minor byte
+		Code         uint16
+		RequestID    uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("IPP消息头不完整: %v", err)
+	}
+	m := &Message{Code: header.Code, RequestID: header.RequestID}
+
+	var group *Group
+	var attr *Attribute
+	tag := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, tag); err != nil {
+			return nil, fmt.Errorf("IPP消息缺少结束标记: %v", err)
+		}
+
+		// 0x00-0x0F 是分组分隔符
+		if tag[0] < 0x10 {
+			if tag[0] == TagEnd {
+				return m, nil
+			}
+			m.Groups = append(m.Groups, Group{Tag: tag[0]})
+			group = &m.Groups[len(m.Groups)-1]
+			attr = nil
+			continue
+		}
+		if group == nil {
+			return nil, fmt.Errorf("IPP属性不在任何分组中")
+		}
+
+		name, err := readField(r)
+		if err != nil {
+			return nil, err
+		}
+		data, err := readField(r)
+		if err != nil {
+			return nil, err
+		}
+
+		value := Value{Tag: tag[0], Data: data}
+		if len(name) == 0 && attr != nil {
+			attr.Values = append(attr.Values, value)
+			continue
+		}
+		group.Attrs = append(group.Attrs, Attribute{Name: string(name), Values: []Value{value}})
+		attr = &group.Attrs[len(group.Attrs)-1]
+	}
+}
+
+// readField 读取带两字节长度前缀的字段
+func readField(r io.Reader) ([]byte, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, fmt.Errorf("IPP属性不完整: %v", err)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("IPP属性不完整: %v", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,258 @@
+// Package stub 模拟CUPS的IPP接口，用于在没有CUPS的环境中验证ipp客户端和配置步骤。
+package stub
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"macos-clodop-schoolpal/ipp"
+)
+
+// Server 模拟的IPP服务，支持 CUPS-Get-Printers、Get-Printer-Attributes、Get-Jobs 和 Print-Job
+type Server struct {
+	mu        sync.Mutex
+	printers  []ipp.Printer
+	jobs      map[string][]ipp.Job // 打印机名 → 任务
+	documents map[int][]byte       // 任务ID → Print-Job 提交的数据
+	nextJobID int
+	requests  []ipp.Message
+
+	server *http.Server
+	addr   string
+}
+
+// NewServer 创建模拟服务
+func NewServer(printers []ipp.Printer) *Server {
+	return &Server{printers: printers, jobs: make(map[string][]ipp.Job), documents: make(map[int][]byte), nextJobID: 1}
+}
+
+// Start 在addr上监听，如 127.0.0.1:0
+func (s *Server) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.addr = listener.Addr().String()
+	s.server = &http.Server{Handler: s}
+	go s.server.Serve(listener)
+	return nil
+}
+
+// URL 服务地址，可直接传给 ipp.NewClient
+func (s *Server) URL() string {
+	return "http://" + s.addr
+}
+
+// Close 停止服务
+func (s *Server) Close() {
+	if s.server != nil {
+		s.server.Close()
+	}
+}
+
+// SetPrinters 替换打印机列表
+func (s *Server) SetPrinters(printers []ipp.Printer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.printers = printers
+}
+
+// AddJob 为打印机添加任务
+func (s *Server) AddJob(printer string, job ipp.Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[printer] = append(s.jobs[printer], job)
+}
+
+// Document 返回Print-Job提交的打印数据，便于逐字节检查
+func (s *Server) Document(jobID int) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.documents[jobID]
+}
+
+// Requests 返回收到的请求，便于检查客户端发送的属性
+func (s *Server) Requests() []ipp.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ipp.Message(nil), s.requests...)
+}
+
+// ServeHTTP 解析IPP请求并按操作码应答
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/ipp" {
+		http.Error(w, "IPP only", http.StatusBadRequest)
+		return
+	}
+
+	req, err := ipp.Decode(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 属性之后是打印数据
+	document, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, *req)
+	reply := s.handle(req, document)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/ipp")
+	w.Write(reply.Encode())
+}
+
+// handle 生成应答，调用方持有锁
+func (s *Server) handle(req *ipp.Message, document []byte) *ipp.Message {
+	reply := ipp.NewRequest(ipp.StatusOK, req.RequestID)
+	ops := req.Group(ipp.TagOperation)
+
+	switch req.Code {
+	case ipp.OpCUPSGetPrinters:
+		if len(s.printers) == 0 {
+			return notFound(req, "No destinations added.")
+		}
+		for _, p := range s.printers {
+			appendPrinter(reply, p)
+		}
+
+	case ipp.OpGetPrinterAttributes:
+		p := s.find(ops.String("printer-uri"))
+		if p == nil {
+			return notFound(req, "The printer or class does not exist.")
+		}
+		appendPrinter(reply, *p)
+
+	case ipp.OpGetJobs:
+		uri := ops.String("printer-uri")
+		var names []string
+		if p := s.find(uri); p != nil {
+			names = []string{p.Name}
+		} else if strings.HasSuffix(uri, "/printers/") || strings.HasSuffix(uri, "localhost/") {
+			for _, p := range s.printers {
+				names = append(names, p.Name)
+			}
+		} else {
+			return notFound(req, "The printer or class does not exist.")
+		}
+		for _, name := range names {
+			for _, job := range s.jobs[name] {
+				appendJob(reply, job)
+			}
+		}
+
+	case ipp.OpPrintJob:
+		p := s.find(ops.String("printer-uri"))
+		if p == nil {
+			return notFound(req, "The printer or class does not exist.")
+		}
+		// 与CUPS一致，被 cupsreject 停止接收的队列拒绝新任务
+		if !p.AcceptingJobs {
+			reply := ipp.NewRequest(ipp.StatusNotAcceptingJobs, req.RequestID)
+			reply.Add(ipp.TagOperation, "status-message", ipp.TagText, fmt.Sprintf("Destination \"%s\" is not accepting jobs.", p.Name))
+			return reply
+		}
+		job := ipp.Job{
+			ID:      s.nextJobID,
+			Name:    ops.String("job-name"),
+			State:   9, // completed
+			User:    ops.String("requesting-user-name"),
+			KOctets: (len(document) + 1023) / 1024,
+			Created: time.Now(),
+		}
+		s.nextJobID++
+		s.jobs[p.Name] = append(s.jobs[p.Name], job)
+		s.documents[job.ID] = document
+		appendJob(reply, job)
+
+	default:
+		reply.Code = 0x0501 // server-error-operation-not-supported
+	}
+	return reply
+}
+
+// find 按printer-uri查找打印机
+func (s *Server) find(uri string) *ipp.Printer {
+	i := strings.LastIndex(uri, "/printers/")
+	if i < 0 {
+		return nil
+	}
+	name, err := url.PathUnescape(uri[i+len("/printers/"):])
+	if err != nil {
+		return nil
+	}
+	for k := range s.printers {
+		if s.printers[k].Name == name {
+			return &s.printers[k]
+		}
+	}
+	return nil
+}
+
+// notFound 返回client-error-not-found
+func notFound(req *ipp.Message, msg string) *ipp.Message {
+	reply := ipp.NewRequest(ipp.StatusNotFound, req.RequestID)
+	reply.Add(ipp.TagOperation, "status-message", ipp.TagText, msg)
+	return reply
+}
+
+// appendPrinter 把打印机编码为一个属性组，空字符串属性不输出
+func appendPrinter(m *ipp.Message, p ipp.Printer) {
+	g := m.NewGroup(ipp.TagPrinter)
+	add := func(name string, tag byte, value string) {
+		if value != "" {
+			g.Add(name, tag, value)
+		}
+	}
+
+	uri := p.URI
+	if uri == "" {
+		uri = ipp.PrinterURI(p.Name)
+	}
+	state := p.State
+	if state == 0 {
+		state = ipp.PrinterIdle
+	}
+	reasons := p.StateReasons
+	if len(reasons) == 0 {
+		reasons = []string{"none"}
+	}
+
+	add("printer-name", ipp.TagName, p.Name)
+	add("printer-uri-supported", ipp.TagURI, uri)
+	g.AddInt("printer-state", ipp.TagEnum, state)
+	g.Add("printer-state-reasons", ipp.TagKeyword, reasons...)
+	add("printer-state-message", ipp.TagText, p.StateMessage)
+	add("printer-make-and-model", ipp.TagText, p.MakeAndModel)
+	add("device-uri", ipp.TagURI, p.DeviceURI)
+	add("printer-info", ipp.TagText, p.Info)
+	add("printer-location", ipp.TagText, p.Location)
+	g.AddBool("printer-is-shared", p.Shared)
+	g.AddBool("printer-is-accepting-jobs", p.AcceptingJobs)
+}
+
+// appendJob 把任务编码为一个属性组
+func appendJob(m *ipp.Message, j ipp.Job) {
+	g := m.NewGroup(ipp.TagJob)
+	g.AddInt("job-id", ipp.TagInteger, j.ID)
+	g.Add("job-name", ipp.TagName, j.Name)
+	g.AddInt("job-state", ipp.TagEnum, j.State)
+	g.Add("job-originating-user-name", ipp.TagName, j.User)
+	g.AddInt("job-k-octets", ipp.TagInteger, j.KOctets)
+	g.AddInt("time-at-creation", ipp.TagInteger, int(j.Created.Unix()))
+}
+
+// String 便于日志显示
+func (s *Server) String() string {
+	return fmt.Sprintf("IPP stub %s (%d台打印机)", s.addr, len(s.printers))
+}
@@ -0,0 +1,121 @@
+package layout
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"macos-clodop-schoolpal/escpos"
+)
+
+// 热敏打印机203dpi，每毫米8点；字体A每个字符宽12点，默认行高30点
+const (
+	dotsPerMM    = 8
+	lineHeightMM = 3.75
+)
+
+// RenderESCPOS 把模板渲染为ESC/POS指令，直接发给小票打印机，不经过驱动和Clodop。
+// 字号按纸张默认字号的倍数换算为字符放大倍数，尺寸按203dpi换算为点数；
+// 标题只作为任务名，不打印。vars的处理与Render相同
+func (t *Template) RenderESCPOS(profile PaperProfile, vars map[string]string) ([]byte, error) {
+	expand := func(s string) string {
+		if vars == nil {
+			return s
+		}
+		return Expand(s, vars)
+	}
+
+	e := escpos.NewEncoder().Chinese(true)
+	for i, item := range t.Items {
+		e.Align(escposAlign(item.Align))
+		switch item.Type {
+		case ItemText:
+			scale := textScale(item.FontSize, profile.FontSize)
+			e.Bold(item.Bold).Size(scale, scale).Line(expand(item.Text))
+			e.Bold(false).Size(1, 1)
+
+		case ItemLine:
+			e.Line(strings.Repeat("-", columns(profile)))
+
+		case ItemFeed:
+			if lines := int(math.Ceil(item.Height / lineHeightMM)); lines > 0 {
+				e.Feed(lines)
+			}
+
+		case ItemBarcode:
+			sym, err := escposSymbology(item.Symbology)
+			if err != nil {
+				return nil, fmt.Errorf("第%d项: %v", i+1, err)
+			}
+			height := item.Height
+			if height == 0 {
+				height = 12
+			}
+			e.Barcode(sym, expand(item.Text), clamp(int(height*dotsPerMM), 1, 255))
+
+		case ItemQR:
+			// 二维码的模块数随内容变化，按常见的33个模块估算每个模块的点数
+			module := 6
+			if item.Height > 0 {
+				module = clamp(int(math.Round(item.Height*dotsPerMM/33)), 1, 16)
+			}
+			e.QRCode(expand(item.Text), module)
+		}
+	}
+	e.Align(escpos.AlignLeft)
+
+	if err := e.Err(); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+// columns 字体A下一行可打印的字符数，80mm纸48列，58mm纸32列
+func columns(profile PaperProfile) int {
+	if profile.Width < 70 {
+		return 32
+	}
+	return 48
+}
+
+// textScale 字号相对纸张默认字号的放大倍数，四舍五入到1-8倍
+func textScale(fontSize, base int) int {
+	if fontSize == 0 || base <= 0 {
+		return 1
+	}
+	return clamp((fontSize+base/2)/base, 1, 8)
+}
+
+// escposAlign 转换对齐方式
+func escposAlign(align string) escpos.Align {
+	switch align {
+	case "center":
+		return escpos.AlignCenter
+	case "right":
+		return escpos.AlignRight
+	}
+	return escpos.AlignLeft
+}
+
+// escposSymbology 把LODOP的条码类型名转换为ESC/POS条码类型，Code128统一使用B集
+func escposSymbology(name string) (escpos.Symbology, error) {
+	switch name {
+	case "", "128Auto", "128A", "128B", "128C":
+		return escpos.Code128, nil
+	case "39", "Code39":
+		return escpos.Code39, nil
+	case "EAN13":
+		return escpos.EAN13, nil
+	}
+	return 0, fmt.Errorf("ESC/POS不支持条码类型 %s，可用: 128Auto、39、EAN13", name)
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,67 @@
+package layout
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRenderESCPOS(t *testing.T) {
+	profile, err := Profile("80mm", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &Template{
+		Title: "小票",
+		Items: []Item{
+			{Type: ItemText, Text: "Total: $12.50", Align: "center", Bold: true, FontSize: 20},
+			{Type: ItemLine},
+			{Type: ItemBarcode, Text: "A$1B"},
+			{Type: ItemQR, Text: "https://example.com"},
+			{Type: ItemFeed, Height: 10},
+		},
+	}
+
+	data, err := tpl.RenderESCPOS(profile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range [][]byte{
+		{0x1B, 0x40, 0x1C, 0x26},                // 初始化并进入汉字模式
+		{0x1B, 0x61, 0x01, 0x1B, 0x45, 0x01},    // 居中、加粗
+		{0x1D, 0x21, 0x11},                      // 字号20是默认10的2倍
+		[]byte("Total: $12.50\n"),               // 内容原样输出
+		bytes.Repeat([]byte("-"), 48),           // 80mm纸48列
+		{0x1D, 0x68, 96},                        // 默认条码高12mm
+		{0x1D, 0x6B, 73, 6, '{', 'B', 'A', '$'}, // Code128 B集
+		{0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x43, 6},
+		{0x1B, 0x64, 3}, // 10mm走纸3行
+	} {
+		if !bytes.Contains(data, want) {
+			t.Errorf("指令中没有 % X", want)
+		}
+	}
+}
+
+func TestRenderESCPOSErrors(t *testing.T) {
+	profile, err := Profile("58mm", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		item Item
+	}{
+		{"不支持的条码类型", Item{Type: ItemBarcode, Text: "123", Symbology: "PDF417"}},
+		{"EAN13位数错误", Item{Type: ItemBarcode, Text: "123", Symbology: "EAN13"}},
+		{"条码中有汉字", Item{Type: ItemBarcode, Text: "订单1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpl := &Template{Title: "小票", Items: []Item{tt.item}}
+			if _, err := tpl.RenderESCPOS(profile, nil); err == nil {
+				t.Error("应返回错误")
+			}
+		})
+	}
+}
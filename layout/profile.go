@@ -0,0 +1,55 @@
+// Package layout 描述小票的纸张和内容模板，并渲染为LODOP打印指令或ESC/POS指令。
+package layout
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PaperProfile 纸张规格，尺寸单位为毫米
+type PaperProfile struct {
+	Name     string  `yaml:"name" json:"name"`
+	Width    float64 `yaml:"width_mm" json:"width_mm"`
+	Height   float64 `yaml:"height_mm" json:"height_mm"` // 0表示连续纸，高度按内容计算
+	Margin   float64 `yaml:"margin_mm" json:"margin_mm"`
+	FontName string  `yaml:"font_name" json:"font_name"`
+	FontSize int     `yaml:"font_size" json:"font_size"`
+}
+
+// ContentWidth 去掉左右边距后的可打印宽度
+func (p PaperProfile) ContentWidth() float64 {
+	return p.Width - 2*p.Margin
+}
+
+// builtinProfiles 常用热敏小票和标签纸
+var builtinProfiles = map[string]PaperProfile{
+	"58mm":        {Name: "58mm", Width: 58, Margin: 2, FontName: "宋体", FontSize: 9},
+	"80mm":        {Name: "80mm", Width: 80, Margin: 3, FontName: "宋体", FontSize: 10},
+	"label-40x30": {Name: "label-40x30", Width: 40, Height: 30, Margin: 1.5, FontName: "宋体", FontSize: 8},
+	"label-60x40": {Name: "label-60x40", Width: 60, Height: 40, Margin: 2, FontName: "宋体", FontSize: 9},
+}
+
+// Profile 按名称查找纸张，custom中的同名配置优先于内置配置
+func Profile(name string, custom map[string]PaperProfile) (PaperProfile, error) {
+	if profile, ok := custom[name]; ok {
+		if profile.Name == "" {
+			profile.Name = name
+		}
+		if profile.Width <= 0 {
+			return PaperProfile{}, fmt.Errorf("纸张 %s 的宽度无效", name)
+		}
+		return profile, nil
+	}
+	if profile, ok := builtinProfiles[name]; ok {
+		return profile, nil
+	}
+	return PaperProfile{}, fmt.Errorf("未知的纸张规格: %s", name)
+}
+
+// GuessProfileName 根据打印机型号推测纸宽，型号中带58的按58mm处理
+func GuessProfileName(model string) string {
+	if strings.Contains(model, "58") {
+		return "58mm"
+	}
+	return "80mm"
+}
@@ -0,0 +1,237 @@
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"macos-clodop-schoolpal/clodop"
+)
+
+// 模板项类型
+const (
+	ItemText    = "text"
+	ItemLine    = "line"
+	ItemBarcode = "barcode"
+	ItemQR      = "qr"
+	ItemFeed    = "feed" // 空白走纸
+)
+
+// Item 模板中的一项，按顺序自上而下排列，尺寸单位为毫米
+type Item struct {
+	Type      string  `yaml:"type" json:"type"`
+	Text      string  `yaml:"text" json:"text"`           // 文本或条码内容，支持 ${变量}
+	Align     string  `yaml:"align" json:"align"`         // left, center, right
+	FontSize  int     `yaml:"font_size" json:"font_size"` // 0表示使用纸张默认字号
+	Bold      bool    `yaml:"bold" json:"bold"`
+	Height    float64 `yaml:"height_mm" json:"height_mm"` // 0表示按类型自动计算
+	Symbology string  `yaml:"symbology" json:"symbology"` // 条码类型，默认128Auto
+}
+
+// Template 小票模板
+type Template struct {
+	Title string `yaml:"title" json:"title"`
+	Items []Item `yaml:"items" json:"items"`
+}
+
+// LoadTemplate 读取YAML或JSON格式的模板，按扩展名判断格式
+func LoadTemplate(filename string) (*Template, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取模板 %s: %v", filename, err)
+	}
+
+	var tpl Template
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		err = json.Unmarshal(data, &tpl)
+	} else {
+		err = yaml.Unmarshal(data, &tpl)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无法解析模板 %s: %v", filename, err)
+	}
+
+	if err := tpl.Validate(); err != nil {
+		return nil, fmt.Errorf("模板 %s 无效: %v", filename, err)
+	}
+	return &tpl, nil
+}
+
+// Validate 检查模板项类型和对齐方式
+func (t *Template) Validate() error {
+	if len(t.Items) == 0 {
+		return fmt.Errorf("模板没有任何内容")
+	}
+	for i, item := range t.Items {
+		switch item.Type {
+		case ItemText, ItemBarcode, ItemQR:
+			if item.Text == "" {
+				return fmt.Errorf("第%d项(%s)缺少内容", i+1, item.Type)
+			}
+		case ItemLine, ItemFeed:
+		default:
+			return fmt.Errorf("第%d项类型未知: %q", i+1, item.Type)
+		}
+		switch item.Align {
+		case "", "left", "center", "right":
+		default:
+			return fmt.Errorf("第%d项对齐方式未知: %q", i+1, item.Align)
+		}
+	}
+	return nil
+}
+
+// Render 按纸张规格把模板渲染为LODOP打印任务，vars用于替换 ${变量}。
+// vars为nil时内容原样输出，不做任何替换，用于打印接口等外部提交的小票
+func (t *Template) Render(profile PaperProfile, vars map[string]string) *clodop.Job {
+	expand := func(s string) string {
+		if vars == nil {
+			return s
+		}
+		return Expand(s, vars)
+	}
+
+	title := expand(t.Title)
+	job := clodop.NewJob(title)
+
+	width := profile.ContentWidth()
+	top := profile.Margin
+
+	for _, item := range t.Items {
+		switch item.Type {
+		case ItemText:
+			fontSize := item.FontSize
+			if fontSize == 0 {
+				fontSize = profile.FontSize
+			}
+			height := item.Height
+			if height == 0 {
+				height = textHeight(fontSize)
+			}
+			job.AddText(mm(top), mm(profile.Margin), mm(width), mm(height), expand(item.Text))
+			job.SetStyleA(0, "FontName", profile.FontName)
+			job.SetStyleA(0, "FontSize", fontSize)
+			if item.Bold {
+				job.SetStyleA(0, "Bold", 1)
+			}
+			if align := alignment(item.Align); align != 1 {
+				job.SetStyleA(0, "Alignment", align)
+			}
+			top += height
+
+		case ItemLine:
+			height := item.Height
+			if height == 0 {
+				height = 2
+			}
+			y := top + height/2
+			job.Add("ADD_PRINT_LINE", mm(y), mm(profile.Margin), mm(y), mm(profile.Margin+width), 0, 1)
+			top += height
+
+		case ItemFeed:
+			top += item.Height
+
+		case ItemBarcode, ItemQR:
+			symbology := item.Symbology
+			height := item.Height
+			boxWidth := width
+			if item.Type == ItemQR {
+				symbology = "QRCode"
+				if height == 0 {
+					height = width / 2
+				}
+				boxWidth = height
+			} else {
+				if symbology == "" {
+					symbology = "128Auto"
+				}
+				if height == 0 {
+					height = 12
+				}
+			}
+			left := profile.Margin + offset(item.Align, width, boxWidth)
+			job.Add("ADD_PRINT_BARCODE", mm(top), mm(left), mm(boxWidth), mm(height), symbology, expand(item.Text))
+			top += height + 1
+		}
+	}
+
+	// 连续纸按内容高度设置页长
+	pageHeight := profile.Height
+	if pageHeight == 0 {
+		pageHeight = top + profile.Margin + 5
+	}
+	setPageSize(job, profile, pageHeight)
+
+	return job
+}
+
+// Expand 把 s 中的 ${name} 替换为 vars 中的值，只替换已知的变量；$$ 表示一个 $。
+// 其他 $ 原样保留，金额 "$12.50" 和条码 "A$1B" 不受影响
+func Expand(s string, vars map[string]string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			b.WriteByte(s[i])
+			continue
+		}
+		rest := s[i+1:]
+		if strings.HasPrefix(rest, "$") {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+		if strings.HasPrefix(rest, "{") {
+			if end := strings.IndexByte(rest, '}'); end > 0 {
+				if value, ok := vars[rest[1:end]]; ok {
+					b.WriteString(value)
+					i += end + 1
+					continue
+				}
+			}
+		}
+		b.WriteByte('$')
+	}
+	return b.String()
+}
+
+// setPageSize 把纸张设置插入到 PRINT_INIT 之后
+func setPageSize(job *clodop.Job, profile PaperProfile, height float64) {
+	cmd := clodop.Command{Name: "SET_PRINT_PAGESIZE", Args: []interface{}{1, mm(profile.Width), mm(height), ""}}
+	job.Commands = append(job.Commands[:1], append([]clodop.Command{cmd}, job.Commands[1:]...)...)
+}
+
+// textHeight 按字号估算一行文字的高度(毫米)，1pt约0.353mm，再留出行距
+func textHeight(fontSize int) float64 {
+	return float64(fontSize)*0.353*1.5 + 1
+}
+
+// alignment LODOP的Alignment样式: 1左 2中 3右
+func alignment(align string) int {
+	switch align {
+	case "center":
+		return 2
+	case "right":
+		return 3
+	}
+	return 1
+}
+
+// offset 按对齐方式计算块在可打印区域内的左偏移
+func offset(align string, width, boxWidth float64) float64 {
+	switch align {
+	case "center":
+		return (width - boxWidth) / 2
+	case "right":
+		return width - boxWidth
+	}
+	return 0
+}
+
+// mm 生成LODOP可识别的毫米单位字符串
+func mm(v float64) string {
+	return fmt.Sprintf("%.1fmm", v)
+}
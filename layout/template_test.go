@@ -0,0 +1,80 @@
+package layout
+
+import "testing"
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{"title": "测试页", "time": "2024-05-01 10:00", "model": "HPRT_TP80B"}
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"价格", "Total: $12.50", "Total: $12.50"},
+		{"整数金额", "Order $100", "Order $100"},
+		{"条码数据", "A$1B", "A$1B"},
+		{"结尾的$", "价格 100$", "价格 100$"},
+		{"占位符", "${title}", "测试页"},
+		{"占位符与文字", "打印时间: ${time}", "打印时间: 2024-05-01 10:00"},
+		{"多个占位符", "${model} ${title}", "HPRT_TP80B 测试页"},
+		{"未知变量原样保留", "${price}", "${price}"},
+		{"未闭合", "${title", "${title"},
+		{"不带花括号", "$title", "$title"},
+		{"转义", "$${title}", "${title}"},
+		{"转义金额", "$$12.50", "$12.50"},
+		{"占位符与金额", "${title} $9.90", "测试页 $9.90"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Expand(tt.in, vars); got != tt.want {
+				t.Errorf("Expand(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderVars(t *testing.T) {
+	tpl := &Template{
+		Title: "${title}",
+		Items: []Item{
+			{Type: ItemText, Text: "Total: $12.50 ${title}"},
+			{Type: ItemBarcode, Text: "A$1B"},
+		},
+	}
+	profile, err := Profile("80mm", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		title   string
+		text    string
+		barcode string
+	}{
+		{"替换变量", map[string]string{"title": "测试页"}, "测试页", "Total: $12.50 测试页", "A$1B"},
+		{"vars为nil时原样输出", nil, "${title}", "Total: $12.50 ${title}", "A$1B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := tpl.Render(profile, tt.vars)
+			if job.Name != tt.title {
+				t.Errorf("标题 = %q, want %q", job.Name, tt.title)
+			}
+			got := map[string]string{}
+			for _, cmd := range job.Commands {
+				switch cmd.Name {
+				case "ADD_PRINT_TEXT", "ADD_PRINT_BARCODE":
+					got[cmd.Name] = cmd.Args[len(cmd.Args)-1].(string)
+				}
+			}
+			if got["ADD_PRINT_TEXT"] != tt.text {
+				t.Errorf("文本 = %q, want %q", got["ADD_PRINT_TEXT"], tt.text)
+			}
+			if got["ADD_PRINT_BARCODE"] != tt.barcode {
+				t.Errorf("条码 = %q, want %q", got["ADD_PRINT_BARCODE"], tt.barcode)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -14,7 +15,10 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
+	"macos-clodop-schoolpal/clodop"
 	"macos-clodop-schoolpal/config"
+	"macos-clodop-schoolpal/printapi"
+	"macos-clodop-schoolpal/printerstatus"
 	"macos-clodop-schoolpal/steps"
 	"macos-clodop-schoolpal/utils"
 )
@@ -118,16 +122,19 @@ func main() {
 	myApp.Settings().SetTheme(createChineseTheme())
 
 	// 创建主窗口
-	window := myApp.NewWindow("HPRT打印机一键配置工具")
+	window := myApp.NewWindow(appTitle(cfg))
 	window.Resize(fyne.NewSize(600, 500))
 	window.CenterOnScreen()
 
 	// 创建UI组件
-	titleLabel := widget.NewLabel("HPRT打印机一键配置工具")
+	titleLabel := widget.NewLabel(appTitle(cfg))
 	titleLabel.Alignment = fyne.TextAlignCenter
 	titleLabel.TextStyle = fyne.TextStyle{Bold: true}
 
 	statusLabel := widget.NewLabel("准备开始配置...")
+	// 配置完成后显示打印机的缺纸、开盖、离线状态
+	printerLabel := widget.NewLabel("")
+	printerLabel.Hide()
 	progressBar := widget.NewProgressBar()
 	progressBar.SetValue(0)
 
@@ -151,18 +158,35 @@ func main() {
 		}()
 	})
 
+	backupButton := widget.NewButton("CUPS备份", func() {
+		showCUPSBackupWindow(func(msg string) { addLog(logText, msg) })
+	})
+
 	exitButton := widget.NewButton("退出程序", func() {
 		myApp.Quit()
 	})
 
+	// 打印接口启动后才显示
+	queueButton := widget.NewButton("打印队列", nil)
+	queueButton.Hide()
+
+	// 打印记录在配置文件正常时才能打开
+	historyButton := widget.NewButton("打印记录", nil)
+	historyButton.Hide()
+
+	// 绕过Clodop直接向打印机发送ESC/POS测试小票，区分打印机问题和网络问题
+	rawButton := widget.NewButton("直连打印测试", nil)
+	rawButton.Hide()
+
 	// 按钮容器
-	buttonContainer := container.NewHBox(cupsButton, exitButton)
+	buttonContainer := container.NewHBox(cupsButton, backupButton, rawButton, queueButton, historyButton, exitButton)
 
 	// 布局
 	content := container.NewVBox(
 		titleLabel,
 		widget.NewSeparator(),
 		statusLabel,
+		printerLabel,
 		progressBar,
 		widget.NewLabel("详细日志:"),
 		logContainer,
@@ -173,7 +197,26 @@ func main() {
 
 	// 如果配置文件正常，自动开始执行
 	if cfg != nil {
-		go runAllSteps(cfg, progressBar, statusLabel, logText, window)
+		store, err := openHistory(cfg)
+		if err != nil {
+			addLog(logText, fmt.Sprintf("⚠️ 打印记录不可用: %v", err))
+		} else {
+			historyButton.OnTapped = func() {
+				showHistoryWindow(store, func(msg string) { addLog(logText, msg) })
+			}
+			historyButton.Show()
+		}
+		rawButton.OnTapped = func() {
+			go func() {
+				if err := steps.PrintRawTestTicket(cfg); err != nil {
+					addLog(logText, fmt.Sprintf("❌ %v", err))
+					return
+				}
+				addLog(logText, "🧾 ESC/POS测试小票已发送，能出纸说明打印机和驱动正常")
+			}()
+		}
+		rawButton.Show()
+		go runAllSteps(cfg, progressBar, statusLabel, printerLabel, logText, queueButton, window)
 	} else {
 		statusLabel.SetText("❌ 配置文件错误，请检查config.yaml")
 		addLog(logText, "❌ 配置文件加载失败: "+err.Error())
@@ -184,16 +227,36 @@ func main() {
 	window.ShowAndRun()
 }
 
+// appTitle 窗口标题，配置文件加载失败时不知道型号，使用通用标题
+func appTitle(cfg *config.Config) string {
+	if cfg == nil {
+		return "小票打印机一键配置工具"
+	}
+	return cfg.PrinterModel().DisplayName() + " 打印机一键配置工具"
+}
+
 // runAllSteps 执行所有配置步骤
-func runAllSteps(cfg *config.Config, progressBar *widget.ProgressBar, statusLabel *widget.Label, logText *widget.Entry, window fyne.Window) {
+func runAllSteps(cfg *config.Config, progressBar *widget.ProgressBar, statusLabel, printerLabel *widget.Label, logText *widget.Entry, queueButton *widget.Button, window fyne.Window) {
 	addLog := func(msg string) {
 		addLog(logText, msg)
 	}
 
-	addLog("🚀 开始HPRT打印机自动配置")
+	addLog(fmt.Sprintf("🚀 开始%s打印机自动配置", cfg.PrinterModel().DisplayName()))
 	addLog(fmt.Sprintf("📋 配置信息: VPN=%s, 远程主机=%s:%s",
 		cfg.VPN.Name, cfg.Network.RemoteHost, cfg.Network.RemotePort))
 
+	// 本地打印接口和离线队列不依赖配置结果：打印队列还未创建或打印机不可用时小票先进入队列，恢复后补打
+	var printServer *printapi.Server
+	if cfg.PrintAPI.Enabled {
+		printServer = startPrintAPI(cfg, addLog)
+	}
+	if printServer != nil {
+		queue := printServer.Queue()
+		queueButton.OnTapped = func() { showQueueWindow(queue, addLog) }
+		queueButton.Show()
+		go watchQueue(queueButton, queue)
+	}
+
 	// 定义所有步骤
 	allSteps := []struct {
 		Name        string
@@ -202,7 +265,7 @@ func runAllSteps(cfg *config.Config, progressBar *widget.ProgressBar, statusLabe
 	}{
 		{"环境检查", "检查系统版本和权限", steps.CheckEnvironment},
 		{"验证驱动", "确认驱动文件完整性", steps.VerifyDriver},
-		{"安装驱动", "安装HPRT打印机驱动", steps.InstallDriver},
+		{"安装驱动", "安装打印机驱动", steps.InstallDriver},
 		{"检测打印机", "检测打印机连接状态", steps.DetectPrinter},
 		{"安装工具", "安装socat网络工具", steps.InstallSocat},
 		{"配置CUPS", "配置CUPS打印服务", steps.ConfigureCUPS},
@@ -219,6 +282,9 @@ func runAllSteps(cfg *config.Config, progressBar *widget.ProgressBar, statusLabe
 		addLog(fmt.Sprintf("🔄 第%d/%d步: %s", i+1, totalSteps, step.Name))
 
 		err := step.Execute(cfg)
+		for _, warning := range steps.TakeWarnings() {
+			addLog("⚠️ " + warning)
+		}
 		if err != nil {
 			// 在GUI上显示错误信息
 			addLog(fmt.Sprintf("❌ %s 失败: %s", step.Name, err.Error()))
@@ -239,6 +305,7 @@ func runAllSteps(cfg *config.Config, progressBar *widget.ProgressBar, statusLabe
 				addLog("   - VPN配置是否正确（服务器地址、用户名、密码、共享密钥）")
 				addLog("   - 网络连接是否正常")
 				addLog("   - VPN服务器是否可访问")
+				addLog("   - 本地网段是否与远程网段冲突，导致流量未经过VPN")
 			case "测试连接":
 				addLog("   ⚠️ 以下问题可能导致打印测试失败:")
 				addLog("   - 远程Windows电脑上Clodop服务未运行")
@@ -252,6 +319,7 @@ func runAllSteps(cfg *config.Config, progressBar *widget.ProgressBar, statusLabe
 				addLog("   2. 检查打印机电源和USB连接")
 				addLog("   3. 验证VPN连接状态")
 				addLog("   4. 重新启动配置程序重试")
+				addLog("   5. 点击\"直连打印测试\"：能出纸说明打印机正常，问题在VPN、转发或Clodop")
 			default:
 				addLog("   - 检查网络连接")
 				addLog("   - 确认所需权限")
@@ -272,10 +340,62 @@ func runAllSteps(cfg *config.Config, progressBar *widget.ProgressBar, statusLabe
 	if allSuccess {
 		statusLabel.SetText("🎉 配置完成！打印机已就绪")
 		addLog("🎉 所有配置步骤完成！")
-		addLog("✨ HPRT打印机现在可以通过Clodop正常使用了")
+		addLog(fmt.Sprintf("✨ %s 现在可以通过Clodop正常使用了", cfg.PrinterModel().DisplayName()))
+		if endpoint := steps.CachedClodopEndpoint(); endpoint != nil {
+			addLog(fmt.Sprintf("🖨️ Clodop服务: %s", endpoint))
+		}
+		if proxy := steps.CachedForwardProxy(); proxy != nil {
+			addLog(fmt.Sprintf("📦 Clodop脚本缓存: %s", proxy.Stats()))
+		}
 		addLog("📝 如果打印机已出纸，说明配置完全正常")
 		addLog("🕒 请等待10秒确认打印结果...")
 
+		// 配置完成后立即补打启动期间暂存的小票
+		if printServer != nil {
+			printServer.Queue().Kick()
+		}
+
+		// 定期检查Clodop服务，脚本或证书被替换时重新显示窗口并发出通知
+		steps.StartHealthCheck(cfg, func(err error) {
+			if err == nil {
+				addLog("✅ Clodop服务检查已恢复正常")
+				if printServer != nil {
+					printServer.Queue().Kick()
+				}
+				return
+			}
+			// 未配置固定指纹时的变化多半是升级了C-Lodop，只记录不报警
+			var changed *clodop.ChangedError
+			if errors.As(err, &changed) {
+				addLog(fmt.Sprintf("⚠️ %v", err))
+				return
+			}
+			addLog(fmt.Sprintf("🚨 Clodop服务检查失败: %v", err))
+			fyne.CurrentApp().SendNotification(fyne.NewNotification("Clodop服务异常", err.Error()))
+			window.Show()
+		})
+
+		// 监控缺纸、开盖和离线，出现问题时发出通知，恢复后补打队列中的小票
+		printerLabel.Show()
+		steps.StartPrinterMonitor(cfg, func(status *printerstatus.Status) {
+			text := fmt.Sprintf("🖨️ 打印机状态: %s", status)
+			if status.Note != "" {
+				text += "（" + status.Note + "）"
+			}
+			printerLabel.SetText(text)
+			if status.Ready {
+				addLog(fmt.Sprintf("✅ 打印机 %s 状态正常", status.Printer))
+				if printServer != nil {
+					printServer.Queue().Kick()
+				}
+				return
+			}
+			addLog(fmt.Sprintf("🚨 打印机 %s: %s", status.Printer, status))
+			if status.Error == "" {
+				fyne.CurrentApp().SendNotification(fyne.NewNotification("打印机需要处理", status.String()))
+			}
+		})
+
 		// 延长等待时间，确保打印任务完成
 		go func() {
 			// 等待10秒，让用户确认打印结果
@@ -301,6 +421,24 @@ func runAllSteps(cfg *config.Config, progressBar *widget.ProgressBar, statusLabe
 	}
 }
 
+// startPrintAPI 启动本地打印接口，把小票以ESC/POS指令直接发给打印机，失败时返回nil
+func startPrintAPI(cfg *config.Config, addLog func(string)) *printapi.Server {
+	server := printapi.NewServer(cfg, func(printer string) (string, printapi.SendFunc, error) {
+		target, send, err := steps.RawTarget(cfg, printer)
+		return target, printapi.SendFunc(send), err
+	}, steps.CurrentPrinterStatus)
+
+	if err := server.Start(); err != nil {
+		addLog(fmt.Sprintf("⚠️ 本地打印接口未启动: %v", err))
+		return nil
+	}
+	addLog(fmt.Sprintf("🧾 本地打印接口已启动: http://%s/v1/print", cfg.PrintAPI.Listen))
+	if n := server.Queue().Len(); n > 0 {
+		addLog(fmt.Sprintf("📥 队列中有 %d 张上次未打印的小票，将自动补打", n))
+	}
+	return server
+}
+
 // addLog 添加日志信息
 func addLog(logText *widget.Entry, msg string) {
 	timestamp := time.Now().Format("15:04:05")
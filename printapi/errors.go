@@ -0,0 +1,62 @@
+package printapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"macos-clodop-schoolpal/ipp"
+)
+
+// 发送结果的分类，决定任务是否进入队列以及如何重试
+type deliverResult int
+
+const (
+	deliverOK          deliverResult = iota
+	deliverRejected                  // 队列不存在、格式不支持、没有权限等，重试不会成功
+	deliverRetryJob                  // CUPS对该任务返回服务端错误，稍后单独重试
+	deliverUnavailable               // CUPS或打印机不可用，整个队列等待恢复
+)
+
+// unavailableError 没有可用的发送目标，如配置尚未完成、CUPS队列还未创建
+type unavailableError struct{ err error }
+
+func (e *unavailableError) Error() string { return "打印机不可用: " + e.err.Error() }
+func (e *unavailableError) Unwrap() error { return e.err }
+
+// classify 按CUPS和网口打印机实际返回的错误分类。CUPS接受任务即视为成功，
+// 打印机离线时任务在CUPS中等待，不需要本队列重试：
+//   - 连不上CUPS或9100端口、超时、队列停止接收或忙: 整个队列等待
+//   - 其他IPP 0x05xx和HTTP 5xx: 只推迟这一个任务
+//   - IPP 0x04xx（如0x0406队列不存在）和其他HTTP错误（如403）: 直接失败
+func classify(err error) deliverResult {
+	if err == nil {
+		return deliverOK
+	}
+
+	var unavailable *unavailableError
+	var status *ipp.StatusError
+	var httpErr *ipp.HTTPError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &unavailable):
+		return deliverUnavailable
+	case errors.As(err, &status):
+		switch {
+		case status.Code == ipp.StatusServiceUnavailable, status.Code == ipp.StatusNotAcceptingJobs, status.Code == ipp.StatusPrinterBusy:
+			return deliverUnavailable
+		case status.Code >= 0x0500:
+			return deliverRetryJob
+		}
+		return deliverRejected
+	case errors.As(err, &httpErr):
+		if httpErr.StatusCode >= http.StatusInternalServerError {
+			return deliverRetryJob
+		}
+		return deliverRejected
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return deliverUnavailable
+	}
+	return deliverRejected
+}
@@ -0,0 +1,430 @@
+package printapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 队列中任务的状态
+const (
+	QueuePending = "pending" // 等待重试
+	QueueExpired = "expired" // 超过有效期仍未打印，等待人工处理
+)
+
+// 重试间隔从minRetryInterval开始翻倍，直到配置的上限
+const minRetryInterval = 5 * time.Second
+
+// deliverTimeout 每次提交的超时时间
+const deliverTimeout = 30 * time.Second
+
+// QueuedJob 暂存在磁盘上等待打印的任务
+type QueuedJob struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Printer   string    `json:"printer,omitempty"` // 小票指定的CUPS队列，空表示使用配置
+	Data      []byte    `json:"data"`              // ESC/POS指令
+	State     string    `json:"state"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+
+	NextAttempt time.Time `json:"next_attempt,omitempty"` // 该任务单独退避时的下一次尝试时间
+}
+
+// deliverFunc 发送一个任务，返回实际使用的目标和任务ID
+type deliverFunc func(ctx context.Context, title string, data []byte, printer string) (string, string, error)
+
+// Queue 远程不可用时暂存任务的磁盘队列，按提交顺序重试。
+// CUPS或打印机不可用时整个队列退避；某个任务被拒绝时直接判定失败，CUPS对单个任务返回服务端错误时只推迟该任务，都不阻塞后面的小票
+type Queue struct {
+	dir         string
+	expiry      time.Duration
+	maxInterval time.Duration
+	deliver     deliverFunc
+	onDone      func(JobStatus)
+
+	mu         sync.Mutex
+	jobs       map[string]*QueuedJob
+	failures   int       // 打印机连续不可用的次数
+	next       time.Time // 打印机不可用时整个队列的下一次尝试时间
+	delivering string    // 正在发送的任务，不能取消
+
+	kick chan struct{}
+	done chan struct{}
+}
+
+// OpenQueue 打开目录中的队列，加载上次未完成的任务
+func OpenQueue(dir string, expiry, maxInterval time.Duration, deliver deliverFunc, onDone func(JobStatus)) (*Queue, error) {
+	q := &Queue{
+		dir:         dir,
+		expiry:      expiry,
+		maxInterval: maxInterval,
+		deliver:     deliver,
+		onDone:      onDone,
+		jobs:        make(map[string]*QueuedJob),
+		kick:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取打印队列 %s: %v", dir, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var job QueuedJob
+		if err := json.Unmarshal(data, &job); err != nil || job.ID == "" || len(job.Data) == 0 {
+			continue
+		}
+		q.jobs[job.ID] = &job
+	}
+
+	return q, nil
+}
+
+// Start 启动后台重试
+func (q *Queue) Start() {
+	go q.run()
+}
+
+// Close 停止后台重试，磁盘上的任务保留到下次启动
+func (q *Queue) Close() {
+	select {
+	case <-q.done:
+	default:
+		close(q.done)
+	}
+}
+
+// Add 把任务写入磁盘并加入队列
+func (q *Queue) Add(job *QueuedJob) error {
+	job.State = QueuePending
+	job.Expires = job.Created.Add(q.expiry)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.save(job); err != nil {
+		return err
+	}
+	q.jobs[job.ID] = job
+	return nil
+}
+
+// Len 返回队列中的任务数，包括已过期的
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+// Pending 返回等待发送的任务数，不包括已过期的
+func (q *Queue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, job := range q.jobs {
+		if job.State == QueuePending {
+			n++
+		}
+	}
+	return n
+}
+
+// Get 返回队列中的任务，不存在时ok为false
+func (q *Queue) Get(id string) (job QueuedJob, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if j, found := q.jobs[id]; found {
+		return *j, true
+	}
+	return QueuedJob{}, false
+}
+
+// List 按提交顺序返回所有任务
+func (q *Queue) List() []QueuedJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]QueuedJob, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+	return jobs
+}
+
+// Cancel 放弃任务并从磁盘删除，正在发送的任务无法取消
+func (q *Queue) Cancel(id string) error {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if !ok {
+		q.mu.Unlock()
+		return fmt.Errorf("任务 %s 不在队列中", id)
+	}
+	if q.delivering == id {
+		q.mu.Unlock()
+		return fmt.Errorf("任务 %s 正在发送，无法取消", id)
+	}
+	delete(q.jobs, id)
+	err := q.remove(id)
+	q.mu.Unlock()
+
+	q.onDone(job.status(StatusCanceled, "已手动取消"))
+	return err
+}
+
+// Retry 立即重试任务，已过期的任务重新计算有效期
+func (q *Queue) Retry(id string) error {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if !ok {
+		q.mu.Unlock()
+		return fmt.Errorf("任务 %s 不在队列中", id)
+	}
+	if job.State == QueueExpired {
+		job.State = QueuePending
+		job.Expires = time.Now().Add(q.expiry)
+	}
+	job.NextAttempt = time.Time{}
+	err := q.save(job)
+	q.mu.Unlock()
+
+	q.Kick()
+	return err
+}
+
+// Kick 跳过等待，立即尝试发送，例如配置完成或打印机恢复时
+func (q *Queue) Kick() {
+	q.mu.Lock()
+	q.next = time.Time{}
+	q.mu.Unlock()
+
+	select {
+	case q.kick <- struct{}{}:
+	default:
+	}
+}
+
+// run 定期处理到期的任务
+func (q *Queue) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-q.kick:
+		case <-ticker.C:
+		}
+		q.process()
+	}
+}
+
+// process 按提交顺序发送到期的任务。打印机不可用时停止本轮并整体退避，保证小票不乱序；
+// 任务被拒绝时判定失败并继续发送后面的任务
+func (q *Queue) process() {
+	q.mu.Lock()
+	if time.Now().Before(q.next) {
+		q.mu.Unlock()
+		return
+	}
+	q.mu.Unlock()
+
+	for _, job := range q.List() {
+		if job.State != QueuePending || time.Now().Before(job.NextAttempt) {
+			continue
+		}
+
+		if time.Now().After(job.Expires) {
+			q.expire(job.ID)
+			continue
+		}
+
+		if !q.begin(job.ID) {
+			continue // 已被取消
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), deliverTimeout)
+		printer, printJobID, err := q.deliver(ctx, job.Title, job.Data, job.Printer)
+		cancel()
+
+		switch classify(err) {
+		case deliverOK:
+			q.delivered(job.ID, printer, printJobID)
+		case deliverRejected:
+			q.rejected(job.ID, printer, err)
+		case deliverRetryJob:
+			q.retryLater(job.ID, err)
+		default:
+			q.unavailable(job.ID, err)
+			return
+		}
+	}
+}
+
+// begin 标记任务正在发送，任务已不在队列中时返回false
+func (q *Queue) begin(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.jobs[id]; !ok {
+		return false
+	}
+	q.delivering = id
+	return true
+}
+
+// finish 从队列中移除任务并清除发送标记，返回被移除的任务
+func (q *Queue) finish(id string) (*QueuedJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.delivering = ""
+	job, ok := q.jobs[id]
+	if ok {
+		delete(q.jobs, id)
+		q.remove(id)
+	}
+	return job, ok
+}
+
+// delivered 任务打印成功，移出队列
+func (q *Queue) delivered(id, printer, printJobID string) {
+	job, ok := q.finish(id)
+	if !ok {
+		return
+	}
+	q.mu.Lock()
+	q.failures = 0
+	q.mu.Unlock()
+
+	status := job.status(StatusPrinted, "")
+	status.Printer = printer
+	status.PrintJobID = printJobID
+	q.onDone(status)
+}
+
+// rejected 任务被拒绝，重试也不会成功，移出队列并记录失败
+func (q *Queue) rejected(id, printer string, err error) {
+	job, ok := q.finish(id)
+	if !ok {
+		return
+	}
+	job.Attempts++
+	status := job.status(StatusFailed, err.Error())
+	if printer != "" {
+		status.Printer = printer
+	}
+	q.onDone(status)
+}
+
+// retryLater CUPS对该任务返回服务端错误，只推迟这一个任务
+func (q *Queue) retryLater(id string, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.delivering = ""
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return
+	}
+	job.Attempts++
+	job.LastError = err.Error()
+	job.NextAttempt = time.Now().Add(q.backoff(job.Attempts - 1))
+	q.save(job)
+}
+
+// unavailable 打印机不可用，记录失败并推迟整个队列的下一次尝试
+func (q *Queue) unavailable(id string, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.delivering = ""
+
+	if job, ok := q.jobs[id]; ok {
+		job.Attempts++
+		job.LastError = err.Error()
+		q.save(job)
+	}
+
+	q.next = time.Now().Add(q.backoff(q.failures))
+	if q.backoff(q.failures) < q.maxInterval {
+		q.failures++
+	}
+}
+
+// backoff 第n次失败后的等待时间，从minRetryInterval开始翻倍，不超过上限
+func (q *Queue) backoff(n int) time.Duration {
+	if n > 30 {
+		return q.maxInterval
+	}
+	interval := minRetryInterval << n
+	if interval <= 0 || interval > q.maxInterval {
+		return q.maxInterval
+	}
+	return interval
+}
+
+// expire 任务超过有效期，保留在队列中等待人工重试或取消
+func (q *Queue) expire(id string) {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if !ok {
+		q.mu.Unlock()
+		return
+	}
+	job.State = QueueExpired
+	q.save(job)
+	status := job.status(StatusExpired, fmt.Sprintf("超过%v仍未打印: %s", q.expiry, job.LastError))
+	q.mu.Unlock()
+
+	q.onDone(status)
+}
+
+// status 转换为接口返回的任务状态
+func (j *QueuedJob) status(state, msg string) JobStatus {
+	return JobStatus{
+		ID:       j.ID,
+		Title:    j.Title,
+		Status:   state,
+		Printer:  j.Printer,
+		Error:    msg,
+		Attempts: j.Attempts,
+		Size:     len(j.Data),
+		Created:  j.Created,
+	}
+}
+
+// save 先写临时文件再改名，避免写到一半时退出损坏队列
+func (q *Queue) save(job *QueuedJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(q.dir, job.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("无法写入打印队列: %v", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// remove 删除任务文件
+func (q *Queue) remove(id string) error {
+	err := os.Remove(filepath.Join(q.dir, id+".json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
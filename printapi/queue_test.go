@@ -0,0 +1,201 @@
+package printapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"macos-clodop-schoolpal/ipp"
+	"macos-clodop-schoolpal/ipp/stub"
+)
+
+// fakeDeliver 按任务名返回预设的错误，并记录发送顺序
+type fakeDeliver struct {
+	mu     sync.Mutex
+	errs   map[string]error
+	sent   []string
+	block  chan struct{} // 非nil时发送阻塞到关闭
+	inside chan struct{}
+}
+
+func (f *fakeDeliver) deliver(ctx context.Context, title string, data []byte, printer string) (string, string, error) {
+	if f.block != nil {
+		f.inside <- struct{}{}
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, title)
+	if err := f.errs[title]; err != nil {
+		return printer, "", err
+	}
+	return printer, "job-" + title, nil
+}
+
+// newTestQueue 创建临时目录中的队列，记录完成的任务状态
+func newTestQueue(t *testing.T, deliver deliverFunc, names ...string) (*Queue, map[string]JobStatus) {
+	t.Helper()
+	done := map[string]JobStatus{}
+	var mu sync.Mutex
+	q, err := OpenQueue(t.TempDir(), time.Hour, time.Minute, deliver, func(status JobStatus) {
+		mu.Lock()
+		defer mu.Unlock()
+		done[status.Title] = status
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range names {
+		job := &QueuedJob{
+			ID:      fmt.Sprintf("%02d", i),
+			Title:   name,
+			Data:    []byte(name),
+			Created: time.Now().Add(time.Duration(i) * time.Millisecond),
+		}
+		if err := q.Add(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return q, done
+}
+
+// realErrors 从真实来源获得的错误：连不上的CUPS、连不上的9100端口、模拟CUPS返回的应答
+func realErrors(t *testing.T) (refused, socketRefused, notFound, notAccepting error) {
+	t.Helper()
+	ctx := context.Background()
+
+	// 占用一个端口再关闭，保证连接被拒绝
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, refused = ipp.NewClient("http://"+addr).PrintJob(ctx, "HPRT_TP80B", "小票", "application/vnd.cups-raw", []byte{0x1B, 0x40})
+	_, socketRefused = net.Dial("tcp", addr)
+
+	cups := stub.NewServer([]ipp.Printer{{Name: "STOPPED", State: ipp.PrinterStopped}})
+	if err := cups.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cups.Close)
+	client := ipp.NewClient(cups.URL())
+	_, notFound = client.PrintJob(ctx, "不存在", "小票", "application/vnd.cups-raw", []byte{0x1B, 0x40})
+	_, notAccepting = client.PrintJob(ctx, "STOPPED", "小票", "application/vnd.cups-raw", []byte{0x1B, 0x40})
+
+	for _, err := range []error{refused, socketRefused, notFound, notAccepting} {
+		if err == nil {
+			t.Fatal("应返回错误")
+		}
+	}
+	return
+}
+
+func TestClassify(t *testing.T) {
+	refused, socketRefused, notFound, notAccepting := realErrors(t)
+
+	tests := []struct {
+		name string
+		err  error
+		want deliverResult
+	}{
+		{"成功", nil, deliverOK},
+		{"配置未完成", &unavailableError{err: errors.New("CUPS中没有打印队列")}, deliverUnavailable},
+		{"CUPS未运行", refused, deliverUnavailable},
+		{"网口打印机连不上", socketRefused, deliverUnavailable},
+		{"发送超时", fmt.Errorf("发送失败: %w", context.DeadlineExceeded), deliverUnavailable},
+		{"队列停止接收", notAccepting, deliverUnavailable},
+		{"打印机忙", &ipp.StatusError{Code: ipp.StatusPrinterBusy}, deliverUnavailable},
+		{"调度程序不可用", &ipp.StatusError{Code: ipp.StatusServiceUnavailable}, deliverUnavailable},
+		{"服务端内部错误", &ipp.StatusError{Code: 0x0500}, deliverRetryJob},
+		{"HTTP 500", &ipp.HTTPError{StatusCode: 500, Status: "500 Internal Server Error"}, deliverRetryJob},
+		{"队列不存在", notFound, deliverRejected},
+		{"格式不支持", &ipp.StatusError{Code: 0x040A}, deliverRejected},
+		{"访问控制", &ipp.HTTPError{StatusCode: 403, Status: "403 Forbidden"}, deliverRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(tt.err); got != tt.want {
+				t.Errorf("classify(%v) = %d, 期望 %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueFailureDoesNotBlock(t *testing.T) {
+	fake := &fakeDeliver{errs: map[string]error{
+		"rejected": &ipp.StatusError{Code: ipp.StatusNotFound, Message: "The printer or class does not exist."},
+		"busy":     &ipp.StatusError{Code: 0x0500, Message: "Internal error"},
+	}}
+	q, done := newTestQueue(t, fake.deliver, "rejected", "busy", "ok")
+	q.process()
+
+	if got := fmt.Sprint(fake.sent); got != "[rejected busy ok]" {
+		t.Errorf("发送顺序 %s", got)
+	}
+	if done["rejected"].Status != StatusFailed {
+		t.Errorf("被拒绝的任务 %+v", done["rejected"])
+	}
+	if done["ok"].Status != StatusPrinted {
+		t.Errorf("后面的任务 %+v", done["ok"])
+	}
+
+	// 服务端错误的任务留在队列中单独退避，再处理一次也不会立即重发
+	job, ok := q.Get("01")
+	if !ok || job.Attempts != 1 || job.NextAttempt.IsZero() {
+		t.Fatalf("服务端错误的任务 %+v", job)
+	}
+	q.process()
+	if len(fake.sent) != 3 {
+		t.Errorf("退避期间重发了任务: %v", fake.sent)
+	}
+	if q.Len() != 1 {
+		t.Errorf("队列中有 %d 个任务", q.Len())
+	}
+}
+
+func TestQueueUnavailableKeepsOrder(t *testing.T) {
+	fake := &fakeDeliver{errs: map[string]error{
+		"first": &ipp.StatusError{Code: ipp.StatusNotAcceptingJobs, Message: "Destination \"HPRT_TP80B\" is not accepting jobs."},
+	}}
+	q, _ := newTestQueue(t, fake.deliver, "first", "second")
+	q.process()
+
+	// 队列停止接收时停止本轮，后面的小票不会先打出
+	if got := fmt.Sprint(fake.sent); got != "[first]" {
+		t.Errorf("发送顺序 %s", got)
+	}
+	if q.Pending() != 2 {
+		t.Errorf("队列中有 %d 个等待的任务", q.Pending())
+	}
+}
+
+func TestQueueCancelWhileDelivering(t *testing.T) {
+	fake := &fakeDeliver{block: make(chan struct{}), inside: make(chan struct{})}
+	q, done := newTestQueue(t, fake.deliver, "slow")
+
+	finished := make(chan struct{})
+	go func() {
+		q.process()
+		close(finished)
+	}()
+	<-fake.inside
+
+	if err := q.Cancel("00"); err == nil {
+		t.Error("正在发送的任务不应能取消")
+	}
+	close(fake.block)
+	<-finished
+
+	if done["slow"].Status != StatusPrinted {
+		t.Errorf("任务 %+v", done["slow"])
+	}
+	if err := q.Cancel("00"); err == nil {
+		t.Error("已打印的任务不应还在队列中")
+	}
+}
@@ -0,0 +1,73 @@
+package printapi
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"macos-clodop-schoolpal/escpos"
+	"macos-clodop-schoolpal/layout"
+)
+
+// 请求限制
+const (
+	maxBodySize = 256 * 1024
+	maxLines    = 200
+	maxTextLen  = 2000
+)
+
+// cutFeed 切纸前的走纸长度(毫米)。切刀在打印头上方，先走纸可以避免切刀切到最后一行
+const cutFeed = 10
+
+// Receipt 打印接口接收的小票
+type Receipt struct {
+	Title   string        `json:"title"`
+	Printer string        `json:"printer"` // 可选，本机CUPS队列名，覆盖配置的打印机
+	Paper   string        `json:"paper"`   // 可选，覆盖按型号选择的纸张
+	Lines   []layout.Item `json:"lines"`
+	Cut     bool          `json:"cut"`
+}
+
+// Validate 检查小票内容，未指定类型的行按文本处理
+func (r *Receipt) Validate() error {
+	if r.Title == "" {
+		return fmt.Errorf("title不能为空")
+	}
+	if len(r.Lines) == 0 {
+		return fmt.Errorf("lines不能为空")
+	}
+	if len(r.Lines) > maxLines {
+		return fmt.Errorf("lines最多%d行", maxLines)
+	}
+
+	for i := range r.Lines {
+		if r.Lines[i].Type == "" {
+			r.Lines[i].Type = layout.ItemText
+		}
+		if utf8.RuneCountInString(r.Lines[i].Text) > maxTextLen {
+			return fmt.Errorf("第%d行超过%d个字符", i+1, maxTextLen)
+		}
+	}
+
+	return r.Template().Validate()
+}
+
+// Template 转换为小票模板
+func (r *Receipt) Template() *layout.Template {
+	tpl := &layout.Template{Title: r.Title, Items: r.Lines}
+	if r.Cut {
+		tpl.Items = append(append([]layout.Item(nil), r.Lines...), layout.Item{Type: layout.ItemFeed, Height: cutFeed})
+	}
+	return tpl
+}
+
+// Render 渲染为ESC/POS指令，需要切纸时在走纸后半切
+func (r *Receipt) Render(profile layout.PaperProfile) ([]byte, error) {
+	data, err := r.Template().RenderESCPOS(profile, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.Cut {
+		data = append(data, escpos.NewEncoder().Cut(true).Bytes()...)
+	}
+	return data, nil
+}
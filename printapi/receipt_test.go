@@ -0,0 +1,41 @@
+package printapi
+
+import (
+	"bytes"
+	"testing"
+
+	"macos-clodop-schoolpal/layout"
+)
+
+func TestReceiptNotExpanded(t *testing.T) {
+	receipt := Receipt{
+		Title: "订单 $100",
+		Lines: []layout.Item{
+			{Text: "Total: $12.50"},
+			{Text: "${title}"},
+			{Type: layout.ItemBarcode, Text: "A$1B"},
+		},
+		Cut: true,
+	}
+	if err := receipt.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := layout.Profile("80mm", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := receipt.Render(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Total: $12.50\n", "${title}\n", "{BA$1B"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("指令中没有 %q", want)
+		}
+	}
+	// 切纸前先走纸
+	if !bytes.HasSuffix(data, []byte{0x1B, 0x64, 3, 0x1B, 0x61, 0x00, 0x1B, 0x40, 0x1D, 0x56, 66, 0}) {
+		t.Errorf("结尾 % X", data[len(data)-12:])
+	}
+}
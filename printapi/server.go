@@ -0,0 +1,388 @@
+// Package printapi 提供仅限本机访问的打印接口，让其他应用不经过浏览器就能打印小票。
+//
+//	POST /v1/print      提交小票，返回任务ID和状态
+//	GET  /v1/jobs/{id}  查询任务状态
+//	GET  /v1/printer    查询打印机状态（缺纸、开盖、离线）
+//
+// 所有请求都需要 Authorization: Bearer <token>。
+// 小票渲染为ESC/POS指令，以原始格式提交到本机CUPS队列，配置了 printer.raw_address 时经TCP 9100发送，
+// 不经过Clodop。打印机不可用时任务写入磁盘队列并返回202，恢复后按提交顺序补打。
+package printapi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"macos-clodop-schoolpal/config"
+	"macos-clodop-schoolpal/history"
+	"macos-clodop-schoolpal/layout"
+	"macos-clodop-schoolpal/printerstatus"
+	"macos-clodop-schoolpal/utils"
+)
+
+// 任务状态
+const (
+	StatusPrinted  = "printed"
+	StatusFailed   = "failed"
+	StatusQueued   = "queued"
+	StatusExpired  = "expired"
+	StatusCanceled = "canceled"
+)
+
+// maxJobs 内存中保留的任务数
+const maxJobs = 500
+
+// JobStatus 任务状态
+type JobStatus struct {
+	ID         string    `json:"id"`
+	Title      string    `json:"title,omitempty"`
+	Status     string    `json:"status"`
+	Printer    string    `json:"printer,omitempty"`
+	PrintJobID string    `json:"print_job_id,omitempty"` // CUPS任务ID，经TCP发送时为空
+	Error      string    `json:"error,omitempty"`
+	Attempts   int       `json:"attempts,omitempty"`
+	Size       int       `json:"size,omitempty"` // 指令字节数
+	Created    time.Time `json:"created"`
+}
+
+// SendFunc 发送ESC/POS指令，返回任务ID
+type SendFunc func(ctx context.Context, title string, data []byte) (string, error)
+
+// TargetFunc 返回小票的发送目标和发送函数，printer为小票指定的CUPS队列，空表示使用配置。
+// 没有可用目标时返回错误，例如配置尚未完成，此时任务进入队列等待
+type TargetFunc func(printer string) (string, SendFunc, error)
+
+// PrinterStatusFunc 返回最近一次检查的打印机状态，尚未检查时返回nil
+type PrinterStatusFunc func() *printerstatus.Status
+
+// Server 本地打印接口
+type Server struct {
+	cfg     *config.Config
+	target  TargetFunc
+	printer PrinterStatusFunc
+	server  *http.Server
+	queue   *Queue
+
+	mu    sync.Mutex
+	jobs  map[string]*JobStatus
+	order []string
+}
+
+// NewServer 创建打印接口，printer可以为nil，此时不提供打印机状态
+func NewServer(cfg *config.Config, target TargetFunc, printer PrinterStatusFunc) *Server {
+	return &Server{
+		cfg:     cfg,
+		target:  target,
+		printer: printer,
+		jobs:    make(map[string]*JobStatus),
+	}
+}
+
+// Start 在配置的回环地址上启动接口
+func (s *Server) Start() error {
+	if s.cfg.PrintAPI.Token == "" {
+		return fmt.Errorf("未配置print_api.token，打印接口不启动")
+	}
+
+	listen := s.cfg.PrintAPI.Listen
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return fmt.Errorf("打印接口监听地址无效 %s: %v", listen, err)
+	}
+	if !isLoopbackHost(host) {
+		return fmt.Errorf("打印接口只能监听本机回环地址，当前为: %s", listen)
+	}
+
+	dir, err := utils.GetDataDir("queue")
+	if err != nil {
+		return fmt.Errorf("无法创建打印队列目录: %v", err)
+	}
+	s.queue, err = OpenQueue(dir, s.cfg.PrintAPI.QueueExpiry, s.cfg.PrintAPI.RetryMaxInterval, s.deliver, s.recordResult)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("无法监听 %s: %v", listen, err)
+	}
+
+	s.queue.Start()
+
+	s.server = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go s.server.Serve(listener)
+	return nil
+}
+
+// Queue 返回磁盘队列，接口未启动时为nil
+func (s *Server) Queue() *Queue {
+	return s.queue
+}
+
+// Close 停止接口
+func (s *Server) Close() {
+	if s.server == nil {
+		return
+	}
+	s.queue.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	s.server.Shutdown(ctx)
+}
+
+// Handler 打印接口的路由，包含鉴权
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/print", s.handlePrint)
+	mux.HandleFunc("/v1/jobs/", s.handleJob)
+	mux.HandleFunc("/v1/printer", s.handlePrinter)
+	return s.authorize(mux)
+}
+
+// authorize 只接受来自本机且带正确token的请求
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil || !isLoopbackHost(host) {
+			writeError(w, http.StatusForbidden, "只允许本机访问")
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.PrintAPI.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "token无效")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handlePrint 渲染并提交一张小票
+func (s *Server) handlePrint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "只支持POST")
+		return
+	}
+
+	var receipt Receipt
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&receipt); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("无法解析小票: %v", err))
+		return
+	}
+	if err := receipt.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	profile, err := s.paperProfile(receipt.Paper)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 外部提交的内容原样打印，不做 ${变量} 替换，金额和条码中的 $ 不受影响
+	data, err := receipt.Render(profile)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("无法生成ESC/POS指令: %v", err))
+		return
+	}
+	queued := &QueuedJob{
+		ID:      newJobID(),
+		Title:   receipt.Title,
+		Printer: receipt.Printer,
+		Data:    data,
+		Created: time.Now(),
+	}
+
+	// 队列中还有等待的任务时直接排在后面，避免新小票先于旧小票打出
+	if s.queue.Pending() == 0 {
+		printer, printJobID, err := s.deliver(r.Context(), receipt.Title, data, receipt.Printer)
+		switch classify(err) {
+		case deliverOK:
+			status := queued.status(StatusPrinted, "")
+			status.Printer = printer
+			status.PrintJobID = printJobID
+			s.record(status)
+			writeJSON(w, http.StatusOK, status)
+			return
+		case deliverRejected:
+			// 队列不存在、任务被拒绝等，重试也不会成功，不进入队列
+			queued.Attempts = 1
+			status := queued.status(StatusFailed, err.Error())
+			if printer != "" {
+				status.Printer = printer
+			}
+			s.record(status)
+			writeJSON(w, http.StatusUnprocessableEntity, status)
+			return
+		}
+		queued.Attempts = 1
+		queued.LastError = err.Error()
+	}
+
+	if err := s.queue.Add(queued); err != nil {
+		status := queued.status(StatusFailed, err.Error())
+		s.record(status)
+		writeJSON(w, http.StatusBadGateway, status)
+		return
+	}
+	s.queue.Kick()
+	status := queued.status(StatusQueued, queued.LastError)
+	s.record(status)
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// handleJob 查询任务状态
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "只支持GET")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/jobs/")
+	if job, ok := s.queue.Get(id); ok {
+		state := StatusQueued
+		if job.State == QueueExpired {
+			state = StatusExpired
+		}
+		writeJSON(w, http.StatusOK, job.status(state, job.LastError))
+		return
+	}
+
+	s.mu.Lock()
+	status, ok := s.jobs[id]
+	var copied JobStatus
+	if ok {
+		copied = *status
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "任务不存在")
+		return
+	}
+	writeJSON(w, http.StatusOK, copied)
+}
+
+// handlePrinter 查询打印机状态
+func (s *Server) handlePrinter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "只支持GET")
+		return
+	}
+
+	var status *printerstatus.Status
+	if s.printer != nil {
+		status = s.printer()
+	}
+	if status == nil {
+		writeError(w, http.StatusServiceUnavailable, "打印机状态监控未启动")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// paperProfile 小票指定纸张时使用该纸张，否则按打印机型号选择
+func (s *Server) paperProfile(name string) (layout.PaperProfile, error) {
+	if name != "" {
+		return layout.Profile(name, s.cfg.Paper.Profiles)
+	}
+	return s.cfg.PaperProfile()
+}
+
+// deliver 把ESC/POS指令发给打印机，返回实际使用的目标和任务ID
+func (s *Server) deliver(ctx context.Context, title string, data []byte, printer string) (string, string, error) {
+	target, send, err := s.target(printer)
+	if err != nil {
+		return printer, "", &unavailableError{err: err}
+	}
+	jobID, err := send(ctx, title, data)
+	return target, jobID, err
+}
+
+// record 保存新任务的状态并写入打印记录
+func (s *Server) record(status JobStatus) {
+	s.remember(status)
+	history.Add(historyRecord(status))
+}
+
+// recordResult 队列中的任务有了结果，更新提交时写入的那条打印记录，每个任务只保留一条
+func (s *Server) recordResult(status JobStatus) {
+	s.remember(status)
+	history.Update(historyRecord(status))
+}
+
+// remember 保存任务状态，超出上限时丢弃最早的任务
+func (s *Server) remember(status JobStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[status.ID]; !ok {
+		s.order = append(s.order, status.ID)
+	}
+	s.jobs[status.ID] = &status
+	if len(s.order) > maxJobs {
+		delete(s.jobs, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// historyRecord 转换为打印记录，时间取任务的提交时间
+func historyRecord(status JobStatus) history.Record {
+	return history.Record{
+		Time:      status.Created,
+		Source:    history.SourceAPI,
+		JobID:     status.ID,
+		Title:     status.Title,
+		Printer:   status.Printer,
+		Size:      status.Size,
+		Result:    status.Status,
+		Error:     status.Error,
+		LatencyMS: time.Since(status.Created).Milliseconds(),
+	}
+}
+
+// isLoopbackHost 判断是否为本机回环地址
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// newJobID 生成任务ID
+func newJobID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// writeJSON 输出JSON应答
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 输出错误应答
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
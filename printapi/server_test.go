@@ -0,0 +1,200 @@
+package printapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"macos-clodop-schoolpal/config"
+	"macos-clodop-schoolpal/history"
+	"macos-clodop-schoolpal/ipp"
+	"macos-clodop-schoolpal/ipp/stub"
+)
+
+const testToken = "secret"
+
+// newTestServer 创建打印接口，队列放在临时目录，不启动监听和后台重试
+func newTestServer(t *testing.T, target TargetFunc) *Server {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.PrintAPI.Token = testToken
+	cfg.Paper.Profile = "80mm"
+
+	s := NewServer(cfg, target, nil)
+	queue, err := OpenQueue(t.TempDir(), time.Hour, time.Minute, s.deliver, s.recordResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.queue = queue
+	return s
+}
+
+// startCUPS 启动模拟CUPS服务，返回以原始格式提交到其中队列的发送目标，未指定队列时使用HPRT_TP80B
+func startCUPS(t *testing.T, printers ...ipp.Printer) (*stub.Server, TargetFunc) {
+	t.Helper()
+	server := stub.NewServer(printers)
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+
+	client := ipp.NewClient(server.URL())
+	return server, func(printer string) (string, SendFunc, error) {
+		if printer == "" {
+			printer = "HPRT_TP80B"
+		}
+		return "CUPS队列 " + printer, func(ctx context.Context, title string, data []byte) (string, error) {
+			id, err := client.PrintJob(ctx, printer, title, "application/vnd.cups-raw", data)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s-%d", printer, id), nil
+		}, nil
+	}
+}
+
+var testPrinter = ipp.Printer{Name: "HPRT_TP80B", State: ipp.PrinterIdle, AcceptingJobs: true}
+
+// postReceipt 以本机地址和token提交小票
+func postReceipt(t *testing.T, s *Server, body string) (int, JobStatus) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/print", strings.NewReader(body))
+	req.RemoteAddr = "127.0.0.1:50000"
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+
+	var status JobStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("无法解析应答 %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, status
+}
+
+func TestPrintToCUPS(t *testing.T) {
+	cups, target := startCUPS(t, testPrinter)
+	s := newTestServer(t, target)
+
+	code, status := postReceipt(t, s, `{"title":"订单 $100","lines":[{"text":"Total: $12.50"},{"type":"barcode","text":"A$1B"}],"cut":true}`)
+	if code != http.StatusOK || status.Status != StatusPrinted {
+		t.Fatalf("应答 %d %+v", code, status)
+	}
+	if status.Printer != "CUPS队列 HPRT_TP80B" || status.PrintJobID != "HPRT_TP80B-1" {
+		t.Errorf("打印机 %q 任务ID %q", status.Printer, status.PrintJobID)
+	}
+
+	// CUPS收到的是原样的ESC/POS指令
+	requests := cups.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("模拟CUPS收到 %d 个请求", len(requests))
+	}
+	op := requests[0].Group(ipp.TagOperation)
+	if format := op.String("document-format"); format != "application/vnd.cups-raw" {
+		t.Errorf("document-format = %q", format)
+	}
+	if name := op.String("job-name"); name != "订单 $100" {
+		t.Errorf("job-name = %q", name)
+	}
+	doc := cups.Document(1)
+	for _, want := range []string{"Total: $12.50\n", "{BA$1B"} {
+		if !bytes.Contains(doc, []byte(want)) {
+			t.Errorf("指令中没有 %q", want)
+		}
+	}
+	if len(doc) != status.Size {
+		t.Errorf("收到 %d 字节，状态中为 %d", len(doc), status.Size)
+	}
+}
+
+func TestPrintUnauthorized(t *testing.T) {
+	_, target := startCUPS(t, testPrinter)
+	s := newTestServer(t, target)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/print", strings.NewReader(`{}`))
+	req.RemoteAddr = "127.0.0.1:50000"
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("没有token时返回 %d", rec.Code)
+	}
+}
+
+func TestPrintRejectedNotQueued(t *testing.T) {
+	_, target := startCUPS(t, testPrinter)
+	s := newTestServer(t, target)
+
+	code, status := postReceipt(t, s, `{"title":"小票","printer":"不存在的队列","lines":[{"text":"x"}]}`)
+	if code != http.StatusUnprocessableEntity || status.Status != StatusFailed {
+		t.Fatalf("应答 %d %+v", code, status)
+	}
+	if n := s.queue.Len(); n != 0 {
+		t.Errorf("被拒绝的小票不应进入队列，队列中有 %d 个任务", n)
+	}
+}
+
+func TestPrintRenderError(t *testing.T) {
+	_, target := startCUPS(t, testPrinter)
+	s := newTestServer(t, target)
+
+	code, _ := postReceipt(t, s, `{"title":"小票","lines":[{"type":"barcode","text":"123","symbology":"PDF417"}]}`)
+	if code != http.StatusBadRequest {
+		t.Errorf("无法生成指令时返回 %d", code)
+	}
+}
+
+func TestPrintUnavailableQueued(t *testing.T) {
+	s := newTestServer(t, func(string) (string, SendFunc, error) {
+		return "", nil, errors.New("CUPS中没有打印队列")
+	})
+
+	code, status := postReceipt(t, s, `{"title":"小票","lines":[{"text":"x"}]}`)
+	if code != http.StatusAccepted || status.Status != StatusQueued {
+		t.Fatalf("应答 %d %+v", code, status)
+	}
+	if n := s.queue.Pending(); n != 1 {
+		t.Errorf("队列中有 %d 个任务", n)
+	}
+}
+
+func TestQueuedJobRecordedOnce(t *testing.T) {
+	store, err := history.Open(t.TempDir()+"/history.jsonl", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history.SetDefault(store)
+	t.Cleanup(func() { history.SetDefault(nil) })
+
+	_, cups := startCUPS(t, testPrinter)
+	available := false
+	s := newTestServer(t, func(printer string) (string, SendFunc, error) {
+		if !available {
+			return "", nil, errors.New("CUPS中没有打印队列")
+		}
+		return cups(printer)
+	})
+
+	code, status := postReceipt(t, s, `{"title":"小票","lines":[{"text":"x"}]}`)
+	if code != http.StatusAccepted {
+		t.Fatalf("应答 %d %+v", code, status)
+	}
+	available = true
+	s.queue.process()
+
+	records, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("打印记录 %d 条，期望每个任务一条: %+v", len(records), records)
+	}
+	if r := records[0]; r.JobID != status.ID || r.Result != StatusPrinted || !r.Time.Equal(status.Created) {
+		t.Errorf("打印记录 %+v，期望任务 %s 已打印，时间为提交时间", r, status.ID)
+	}
+}
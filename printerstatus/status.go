@@ -0,0 +1,167 @@
+// Package printerstatus 描述小票打印机的缺纸、纸将尽、开盖和离线状态，
+// 来源为CUPS队列的 printer-state-reasons 或ESC/POS实时状态。
+package printerstatus
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"macos-clodop-schoolpal/escpos"
+)
+
+// Condition 需要店员处理的状况
+type Condition string
+
+const (
+	PaperOut  Condition = "paper_out"
+	CoverOpen Condition = "cover_open"
+	Offline   Condition = "offline"
+	PaperLow  Condition = "paper_low"
+)
+
+// 状态来源
+const (
+	SourceIPP    = "ipp"
+	SourceESCPOS = "escpos"
+)
+
+// conditionOrder 按严重程度排序
+var conditionOrder = map[Condition]int{PaperOut: 0, CoverOpen: 1, Offline: 2, PaperLow: 3}
+
+// conditionNames 显示名称
+var conditionNames = map[Condition]string{
+	PaperOut:  "缺纸",
+	CoverOpen: "打印机盖未关",
+	Offline:   "打印机离线",
+	PaperLow:  "纸将用尽",
+}
+
+// Name 显示名称
+func (c Condition) Name() string {
+	if name, ok := conditionNames[c]; ok {
+		return name
+	}
+	return string(c)
+}
+
+// Status 一次检查的结果
+type Status struct {
+	Printer    string      `json:"printer"`
+	Ready      bool        `json:"ready"`
+	Conditions []Condition `json:"conditions"`
+	Reasons    []string    `json:"reasons,omitempty"` // CUPS原始的 printer-state-reasons
+	Sources    []string    `json:"sources"`
+	Error      string      `json:"error,omitempty"` // 无法取得状态的原因
+	Note       string      `json:"note,omitempty"`  // 检测能力的限制，如只有CUPS状态时缺纸、开盖可能检测不到
+	Checked    time.Time   `json:"checked"`
+}
+
+// Add 加入状况，已有的忽略
+func (s *Status) Add(conditions ...Condition) {
+	for _, c := range conditions {
+		if !s.Has(c) {
+			s.Conditions = append(s.Conditions, c)
+		}
+	}
+}
+
+// Has 是否存在某个状况
+func (s *Status) Has(c Condition) bool {
+	for _, existing := range s.Conditions {
+		if existing == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize 按严重程度排序并计算Ready。缺纸和开盖时打印机也会报告离线，
+// 此时只保留具体原因
+func (s *Status) Normalize() {
+	if s.Has(PaperOut) || s.Has(CoverOpen) {
+		kept := s.Conditions[:0]
+		for _, c := range s.Conditions {
+			if c != Offline {
+				kept = append(kept, c)
+			}
+		}
+		s.Conditions = kept
+	}
+	if s.Has(PaperOut) {
+		kept := s.Conditions[:0]
+		for _, c := range s.Conditions {
+			if c != PaperLow {
+				kept = append(kept, c)
+			}
+		}
+		s.Conditions = kept
+	}
+	sort.SliceStable(s.Conditions, func(i, j int) bool {
+		return conditionOrder[s.Conditions[i]] < conditionOrder[s.Conditions[j]]
+	})
+	if s.Conditions == nil {
+		s.Conditions = []Condition{}
+	}
+	s.Ready = len(s.Conditions) == 0 && s.Error == ""
+}
+
+// String 便于日志和界面显示，如 "缺纸、打印机盖未关"
+func (s *Status) String() string {
+	if s.Error != "" {
+		return "状态未知: " + s.Error
+	}
+	if len(s.Conditions) == 0 {
+		return "正常"
+	}
+	names := make([]string, len(s.Conditions))
+	for i, c := range s.Conditions {
+		names[i] = c.Name()
+	}
+	return strings.Join(names, "、")
+}
+
+// Key 用于判断状态是否变化
+func (s *Status) Key() string {
+	return s.String()
+}
+
+// FromStateReasons 把CUPS的 printer-state-reasons 转换为状况，
+// 关键字可能带 -error、-warning、-report 后缀
+func FromStateReasons(reasons []string) []Condition {
+	var conditions []Condition
+	for _, reason := range reasons {
+		keyword := reason
+		for _, suffix := range []string{"-error", "-warning", "-report"} {
+			keyword = strings.TrimSuffix(keyword, suffix)
+		}
+		switch keyword {
+		case "media-empty", "media-needed", "marker-supply-empty":
+			conditions = append(conditions, PaperOut)
+		case "media-low", "marker-supply-low":
+			conditions = append(conditions, PaperLow)
+		case "cover-open", "door-open", "interlock-open":
+			conditions = append(conditions, CoverOpen)
+		case "offline", "shutdown":
+			conditions = append(conditions, Offline)
+		}
+	}
+	return conditions
+}
+
+// FromRealtime 把ESC/POS实时状态转换为状况
+func FromRealtime(rt *escpos.RealtimeStatus) []Condition {
+	var conditions []Condition
+	if rt.PaperOut {
+		conditions = append(conditions, PaperOut)
+	} else if rt.PaperNearEnd {
+		conditions = append(conditions, PaperLow)
+	}
+	if rt.CoverOpen {
+		conditions = append(conditions, CoverOpen)
+	}
+	if rt.Offline {
+		conditions = append(conditions, Offline)
+	}
+	return conditions
+}
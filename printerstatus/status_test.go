@@ -0,0 +1,74 @@
+package printerstatus
+
+import (
+	"reflect"
+	"testing"
+
+	"macos-clodop-schoolpal/escpos"
+)
+
+func TestFromStateReasons(t *testing.T) {
+	tests := []struct {
+		name    string
+		reasons []string
+		want    []Condition
+	}{
+		{"无", []string{"none"}, nil},
+		{"缺纸-error", []string{"media-empty-error"}, []Condition{PaperOut}},
+		{"缺纸-warning", []string{"media-needed-warning"}, []Condition{PaperOut}},
+		{"缺纸-report", []string{"marker-supply-empty-report"}, []Condition{PaperOut}},
+		{"纸将尽-error", []string{"media-low-error"}, []Condition{PaperLow}},
+		{"纸将尽-warning", []string{"media-low-warning"}, []Condition{PaperLow}},
+		{"纸将尽-report", []string{"marker-supply-low-report"}, []Condition{PaperLow}},
+		{"开盖-error", []string{"cover-open-error"}, []Condition{CoverOpen}},
+		{"开门-warning", []string{"door-open-warning"}, []Condition{CoverOpen}},
+		{"联锁-report", []string{"interlock-open-report"}, []Condition{CoverOpen}},
+		{"离线-error", []string{"offline-error"}, []Condition{Offline}},
+		{"离线-report", []string{"offline-report"}, []Condition{Offline}},
+		{"关机-warning", []string{"shutdown-warning"}, []Condition{Offline}},
+		{"无后缀", []string{"media-empty", "cover-open"}, []Condition{PaperOut, CoverOpen}},
+		{"未知原因", []string{"toner-low-warning", "paused"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromStateReasons(tt.reasons); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromStateReasons(%v) = %v，期望 %v", tt.reasons, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromRealtime(t *testing.T) {
+	tests := []struct {
+		name string
+		rt   escpos.RealtimeStatus
+		want []Condition
+	}{
+		{"正常", escpos.RealtimeStatus{}, nil},
+		{"缺纸", escpos.RealtimeStatus{PaperOut: true}, []Condition{PaperOut}},
+		{"纸将尽", escpos.RealtimeStatus{PaperNearEnd: true}, []Condition{PaperLow}},
+		{"缺纸时不报纸将尽", escpos.RealtimeStatus{PaperOut: true, PaperNearEnd: true}, []Condition{PaperOut}},
+		{"开盖", escpos.RealtimeStatus{CoverOpen: true}, []Condition{CoverOpen}},
+		{"离线", escpos.RealtimeStatus{Offline: true}, []Condition{Offline}},
+		{"开盖且离线", escpos.RealtimeStatus{CoverOpen: true, Offline: true}, []Condition{CoverOpen, Offline}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromRealtime(&tt.rt); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromRealtime(%+v) = %v，期望 %v", tt.rt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	s := &Status{}
+	s.Add(Offline, PaperLow, CoverOpen, PaperOut, PaperOut)
+	s.Normalize()
+	if want := []Condition{PaperOut, CoverOpen}; !reflect.DeepEqual(s.Conditions, want) {
+		t.Errorf("状况 %v，期望 %v", s.Conditions, want)
+	}
+	if s.Ready || s.String() != "缺纸、打印机盖未关" {
+		t.Errorf("Ready=%v %q", s.Ready, s.String())
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"macos-clodop-schoolpal/printapi"
+)
+
+// watchQueue 在按钮上持续显示队列中的任务数
+func watchQueue(button *widget.Button, queue *printapi.Queue) {
+	for {
+		button.SetText(fmt.Sprintf("打印队列 (%d)", queue.Len()))
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// showQueueWindow 显示等待补打的小票，可以取消或立即重试
+func showQueueWindow(queue *printapi.Queue, addLog func(string)) {
+	window := fyne.CurrentApp().NewWindow("打印队列")
+	window.Resize(fyne.NewSize(560, 360))
+
+	var jobs []printapi.QueuedJob
+	summary := widget.NewLabel("")
+
+	list := widget.NewList(
+		func() int {
+			return len(jobs)
+		},
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Wrapping = fyne.TextWrapWord
+			buttons := container.NewHBox(widget.NewButton("重试", nil), widget.NewButton("取消", nil))
+			return container.NewBorder(nil, nil, nil, buttons, label)
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			if id >= len(jobs) {
+				return
+			}
+			job := jobs[id]
+			row := item.(*fyne.Container)
+			label := row.Objects[0].(*widget.Label)
+			buttons := row.Objects[1].(*fyne.Container)
+
+			state := "等待重试"
+			if job.State == printapi.QueueExpired {
+				state = "❌ 已过期"
+			}
+			text := fmt.Sprintf("%s  %s\n%s · 已尝试%d次", job.Created.Format("01-02 15:04:05"), job.Title, state, job.Attempts)
+			if job.LastError != "" {
+				text += " · " + job.LastError
+			}
+			label.SetText(text)
+
+			buttons.Objects[0].(*widget.Button).OnTapped = func() {
+				if err := queue.Retry(job.ID); err != nil {
+					addLog(fmt.Sprintf("❌ 重试小票失败: %v", err))
+					return
+				}
+				addLog(fmt.Sprintf("🔁 已重新提交小票: %s", job.Title))
+			}
+			buttons.Objects[1].(*widget.Button).OnTapped = func() {
+				if err := queue.Cancel(job.ID); err != nil {
+					addLog(fmt.Sprintf("❌ 取消小票失败: %v", err))
+					return
+				}
+				addLog(fmt.Sprintf("🗑️ 已取消小票: %s", job.Title))
+			}
+		},
+	)
+
+	refresh := func() {
+		jobs = queue.List()
+		summary.SetText(fmt.Sprintf("共 %d 张小票等待打印，远程恢复后按提交顺序自动补打", len(jobs)))
+		list.Refresh()
+	}
+	refresh()
+
+	done := make(chan struct{})
+	window.SetOnClosed(func() { close(done) })
+	go func() {
+		ticker := time.NewTicker(2 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				refresh()
+			}
+		}
+	}()
+
+	window.SetContent(container.NewBorder(summary, nil, nil, nil, list))
+	window.Show()
+}
@@ -0,0 +1,46 @@
+package steps
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runAsAdmin 通过osascript以管理员权限执行一组命令，每条命令为参数列表，
+// 参数会被正确转义，可以包含空格和引号
+func runAsAdmin(commands ...[]string) ([]byte, error) {
+	lines := make([]string, 0, len(commands))
+	for _, args := range commands {
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = shellQuote(arg)
+		}
+		lines = append(lines, strings.Join(quoted, " "))
+	}
+
+	script := fmt.Sprintf(`do shell script "%s" with administrator privileges`, appleScriptEscape(strings.Join(lines, " && ")))
+	output, err := exec.Command("osascript", "-e", script).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(output), "User canceled") {
+			return output, fmt.Errorf("用户取消了权限授权")
+		}
+		return output, fmt.Errorf("%v\n输出: %s", err, strings.TrimSpace(string(output)))
+	}
+	return output, nil
+}
+
+// shellQuote 用单引号包裹参数
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r == '-' || r == '_' || r == '.' || r == '/' || r == '=' || r == ':' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// appleScriptEscape 转义AppleScript字符串中的反斜杠和双引号
+func appleScriptEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,52 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"macos-clodop-schoolpal/clodop"
+	"macos-clodop-schoolpal/config"
+)
+
+// checkClodopCompat 对照兼容表检查远程C-Lodop版本，并选出测试页写法。
+// 版本问题只产生警告，版本未知时返回nil，由测试页依次尝试所有写法。
+func checkClodopCompat(cfg *config.Config, endpoint *ClodopEndpoint) *config.ClodopFlavour {
+	compat := cfg.Clodop.Compat
+
+	version := endpoint.Version
+	if version == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if v, err := clodop.NewClient(endpoint.BaseURL()).Version(ctx); err == nil {
+			version = v
+			endpoint.Version = v
+		}
+	}
+
+	if version == "" {
+		addWarning("无法识别远程C-Lodop的版本，测试页将依次尝试各种写法")
+		return nil
+	}
+	fmt.Printf("📦 远程C-Lodop版本: %s\n", version)
+
+	for _, bad := range compat.BadVersions {
+		if clodop.CompareVersions(version, bad) == 0 {
+			addWarning("远程电脑上的C-Lodop %s 是已知有问题的版本，请升级到最新版", version)
+			break
+		}
+	}
+
+	if compat.MinVersion != "" && clodop.CompareVersions(version, compat.MinVersion) < 0 {
+		addWarning("远程电脑上的C-Lodop %s 低于最低要求 %s，请升级", version, compat.MinVersion)
+	}
+
+	for i := range compat.Flavours {
+		flavour := &compat.Flavours[i]
+		if clodop.CompareVersions(version, flavour.Since) >= 0 {
+			fmt.Printf("🧩 测试页写法: %s, priority=%v\n", flavour.Getter, flavour.Priority)
+			return flavour
+		}
+	}
+	return nil
+}
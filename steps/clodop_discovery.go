@@ -0,0 +1,217 @@
+package steps
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"macos-clodop-schoolpal/clodop"
+	"macos-clodop-schoolpal/config"
+)
+
+// ClodopEndpoint 发现的Clodop服务地址
+type ClodopEndpoint struct {
+	Scheme  string
+	Port    int
+	Path    string
+	Version string
+	Latency time.Duration
+}
+
+// BaseURL 服务根地址，如 https://localhost:8443
+func (e *ClodopEndpoint) BaseURL() string {
+	return fmt.Sprintf("%s://localhost:%d", e.Scheme, e.Port)
+}
+
+// String 便于日志和状态显示
+func (e *ClodopEndpoint) String() string {
+	version := e.Version
+	if version == "" {
+		version = "未知"
+	}
+	return fmt.Sprintf("%s%s (版本 %s, 延迟 %dms)", e.BaseURL(), e.Path, version, e.Latency.Milliseconds())
+}
+
+// clodopCandidate 一个待探测的地址
+type clodopCandidate struct {
+	scheme string
+	port   int
+	path   string
+}
+
+// probeResult 单个候选地址的探测结果
+type probeResult struct {
+	index    int
+	endpoint *ClodopEndpoint
+}
+
+// GetClodopEndpoint 返回缓存的Clodop服务地址，没有缓存时重新探测
+func GetClodopEndpoint(cfg *config.Config) (*ClodopEndpoint, error) {
+	if endpoint := CachedClodopEndpoint(); endpoint != nil {
+		return endpoint, nil
+	}
+	return DiscoverClodop(cfg)
+}
+
+// DiscoverClodop 在共同的超时时间内并发探测所有候选端口和路径。
+// 多个地址可用时按配置顺序取最靠前的一个，结果缓存到运行状态中。
+func DiscoverClodop(cfg *config.Config) (*ClodopEndpoint, error) {
+	candidates := clodopCandidates(cfg)
+	fmt.Printf("🔍 并发探测 %d 个Clodop候选地址 (超时 %v)...\n", len(candidates), cfg.Clodop.DiscoveryTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Clodop.DiscoveryTimeout)
+	defer cancel()
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+
+	results := make(chan probeResult, len(candidates))
+	for i, candidate := range candidates {
+		go func(i int, candidate clodopCandidate) {
+			results <- probeResult{index: i, endpoint: probeClodop(ctx, client, candidate)}
+		}(i, candidate)
+	}
+
+	// 一旦某个成功地址之前的候选都已有结果，就不必再等其余探测
+	found := make([]*ClodopEndpoint, len(candidates))
+	done := make([]bool, len(candidates))
+	for received := 0; received < len(candidates); received++ {
+		result := <-results
+		done[result.index] = true
+		found[result.index] = result.endpoint
+
+		if endpoint := firstSettled(found, done); endpoint != nil {
+			fmt.Printf("✅ 发现Clodop服务: %s\n", endpoint)
+			if err := checkDiscoveredIntegrity(cfg, endpoint); err != nil {
+				setClodopEndpoint(nil)
+				return nil, err
+			}
+			setClodopEndpoint(endpoint)
+			return endpoint, nil
+		}
+	}
+
+	setClodopEndpoint(nil)
+
+	ports := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		port := strconv.Itoa(candidate.port)
+		if len(ports) == 0 || ports[len(ports)-1] != port {
+			ports = append(ports, port)
+		}
+	}
+	return nil, fmt.Errorf("未找到可用的Clodop服务，尝试了端口: %s", strings.Join(ports, ", "))
+}
+
+// checkDiscoveredIntegrity 校验新发现服务的指纹，只有与固定指纹不符才视为失败
+func checkDiscoveredIntegrity(cfg *config.Config, endpoint *ClodopEndpoint) error {
+	if len(cfg.Clodop.Pin.CertSHA256) > 0 && endpoint.Scheme != "https" {
+		addWarning("已配置证书指纹，但Clodop服务 %s 未使用HTTPS，无法校验证书", endpoint.BaseURL())
+	}
+
+	err := verifyClodopIntegrity(cfg, endpoint)
+	var tampered *clodop.IntegrityError
+	if errors.As(err, &tampered) {
+		fmt.Printf("🚨 %v\n", err)
+		return err
+	}
+	var changed *clodop.ChangedError
+	if errors.As(err, &changed) {
+		addWarning("%v", err)
+	} else if err != nil {
+		fmt.Printf("⚠️ 无法校验Clodop指纹: %v\n", err)
+	}
+	return nil
+}
+
+// firstSettled 返回按顺序第一个成功、且之前候选都已结束的地址
+func firstSettled(found []*ClodopEndpoint, done []bool) *ClodopEndpoint {
+	for i := range found {
+		if !done[i] {
+			return nil
+		}
+		if found[i] != nil {
+			return found[i]
+		}
+	}
+	return nil
+}
+
+// clodopCandidates 按 端口 × 协议 × 路径 生成候选地址，本地转发端口最先
+func clodopCandidates(cfg *config.Config) []clodopCandidate {
+	var ports []int
+	seen := map[int]bool{}
+	if p, err := strconv.Atoi(cfg.Network.LocalPort); err == nil && p > 0 {
+		ports = append(ports, p)
+		seen[p] = true
+	}
+	for _, p := range cfg.Clodop.Ports {
+		if p > 0 && !seen[p] {
+			ports = append(ports, p)
+			seen[p] = true
+		}
+	}
+
+	var candidates []clodopCandidate
+	for _, port := range ports {
+		for _, scheme := range []string{"https", "http"} {
+			for _, path := range cfg.Clodop.Paths {
+				candidates = append(candidates, clodopCandidate{scheme: scheme, port: port, path: path})
+			}
+		}
+	}
+	return candidates
+}
+
+// probeClodop 请求一个候选地址，返回200且能认出是C-Lodop时识别版本并记录延迟，否则返回nil。
+// 脚本路径要求内容是Clodop脚本；其他路径(如 /c_webskt/)要求内容是Clodop脚本或Server头含有C-Lodop版本，
+// 只返回200的其他服务不算
+func probeClodop(ctx context.Context, client *http.Client, candidate clodopCandidate) *ClodopEndpoint {
+	url := fmt.Sprintf("%s://localhost:%d%s", candidate.scheme, candidate.port, candidate.path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	latency := time.Since(start)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil
+	}
+
+	endpoint := &ClodopEndpoint{
+		Scheme:  candidate.scheme,
+		Port:    candidate.port,
+		Path:    candidate.path,
+		Version: clodop.ParseServerHeader(resp.Header.Get("Server")),
+		Latency: latency,
+	}
+
+	script := isClodopScript(string(body))
+	switch {
+	case script:
+		if version := clodop.ParseVersion(string(body)); version != "" {
+			endpoint.Version = version
+		}
+	case strings.HasPrefix(candidate.path, clodop.ScriptPath), endpoint.Version == "":
+		return nil
+	}
+	return endpoint
+}
@@ -0,0 +1,147 @@
+package steps
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"macos-clodop-schoolpal/clodop"
+	"macos-clodop-schoolpal/clodop/mock"
+	"macos-clodop-schoolpal/config"
+)
+
+// mockClodopConfig 启动模拟C-Lodop，返回只探测其端口的配置
+func mockClodopConfig(t *testing.T, opts mock.Options) *config.Config {
+	t.Helper()
+	ts := httptest.NewServer(mock.NewServer(opts).Handler())
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() {
+		setClodopEndpoint(nil)
+		runState.Lock()
+		runState.integrity = nil
+		runState.Unlock()
+	})
+
+	_, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.Network.LocalPort = port
+	cfg.Clodop.Paths = []string{"/CLodopfuncs.js?priority=1", "/CLodopfuncs.js", "/c_webskt/"}
+	cfg.Clodop.DiscoveryTimeout = 3 * time.Second
+	return cfg
+}
+
+func TestDiscoverClodopMock(t *testing.T) {
+	opts := mock.DefaultOptions()
+	cfg := mockClodopConfig(t, opts)
+
+	endpoint, err := DiscoverClodop(cfg)
+	if err != nil {
+		t.Fatalf("DiscoverClodop() error = %v", err)
+	}
+	if endpoint.Scheme != "http" || strconv.Itoa(endpoint.Port) != cfg.Network.LocalPort {
+		t.Errorf("endpoint = %s", endpoint)
+	}
+	if endpoint.Path != "/CLodopfuncs.js?priority=1" || endpoint.Version != opts.Version {
+		t.Errorf("路径 %q 版本 %q", endpoint.Path, endpoint.Version)
+	}
+	if CachedClodopEndpoint() != endpoint {
+		t.Error("发现的地址没有缓存")
+	}
+}
+
+func TestDiscoverClodopPinMismatch(t *testing.T) {
+	cfg := mockClodopConfig(t, mock.DefaultOptions())
+	cfg.Clodop.Pin.ScriptSHA256 = []string{"00"}
+
+	_, err := DiscoverClodop(cfg)
+	var tampered *clodop.IntegrityError
+	if !errors.As(err, &tampered) {
+		t.Fatalf("DiscoverClodop() error = %v, want IntegrityError", err)
+	}
+	if CachedClodopEndpoint() != nil {
+		t.Error("指纹不符时不应缓存地址")
+	}
+}
+
+func TestDiscoverClodopFault(t *testing.T) {
+	opts := mock.DefaultOptions()
+	opts.Fault = mock.FaultError500
+	cfg := mockClodopConfig(t, opts)
+
+	if _, err := DiscoverClodop(cfg); err == nil {
+		t.Fatal("服务返回500时不应发现Clodop")
+	}
+}
+
+func TestProbeClodopSignature(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		server  string
+		body    string
+		want    bool
+		version string
+	}{
+		{"脚本内容", "/CLodopfuncs.js", "", "var CLODOP={VERSION:\"6.5.6.9\"};", true, "6.5.6.9"},
+		{"脚本路径内容不符", "/CLodopfuncs.js", "C-Lodop(Win32)/6.5.6.9", "<html>gateway</html>", false, ""},
+		{"WebSocket路径Server头", "/c_webskt/", "C-Lodop(Win32)/6.5.6.9", "", true, "6.5.6.9"},
+		{"WebSocket路径脚本内容", "/c_webskt/", "", "function getCLodop(){}", true, ""},
+		{"WebSocket路径只返回200", "/c_webskt/", "nginx/1.25.3", "OK", false, ""},
+		{"WebSocket路径没有Server头", "/c_webskt/", "", "", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.server != "" {
+					w.Header().Set("Server", tt.server)
+				}
+				w.Write([]byte(tt.body))
+			}))
+			t.Cleanup(ts.Close)
+			_, portText, _ := net.SplitHostPort(ts.Listener.Addr().String())
+			port, _ := strconv.Atoi(portText)
+
+			endpoint := probeClodop(context.Background(), ts.Client(), clodopCandidate{scheme: "http", port: port, path: tt.path})
+			if (endpoint != nil) != tt.want {
+				t.Fatalf("probeClodop() = %v，期望识别为C-Lodop: %v", endpoint, tt.want)
+			}
+			if endpoint != nil && endpoint.Version != tt.version {
+				t.Errorf("版本 %q，期望 %q", endpoint.Version, tt.version)
+			}
+		})
+	}
+}
+
+func TestVerifyClodopIntegrityChanged(t *testing.T) {
+	cfg := mockClodopConfig(t, mock.DefaultOptions())
+	endpoint, err := DiscoverClodop(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟本次运行首次看到的是另一个脚本
+	runState.Lock()
+	runState.integrity = &clodop.Integrity{ScriptSHA256: "00"}
+	runState.Unlock()
+
+	err = verifyClodopIntegrity(cfg, endpoint)
+	var changed *clodop.ChangedError
+	if !errors.As(err, &changed) {
+		t.Fatalf("未配置固定指纹时 error = %v, want ChangedError", err)
+	}
+	var tampered *clodop.IntegrityError
+	if errors.As(err, &tampered) {
+		t.Error("未配置固定指纹时不应判定为篡改")
+	}
+	if err := checkClodopHealth(cfg); !errors.As(err, &changed) {
+		t.Errorf("checkClodopHealth() error = %v, want ChangedError", err)
+	}
+}
@@ -0,0 +1,104 @@
+package steps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"macos-clodop-schoolpal/clodop"
+	"macos-clodop-schoolpal/config"
+)
+
+// verifyClodopIntegrity 计算脚本和证书指纹，与配置的固定值以及首次校验的结果比较。
+// 与固定值不符时返回 *clodop.IntegrityError；未配置固定值、只是与首次结果不同时返回 *clodop.ChangedError，
+// 不视为篡改；无法获取时返回普通错误。
+func verifyClodopIntegrity(cfg *config.Config, endpoint *ClodopEndpoint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Clodop.DiscoveryTimeout)
+	defer cancel()
+
+	// 本地解密HTTPS时，证书指纹要对远程服务本身校验
+	baseURL := endpoint.BaseURL()
+	if proxy := CachedForwardProxy(); proxy != nil && proxy.TerminatesTLS() {
+		baseURL = proxy.Upstream()
+	}
+
+	integrity, err := clodop.NewClient(baseURL).Integrity(ctx)
+	if err != nil {
+		return err
+	}
+
+	pin := cfg.Clodop.Pin
+	if err := integrity.Verify(pin.ScriptSHA256, pin.CertSHA256); err != nil {
+		return err
+	}
+
+	runState.Lock()
+	defer runState.Unlock()
+
+	// 没有固定指纹时，以本次运行首次看到的内容为准，之后的变化只提示已变化
+	baseline := runState.integrity
+	if baseline == nil {
+		runState.integrity = integrity
+		return nil
+	}
+	if len(pin.ScriptSHA256) == 0 && integrity.ScriptSHA256 != baseline.ScriptSHA256 {
+		return &clodop.ChangedError{Kind: "脚本", Actual: integrity.ScriptSHA256, First: baseline.ScriptSHA256}
+	}
+	if len(pin.CertSHA256) == 0 && baseline.CertSHA256 != "" && integrity.CertSHA256 != baseline.CertSHA256 {
+		return &clodop.ChangedError{Kind: "证书", Actual: integrity.CertSHA256, First: baseline.CertSHA256}
+	}
+	return nil
+}
+
+// StartHealthCheck 按配置的间隔检查Clodop服务是否可用、指纹是否变化。
+// 状态变化时调用onChange，err为nil表示已恢复正常。返回的函数用于停止检查。
+func StartHealthCheck(cfg *config.Config, onChange func(err error)) (stop func()) {
+	if cfg.Clodop.HealthInterval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(cfg.Clodop.HealthInterval)
+		defer ticker.Stop()
+
+		last := ""
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			err := checkClodopHealth(cfg)
+			msg := ""
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != last {
+				last = msg
+				onChange(err)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// checkClodopHealth 检查缓存的服务地址，没有缓存时重新探测
+func checkClodopHealth(cfg *config.Config) error {
+	endpoint := CachedClodopEndpoint()
+	if endpoint == nil {
+		_, err := DiscoverClodop(cfg)
+		return err
+	}
+
+	err := verifyClodopIntegrity(cfg, endpoint)
+	var tampered *clodop.IntegrityError
+	var changed *clodop.ChangedError
+	if err != nil && !errors.As(err, &tampered) && !errors.As(err, &changed) {
+		return fmt.Errorf("Clodop服务 %s 不可用: %v", endpoint.BaseURL(), err)
+	}
+	return err
+}
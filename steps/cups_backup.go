@@ -0,0 +1,357 @@
+package steps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"macos-clodop-schoolpal/ipp"
+	"macos-clodop-schoolpal/utils"
+)
+
+// printersConfPath CUPS打印队列配置，只有root可读
+const printersConfPath = "/etc/cups/printers.conf"
+
+// maxCUPSBackups 保留的备份数量，超出后删除最旧的
+const maxCUPSBackups = 30
+
+// 备份目录中的文件
+const (
+	backupMetaFile     = "backup.json"
+	backupSettingsFile = "cupsctl.txt"
+	backupCupsdFile    = "cupsd.conf"
+	backupPrintersFile = "printers.conf"
+	backupNoPrinters   = "printers.conf.none" // 修改前没有printers.conf
+)
+
+// CUPSBackup 修改CUPS之前保存的一份快照
+type CUPSBackup struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Reason  string    `json:"reason"`
+	Dir     string    `json:"-"`
+}
+
+// String 便于日志和列表显示
+func (b *CUPSBackup) String() string {
+	return fmt.Sprintf("%s %s", b.Created.Format("2006-01-02 15:04:05"), b.Reason)
+}
+
+// HasPrinters 快照中是否包含printers.conf，修改前没有打印机时不存在
+func (b *CUPSBackup) HasPrinters() bool {
+	_, err := os.Stat(filepath.Join(b.Dir, backupPrintersFile))
+	return err == nil
+}
+
+// Complete 快照是否完整。授权被取消时printers.conf没有复制，这样的快照不能用于恢复
+func (b *CUPSBackup) Complete() bool {
+	if b.HasPrinters() {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(b.Dir, backupNoPrinters))
+	return err == nil
+}
+
+// prepareCUPSBackup 新建快照目录，保存cupsctl设置和cupsd.conf。
+// printers.conf需要管理员权限才能读取，返回的命令应放在修改命令之前一起授权执行
+func prepareCUPSBackup(reason string) (*CUPSBackup, [][]string, error) {
+	root, err := utils.GetDataDir("cups-backups")
+	if err != nil {
+		return nil, nil, fmt.Errorf("无法创建备份目录: %v", err)
+	}
+
+	now := time.Now()
+	id := now.Format("20060102-150405")
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(root, id)); os.IsNotExist(err) {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", now.Format("20060102-150405"), n)
+	}
+
+	backup := &CUPSBackup{ID: id, Created: now, Reason: reason, Dir: filepath.Join(root, id)}
+	if err := os.Mkdir(backup.Dir, 0700); err != nil {
+		return nil, nil, fmt.Errorf("无法创建备份目录: %v", err)
+	}
+
+	settings, err := exec.Command("cupsctl").Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("无法读取CUPS设置: %v", err)
+	}
+	conf, err := os.ReadFile(cupsdConfPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("无法读取 %s: %v", cupsdConfPath, err)
+	}
+	meta, _ := json.MarshalIndent(backup, "", "  ")
+
+	for name, data := range map[string][]byte{
+		backupSettingsFile: settings,
+		backupCupsdFile:    conf,
+		backupMetaFile:     meta,
+	} {
+		if err := os.WriteFile(filepath.Join(backup.Dir, name), data, 0600); err != nil {
+			return nil, nil, fmt.Errorf("保存备份失败: %v", err)
+		}
+	}
+
+	// 复制后改为当前用户所有，之后查看和比较不再需要权限
+	dst := shellQuote(filepath.Join(backup.Dir, backupPrintersFile))
+	none := shellQuote(filepath.Join(backup.Dir, backupNoPrinters))
+	copyPrinters := fmt.Sprintf("if [ -f %[1]s ]; then cp %[1]s %[2]s && chmod 600 %[2]s && chown %[3]d %[2]s; else touch %[4]s && chown %[3]d %[4]s; fi",
+		printersConfPath, dst, os.Getuid(), none)
+
+	pruneCUPSBackups(root)
+	fmt.Printf("💾 已备份CUPS配置: %s\n", backup.Dir)
+	return backup, [][]string{{"/bin/sh", "-c", copyPrinters}}, nil
+}
+
+// ListCUPSBackups 列出所有快照，最新的在前
+func ListCUPSBackups() ([]CUPSBackup, error) {
+	root, err := utils.GetDataDir("cups-backups")
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []CUPSBackup
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		data, err := os.ReadFile(filepath.Join(dir, backupMetaFile))
+		if err != nil {
+			continue
+		}
+		var backup CUPSBackup
+		if json.Unmarshal(data, &backup) != nil {
+			continue
+		}
+		backup.Dir = dir
+		backups = append(backups, backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ID > backups[j].ID })
+	return backups, nil
+}
+
+// pruneCUPSBackups 删除超出数量的旧快照
+func pruneCUPSBackups(root string) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+	sort.Strings(ids)
+	for len(ids) > maxCUPSBackups {
+		os.RemoveAll(filepath.Join(root, ids[0]))
+		ids = ids[1:]
+	}
+}
+
+// DiffCUPSBackup 比较快照与当前配置：cupsctl设置和cupsd.conf逐行比较，
+// printers.conf当前内容需要权限才能读取，改为比较打印队列及其设备地址
+func DiffCUPSBackup(backup *CUPSBackup) (string, error) {
+	var b strings.Builder
+
+	oldSettings, err := os.ReadFile(filepath.Join(backup.Dir, backupSettingsFile))
+	if err != nil {
+		return "", err
+	}
+	newSettings, err := exec.Command("cupsctl").Output()
+	if err != nil {
+		return "", fmt.Errorf("无法读取CUPS设置: %v", err)
+	}
+	writeDiff(&b, "cupsctl", string(oldSettings), string(newSettings))
+
+	oldConf, err := os.ReadFile(filepath.Join(backup.Dir, backupCupsdFile))
+	if err != nil {
+		return "", err
+	}
+	newConf, err := os.ReadFile(cupsdConfPath)
+	if err != nil {
+		return "", fmt.Errorf("无法读取 %s: %v", cupsdConfPath, err)
+	}
+	writeDiff(&b, "cupsd.conf", string(oldConf), string(newConf))
+
+	oldQueues := map[string]string{}
+	if data, err := os.ReadFile(filepath.Join(backup.Dir, backupPrintersFile)); err == nil {
+		oldQueues = parsePrintersConf(string(data))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	printers, err := ipp.NewLocalClient().Printers(ctx)
+	if err != nil {
+		return "", fmt.Errorf("无法查询CUPS打印机: %v", err)
+	}
+	newQueues := map[string]string{}
+	for _, p := range printers {
+		newQueues[p.Name] = p.DeviceURI
+	}
+	writeDiff(&b, "打印队列", formatQueues(oldQueues), formatQueues(newQueues))
+
+	if b.Len() == 0 {
+		return "与当前配置相同", nil
+	}
+	return b.String(), nil
+}
+
+// logCUPSChanges 输出本次修改相对快照的差异
+func logCUPSChanges(backup *CUPSBackup) {
+	diff, err := DiffCUPSBackup(backup)
+	if err != nil {
+		fmt.Printf("⚠️ 无法比较CUPS配置: %v\n", err)
+		return
+	}
+	fmt.Printf("📝 CUPS配置变化 (修改前的快照 %s):\n%s\n", backup.ID, diff)
+}
+
+// RestoreCUPSBackup 用快照覆盖当前配置并重启CUPS。恢复前先为当前配置再做一次快照，
+// 恢复本身也可以撤销
+func RestoreCUPSBackup(backup *CUPSBackup) (*CUPSBackup, error) {
+	if _, err := os.Stat(filepath.Join(backup.Dir, backupCupsdFile)); err != nil || !backup.Complete() {
+		return nil, fmt.Errorf("快照 %s 不完整，可能当时取消了授权，不能用于恢复", backup.ID)
+	}
+
+	current, commands, err := prepareCUPSBackup("恢复 " + backup.ID + " 之前")
+	if err != nil {
+		return nil, err
+	}
+
+	// 必须先停止cupsd，否则它退出时会用内存中的队列覆盖printers.conf
+	commands = append(commands,
+		[]string{"launchctl", "stop", "org.cups.cupsd"},
+		[]string{"cp", filepath.Join(backup.Dir, backupCupsdFile), cupsdConfPath},
+	)
+	if backup.HasPrinters() {
+		commands = append(commands,
+			[]string{"cp", filepath.Join(backup.Dir, backupPrintersFile), printersConfPath},
+			[]string{"chown", "root:_lp", printersConfPath},
+			[]string{"chmod", "600", printersConfPath},
+		)
+	} else {
+		commands = append(commands, []string{"rm", "-f", printersConfPath})
+	}
+	commands = append(commands, []string{"launchctl", "start", "org.cups.cupsd"})
+
+	if _, err := runAsAdmin(commands...); err != nil {
+		return current, fmt.Errorf("恢复CUPS配置失败: %v", err)
+	}
+	fmt.Printf("♻️ 已恢复CUPS配置: %s\n", backup)
+	return current, nil
+}
+
+// parsePrintersConf 取出printers.conf中的队列名和设备地址
+func parsePrintersConf(conf string) map[string]string {
+	queues := map[string]string{}
+	current := ""
+	for _, line := range strings.Split(conf, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			if len(fields) == 1 && strings.HasPrefix(fields[0], "</") {
+				current = ""
+			}
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "<printer", "<defaultprinter":
+			current = strings.TrimSuffix(fields[1], ">")
+			queues[current] = ""
+		case "deviceuri":
+			if current != "" {
+				queues[current] = fields[1]
+			}
+		}
+	}
+	return queues
+}
+
+// formatQueues 按名称排序输出 "队列 设备地址"
+func formatQueues(queues map[string]string) string {
+	names := make([]string, 0, len(queues))
+	for name := range queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = name + " " + queues[name]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeDiff 写入一段逐行差异，内容相同时不写
+func writeDiff(b *strings.Builder, title, before, after string) {
+	lines := diffLines(splitLines(before), splitLines(after))
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "=== %s ===\n", title)
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+}
+
+// splitLines 按行拆分并去掉末尾空行
+func splitLines(s string) []string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines 基于最长公共子序列的逐行比较，只输出变化的行，
+// 删除的行以 "- " 开头，新增的行以 "+ " 开头，并附上原文件行号
+func diffLines(a, b []string) []string {
+	// lcs[i][j] 为 a[i:] 与 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "- "+strconv.Itoa(i+1)+": "+a[i])
+			i++
+		default:
+			out = append(out, "+ "+strconv.Itoa(j+1)+": "+b[j])
+			j++
+		}
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package steps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []string
+	}{
+		{"相同", []string{"a", "b"}, []string{"a", "b"}, nil},
+		{"插入", []string{"a", "c"}, []string{"a", "b", "c"}, []string{"+ 2: b"}},
+		{"删除", []string{"a", "b", "c"}, []string{"a", "c"}, []string{"- 2: b"}},
+		{"替换", []string{"a", "b", "c"}, []string{"a", "x", "c"}, []string{"- 2: b", "+ 2: x"}},
+		{"原内容为空", nil, []string{"a", "b"}, []string{"+ 1: a", "+ 2: b"}},
+		{"新内容为空", []string{"a", "b"}, nil, []string{"- 1: a", "- 2: b"}},
+		{"都为空", nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffLines(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffLines() = %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePrintersConf(t *testing.T) {
+	tests := []struct {
+		name string
+		conf string
+		want map[string]string
+	}{
+		{
+			"普通队列",
+			"<Printer HPRT_TP80B>\nInfo HPRT\nDeviceURI usb://HPRT/TP80B\nState Idle\n</Printer>\n",
+			map[string]string{"HPRT_TP80B": "usb://HPRT/TP80B"},
+		},
+		{
+			"默认打印机",
+			"<DefaultPrinter HPRT_TP80B>\nDeviceURI socket://192.168.1.50:9100\n</DefaultPrinter>\n" +
+				"<Printer XP-58>\nDeviceURI usb://XP/58\n</Printer>\n",
+			map[string]string{"HPRT_TP80B": "socket://192.168.1.50:9100", "XP-58": "usb://XP/58"},
+		},
+		{
+			"块外的DeviceURI",
+			"DeviceURI usb://stray/before\n<Printer HPRT_TP80B>\n</Printer>\nDeviceURI usb://stray/after\n",
+			map[string]string{"HPRT_TP80B": ""},
+		},
+		{"空文件", "", map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parsePrintersConf(tt.conf); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePrintersConf() = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package steps
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"macos-clodop-schoolpal/config"
+)
+
+// cupsdConfPath CUPS服务配置文件，macOS上 /etc 指向 /private/etc
+const cupsdConfPath = "/etc/cups/cupsd.conf"
+
+// cupsdConf cupsd.conf 中与共享范围有关的设置
+type cupsdConf struct {
+	Listen       []string // Port 和 Listen 指令的地址
+	Browsing     bool
+	WebInterface bool
+	Locations    map[string]*cupsdLocation
+}
+
+// cupsdLocation 一个 <Location> 块的访问规则
+type cupsdLocation struct {
+	Path  string
+	Order string
+	Allow []string
+	Deny  []string
+}
+
+// applyCUPSSharing 先备份，再按配置改写cupsd.conf并重启CUPS，一次授权完成
+func applyCUPSSharing(cfg *config.Config) (*CUPSBackup, error) {
+	data, err := os.ReadFile(cupsdConfPath)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取 %s: %v", cupsdConfPath, err)
+	}
+
+	tmp, err := os.CreateTemp("", "cupsd-*.conf")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	conf := applySharingPolicy(string(data), cfg.CUPS.AllowFrom, cfg.CUPS.RemoteAdmin)
+	if _, err := tmp.WriteString(conf); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	backup, commands, err := prepareCUPSBackup("配置共享范围之前")
+	if err != nil {
+		return nil, err
+	}
+
+	// cp 覆盖内容但保留原文件的属主和权限
+	commands = append(commands,
+		[]string{"cp", tmp.Name(), cupsdConfPath},
+		[]string{"launchctl", "stop", "org.cups.cupsd"},
+		[]string{"launchctl", "start", "org.cups.cupsd"},
+	)
+	_, err = runAsAdmin(commands...)
+	return backup, err
+}
+
+// verifyCUPSSharing 重新读取cupsd.conf，确认共享范围与配置一致
+func verifyCUPSSharing(cfg *config.Config) error {
+	data, err := os.ReadFile(cupsdConfPath)
+	if err != nil {
+		return fmt.Errorf("无法读取 %s: %v", cupsdConfPath, err)
+	}
+	return checkSharingPolicy(string(data), cfg.CUPS.AllowFrom, cfg.CUPS.RemoteAdmin)
+}
+
+// applySharingPolicy 改写cupsd.conf：监听网络端口、开启共享和网页界面，
+// 并重新生成所有 <Location> 块的 Order/Allow/Deny，其余内容保持不变
+func applySharingPolicy(conf string, allow []string, remoteAdmin bool) string {
+	lines := strings.Split(strings.TrimRight(conf, "\n"), "\n")
+	out := make([]string, 0, len(lines)+len(allow)*2+8)
+
+	listening := parseCupsdConf(conf).listensOnNetwork()
+	browsing, webInterface := false, false
+	seen := map[string]bool{}
+	location, depth := "", 0
+	var loopback []string // 块内允许本机回环地址的规则原样保留
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		key := ""
+		if len(fields) > 0 {
+			key = strings.ToLower(fields[0])
+		}
+
+		switch {
+		case location == "" && key == "<location":
+			location = locationPath(fields)
+			seen[location] = true
+			out = append(out, line)
+		case location != "" && strings.HasPrefix(key, "</"):
+			if depth > 0 {
+				depth--
+				out = append(out, line)
+				continue
+			}
+			out = append(out, loopback...)
+			out = append(out, locationRules(locationAllow(location, allow, remoteAdmin))...)
+			out = append(out, line)
+			location, loopback = "", nil
+		case location != "" && strings.HasPrefix(key, "<"):
+			depth++
+			out = append(out, line)
+		case location != "" && depth == 0 && (key == "order" || key == "allow" || key == "deny"):
+			// 由 locationRules 重新生成
+			if key == "allow" {
+				for _, entry := range ruleValues(fields) {
+					if isLoopbackAddress(entry) {
+						loopback = append(loopback, "  Allow "+entry)
+					}
+				}
+			}
+		case location == "" && key == "listen" && len(fields) > 1 && isLoopbackAddress(fields[1]):
+			if !listening {
+				out = append(out, "Port 631")
+				listening = true
+			}
+		case location == "" && key == "browsing":
+			if !browsing {
+				out = append(out, "Browsing On")
+				browsing = true
+			}
+		case location == "" && key == "webinterface":
+			if !webInterface {
+				out = append(out, "WebInterface Yes")
+				webInterface = true
+			}
+		default:
+			out = append(out, line)
+		}
+	}
+
+	if !listening {
+		out = append([]string{"Port 631"}, out...)
+	}
+	if !browsing {
+		out = append(out, "Browsing On")
+	}
+	if !webInterface {
+		out = append(out, "WebInterface Yes")
+	}
+	for _, path := range []string{"/", "/admin"} {
+		if !seen[path] {
+			out = append(out, "<Location "+path+">")
+			out = append(out, locationRules(locationAllow(path, allow, remoteAdmin))...)
+			out = append(out, "</Location>")
+		}
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+// checkSharingPolicy 检查cupsd.conf是否与共享范围一致，返回第一个不符之处
+func checkSharingPolicy(conf string, allow []string, remoteAdmin bool) error {
+	parsed := parseCupsdConf(conf)
+	if !parsed.listensOnNetwork() {
+		return fmt.Errorf("CUPS只监听本机 (%s)，其他电脑无法连接", strings.Join(parsed.Listen, ", "))
+	}
+	if !parsed.Browsing {
+		return fmt.Errorf("CUPS未开启打印机共享 (Browsing Off)")
+	}
+	if !parsed.WebInterface {
+		return fmt.Errorf("CUPS网页界面未开启")
+	}
+
+	for _, path := range []string{"/", "/admin"} {
+		if parsed.Locations[path] == nil {
+			return fmt.Errorf("cupsd.conf 缺少 <Location %s>", path)
+		}
+	}
+
+	paths := make([]string, 0, len(parsed.Locations))
+	for path := range parsed.Locations {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		loc := parsed.Locations[path]
+		// Order deny,allow 默认放行，必须是 allow,deny 才能限定范围
+		if !strings.EqualFold(loc.Order, "allow,deny") {
+			return fmt.Errorf("<Location %s> 的 Order 为 %q，应为 allow,deny", path, loc.Order)
+		}
+
+		want := normalizeAllow(locationAllow(path, allow, remoteAdmin))
+		got := normalizeAllow(loc.Allow)
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			return fmt.Errorf("<Location %s> 允许 [%s]，配置要求 [%s]", path, strings.Join(got, " "), strings.Join(want, " "))
+		}
+	}
+	return nil
+}
+
+// parseCupsdConf 解析cupsd.conf，只识别顶层指令和 <Location> 块的直接子指令
+func parseCupsdConf(conf string) *cupsdConf {
+	parsed := &cupsdConf{Locations: map[string]*cupsdLocation{}}
+	var loc *cupsdLocation
+	depth := 0
+
+	for _, line := range strings.Split(conf, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		key := strings.ToLower(fields[0])
+		value := ""
+		if len(fields) > 1 {
+			value = fields[1]
+		}
+
+		switch {
+		case strings.HasPrefix(key, "</"):
+			if depth > 0 {
+				depth--
+			} else {
+				loc = nil
+			}
+		case strings.HasPrefix(key, "<"):
+			if key == "<location" && loc == nil && depth == 0 {
+				loc = &cupsdLocation{Path: locationPath(fields)}
+				parsed.Locations[loc.Path] = loc
+			} else {
+				depth++
+			}
+		case depth > 0:
+			// <Policy>、<Limit> 等块内的指令与共享范围无关
+		case loc != nil:
+			switch key {
+			case "order":
+				loc.Order = value
+			case "allow":
+				loc.Allow = append(loc.Allow, ruleValues(fields)...)
+			case "deny":
+				loc.Deny = append(loc.Deny, ruleValues(fields)...)
+			}
+		case key == "listen":
+			parsed.Listen = append(parsed.Listen, value)
+		case key == "port":
+			parsed.Listen = append(parsed.Listen, "*:"+value)
+		case key == "browsing":
+			parsed.Browsing = isOn(value)
+		case key == "webinterface":
+			parsed.WebInterface = isOn(value)
+		}
+	}
+	return parsed
+}
+
+// listensOnNetwork 是否监听了本机以外的地址
+func (c *cupsdConf) listensOnNetwork() bool {
+	for _, addr := range c.Listen {
+		if !strings.HasPrefix(addr, "/") && !isLoopbackAddress(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// locationAllow 某个路径应允许的地址，/admin 及其子路径只有开启远程管理时才开放
+func locationAllow(path string, allow []string, remoteAdmin bool) []string {
+	if (path == "/admin" || strings.HasPrefix(path, "/admin/")) && !remoteAdmin {
+		return nil
+	}
+	return allow
+}
+
+// locationRules 生成 <Location> 块内的访问规则，没有Allow时只允许本机
+func locationRules(allow []string) []string {
+	rules := []string{"  Order allow,deny"}
+	for _, entry := range allow {
+		rules = append(rules, "  Allow "+entry)
+	}
+	return rules
+}
+
+// normalizeAllow 去掉回环地址、去重并排序，便于比较
+func normalizeAllow(entries []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, entry := range entries {
+		key := strings.ToLower(entry)
+		if isLoopbackAddress(key) || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// locationPath 取 "<Location /admin>" 中的路径
+func locationPath(fields []string) string {
+	if len(fields) < 2 {
+		return "/"
+	}
+	return strings.TrimSuffix(fields[1], ">")
+}
+
+// ruleValues 取 Allow/Deny 的地址，兼容 "Allow from all" 写法
+func ruleValues(fields []string) []string {
+	values := fields[1:]
+	if len(values) > 0 && strings.EqualFold(values[0], "from") {
+		values = values[1:]
+	}
+	return values
+}
+
+// isLoopbackAddress 判断 localhost:631、127.0.0.1、[::1]:631 等本机地址
+func isLoopbackAddress(addr string) bool {
+	host := strings.ToLower(addr)
+	if strings.HasPrefix(host, "[") {
+		host = strings.TrimPrefix(host[:strings.Index(host+"]", "]")], "[")
+	} else if i := strings.LastIndex(host, ":"); i >= 0 && strings.Count(host, ":") == 1 {
+		host = host[:i]
+	}
+	return host == "localhost" || host == "::1" || strings.HasPrefix(host, "127.")
+}
+
+// isOn 判断cupsd.conf中的布尔值
+func isOn(value string) bool {
+	switch strings.ToLower(value) {
+	case "on", "yes", "true":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package steps
+
+import (
+	"strings"
+	"testing"
+)
+
+// macOS自带的 /etc/cups/cupsd.conf（节选，<Policy> 块只保留一部分）
+const stockCupsdConf = `#
+# Configuration file for the CUPS scheduler.  See "man cupsd.conf" for a
+# complete description of this file.
+#
+
+# Log general information in error_log - change "warn" to "debug"
+# for troubleshooting...
+LogLevel warn
+PageLogFormat
+
+# Deactivate CUPS' internal logrotating, as we provide a better one, especially
+# LogLevel debug2 gets usable now
+MaxLogSize 0
+
+# Only listen for connections from the local machine.
+Listen localhost:631
+Listen /private/var/run/cupsd
+
+# Show shared printers on the local network.
+Browsing Off
+BrowseLocalProtocols dnssd
+
+# Default authentication type, when authentication is required...
+DefaultAuthType Basic
+
+# Web interface setting...
+WebInterface No
+
+# Restrict access to the server...
+<Location />
+  Order allow,deny
+</Location>
+
+# Restrict access to the admin pages...
+<Location /admin>
+  Order allow,deny
+</Location>
+
+# Restrict access to configuration files...
+<Location /admin/conf>
+  AuthType Default
+  Require user @SYSTEM
+  Order allow,deny
+</Location>
+
+# Set the default printer/job policies...
+<Policy default>
+  # Job-related operations must be done by the owner or an administrator...
+  <Limit Create-Job Print-Job Print-URI Validate-Job>
+    Order deny,allow
+  </Limit>
+
+  <Limit All>
+    Order deny,allow
+  </Limit>
+</Policy>
+`
+
+// 已由本程序限定过共享范围的文件
+const restrictedCupsdConf = `Port 631
+Listen /private/var/run/cupsd
+Browsing On
+WebInterface Yes
+<Location />
+  Allow localhost
+  Order allow,deny
+  Allow 10.8.0.0/24
+</Location>
+<Location /admin>
+  Order allow,deny
+</Location>
+`
+
+// 用户在系统设置中开启共享后的文件，允许整个本地网络
+const localCupsdConf = `Port 631
+Listen /private/var/run/cupsd
+Browsing On
+BrowseLocalProtocols dnssd
+WebInterface Yes
+<Location />
+  Order allow,deny
+  Allow localhost
+  Allow @LOCAL
+</Location>
+<Location /admin>
+  Order deny,allow
+  Allow @LOCAL
+</Location>
+`
+
+var testAllow = []string{"10.8.0.0/24"}
+
+func TestCheckSharingPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		conf        string
+		remoteAdmin bool
+		wantErr     string
+	}{
+		{"系统默认只监听本机", stockCupsdConf, false, "只监听本机"},
+		{"已限定范围", restrictedCupsdConf, false, ""},
+		{"已限定范围但要求远程管理", restrictedCupsdConf, true, "<Location /admin> 允许 []"},
+		{"允许整个本地网络", localCupsdConf, false, "<Location /> 允许 [@local]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSharingPolicy(tt.conf, testAllow, tt.remoteAdmin)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("意外的错误: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("错误 %v，期望包含 %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplySharingPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		conf        string
+		remoteAdmin bool
+		wantAdmin   []string // 改写后 /admin 的Allow
+	}{
+		{"系统默认", stockCupsdConf, false, nil},
+		{"系统默认开启远程管理", stockCupsdConf, true, testAllow},
+		{"已限定范围", restrictedCupsdConf, false, nil},
+		{"已限定范围开启远程管理", restrictedCupsdConf, true, testAllow},
+		{"允许整个本地网络", localCupsdConf, false, nil},
+		{"允许整个本地网络开启远程管理", localCupsdConf, true, testAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			once := applySharingPolicy(tt.conf, testAllow, tt.remoteAdmin)
+			if err := checkSharingPolicy(once, testAllow, tt.remoteAdmin); err != nil {
+				t.Fatalf("改写后仍不符合: %v\n%s", err, once)
+			}
+			if twice := applySharingPolicy(once, testAllow, tt.remoteAdmin); twice != once {
+				t.Errorf("再次改写结果不同:\n%s\n---\n%s", once, twice)
+			}
+
+			parsed := parseCupsdConf(once)
+			if got := strings.Join(normalizeAllow(parsed.Locations["/"].Allow), " "); got != "10.8.0.0/24" {
+				t.Errorf("<Location /> 允许 [%s]", got)
+			}
+			if got, want := strings.Join(normalizeAllow(parsed.Locations["/admin"].Allow), " "), strings.Join(tt.wantAdmin, " "); got != want {
+				t.Errorf("<Location /admin> 允许 [%s]，期望 [%s]", got, want)
+			}
+			if strings.Contains(once, "@LOCAL") {
+				t.Errorf("改写后仍允许 @LOCAL:\n%s", once)
+			}
+		})
+	}
+}
+
+func TestApplySharingPolicyKeepsOtherSettings(t *testing.T) {
+	conf := applySharingPolicy(stockCupsdConf, testAllow, false)
+
+	// 本机回环、套接字监听和 <Policy> 中的规则不受影响
+	for _, want := range []string{"Port 631\n", "Listen /private/var/run/cupsd\n", "LogLevel warn\n", "    Order deny,allow\n  </Limit>\n"} {
+		if !strings.Contains(conf, want) {
+			t.Errorf("改写后缺少 %q:\n%s", want, conf)
+		}
+	}
+	if strings.Contains(conf, "Listen localhost:631") || strings.Contains(conf, "Browsing Off") || strings.Contains(conf, "WebInterface No") {
+		t.Errorf("改写后仍只监听本机或未开启共享:\n%s", conf)
+	}
+
+	// 本来就允许本机的规则保留
+	local := applySharingPolicy(localCupsdConf, testAllow, false)
+	if !strings.Contains(local, "  Allow localhost\n") {
+		t.Errorf("改写后缺少 Allow localhost:\n%s", local)
+	}
+}
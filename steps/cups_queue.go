@@ -0,0 +1,278 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"macos-clodop-schoolpal/catalog"
+	"macos-clodop-schoolpal/config"
+	"macos-clodop-schoolpal/ipp"
+)
+
+// cupsDevice `lpinfo -v` 列出的设备
+type cupsDevice struct {
+	Class string // direct、network等
+	URI   string
+}
+
+// cupsDriver `lpinfo -m` 列出的驱动
+type cupsDriver struct {
+	Name         string // 传给 lpadmin -m 的PPD名称
+	MakeAndModel string
+}
+
+// addPrinterToCUPS 为USB连接的打印机创建CUPS队列，设备和PPD按型号目录中的规则选择。
+// 队列已存在且指向同一设备时不做修改，创建后通过IPP确认队列可用。
+func addPrinterToCUPS(cfg *config.Config) error {
+	queue := cfg.Printer.Queue.Name
+	model := cfg.PrinterModel()
+	fmt.Printf("🖨️ 为 %s 创建CUPS队列 %s...\n", model.DisplayName(), queue)
+
+	devices, err := listCUPSDevices()
+	if err != nil {
+		return err
+	}
+	device := matchDevice(devices, model)
+	if device == nil {
+		return fmt.Errorf("未找到 %s 的USB设备，请检查打印机电源和USB连接", cfg.Printer.Model)
+	}
+	fmt.Printf("🔌 找到设备: %s\n", device.URI)
+
+	if existing := queueAttributes(queue); existing != nil && existing.DeviceURI == device.URI {
+		fmt.Printf("✅ CUPS队列 %s 已存在\n", queue)
+		return verifyCUPSQueue(queue, device.URI)
+	}
+
+	drivers, err := listCUPSDrivers()
+	if err != nil {
+		return err
+	}
+	driver := matchDriver(drivers, model)
+	if driver == nil {
+		return fmt.Errorf("未找到 %s 的PPD驱动，请确认第3步驱动已安装", cfg.Printer.Model)
+	}
+	fmt.Printf("📄 使用驱动: %s (%s)\n", driver.MakeAndModel, driver.Name)
+
+	backup, commands, err := prepareCUPSBackup("创建队列 " + queue + " 之前")
+	if err != nil {
+		return err
+	}
+	if _, err := runAsAdmin(append(commands, lpadminArgs(cfg, device.URI, driver))...); err != nil {
+		return fmt.Errorf("创建CUPS队列失败: %v", err)
+	}
+
+	logCUPSChanges(backup)
+	return verifyCUPSQueue(queue, device.URI)
+}
+
+// lpadminArgs 生成创建队列的lpadmin参数，-E 表示立即启用并接受任务
+func lpadminArgs(cfg *config.Config, uri string, driver *cupsDriver) []string {
+	q := cfg.Printer.Queue
+	args := []string{"lpadmin", "-p", q.Name, "-E", "-v", uri, "-m", driver.Name,
+		"-D", driver.MakeAndModel, "-o", "printer-is-shared=true"}
+	if q.Location != "" {
+		args = append(args, "-L", q.Location)
+	}
+
+	keys := make([]string, 0, len(q.Options))
+	for key := range q.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "-o", key+"="+q.Options[key])
+	}
+	return args
+}
+
+// verifyCUPSQueue 确认队列存在、指向预期设备并接受任务
+func verifyCUPSQueue(queue, uri string) error {
+	var printer *ipp.Printer
+	for i := 0; i < 5; i++ {
+		if printer = queueAttributes(queue); printer != nil {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+
+	switch {
+	case printer == nil:
+		return fmt.Errorf("lpadmin执行完成，但CUPS中没有队列 %s", queue)
+	case printer.DeviceURI != uri:
+		return fmt.Errorf("CUPS队列 %s 指向 %s，而不是 %s", queue, printer.DeviceURI, uri)
+	case !printer.AcceptingJobs:
+		return fmt.Errorf("CUPS队列 %s 未接受任务，可运行 cupsaccept %s", queue, queue)
+	case printer.State == ipp.PrinterStopped:
+		return fmt.Errorf("CUPS队列 %s 已停止: %s %v", queue, printer.StateMessage, printer.StateReasons)
+	}
+
+	fmt.Printf("✅ CUPS队列 %s 就绪 (%s, %s)\n", queue, printer.MakeAndModel, printer.StateName())
+	return nil
+}
+
+// queueAttributes 查询队列属性，不存在或查询失败时返回nil
+func queueAttributes(queue string) *ipp.Printer {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	printer, err := ipp.NewLocalClient().PrinterAttributes(ctx, queue)
+	if err != nil {
+		return nil
+	}
+	return printer
+}
+
+// listCUPSDevices 列出USB设备，扫描后端较慢，限制在USB并设置超时
+func listCUPSDevices() ([]cupsDevice, error) {
+	output, err := lpinfo("--include-schemes", "usb", "--timeout", "10", "-v")
+	if err != nil {
+		return nil, fmt.Errorf("无法列出打印设备: %v", err)
+	}
+	return parseLpinfoDevices(output), nil
+}
+
+// listCUPSDrivers 列出已安装的驱动
+func listCUPSDrivers() ([]cupsDriver, error) {
+	output, err := lpinfo("-m")
+	if err != nil {
+		return nil, fmt.Errorf("无法列出打印驱动: %v", err)
+	}
+	return parseLpinfoDrivers(output), nil
+}
+
+// lpinfo 以C语言环境执行lpinfo，避免输出被本地化
+func lpinfo(args ...string) (string, error) {
+	cmd := exec.Command("lpinfo", args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C", "LANG=C")
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+// parseLpinfoDevices 解析 `lpinfo -v`，每行为 "<类别> <URI>"
+func parseLpinfoDevices(output string) []cupsDevice {
+	var devices []cupsDevice
+	for _, line := range strings.Split(output, "\n") {
+		class, uri, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if ok && strings.Contains(uri, "://") {
+			devices = append(devices, cupsDevice{Class: class, URI: strings.TrimSpace(uri)})
+		}
+	}
+	return devices
+}
+
+// parseLpinfoDrivers 解析 `lpinfo -m`，每行为 "<PPD名称> <型号>"。
+// PPD文件名可能包含空格，因此优先在 .ppd/.ppd.gz 之后切分
+func parseLpinfoDrivers(output string) []cupsDriver {
+	var drivers []cupsDriver
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		split := -1
+		lower := strings.ToLower(line)
+		for _, ext := range []string{".ppd.gz ", ".ppd "} {
+			if i := strings.Index(lower, ext); i >= 0 {
+				split = i + len(ext) - 1
+				break
+			}
+		}
+		if split < 0 {
+			split = strings.Index(line, " ")
+		}
+		if split < 0 {
+			continue
+		}
+		drivers = append(drivers, cupsDriver{
+			Name:         line[:split],
+			MakeAndModel: strings.TrimSpace(line[split+1:]),
+		})
+	}
+	return drivers
+}
+
+// matchDevice 按型号选择设备：完整型号优先，其次是型号部分，最后是带有厂商关键词的USB设备
+func matchDevice(devices []cupsDevice, model catalog.Model) *cupsDevice {
+	best, bestScore := -1, 0
+	for i, d := range devices {
+		if score := modelScore(d.URI, model); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	return &devices[best]
+}
+
+// matchDriver 在符合型号PPD规则的驱动中按型号选择，规则与设备相同
+func matchDriver(drivers []cupsDriver, model catalog.Model) *cupsDriver {
+	best, bestScore := -1, 0
+	for i, d := range drivers {
+		text := d.Name + " " + d.MakeAndModel
+		if !model.MatchPPD(text) {
+			continue
+		}
+		// 符合PPD规则的驱动至少是候选
+		if score := modelScore(text, model) + 1; score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	return &drivers[best]
+}
+
+// modelScore 计算文本与型号的匹配程度，0表示不匹配。型号必须由完整的词组成，
+// 避免 XP-58 的 "58" 匹配到 XP-580 或序列号中的数字
+func modelScore(text string, model catalog.Model) int {
+	tokens := nameTokens(text)
+	if containsTokens(tokens, catalog.Normalize(model.Name)) {
+		return 3
+	}
+
+	// 型号部分，如 HPRT_TP80B 中的 TP80B，还要求出现厂商关键词
+	parts := nameTokens(model.Name)
+	if len(parts) > 1 && containsTokens(tokens, parts[len(parts)-1]) && model.MatchName(text) {
+		return 2
+	}
+
+	if model.MatchName(text) {
+		return 1
+	}
+	return 0
+}
+
+// nameTokens 按字母数字以外的字符切分并转小写，如 "usb://Xprinter/XP-58?serial=1" 切为 usb xprinter xp 58 serial 1
+func nameTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+}
+
+// containsTokens 判断key是否等于tokens中连续几个词的拼接，"xp58" 可以匹配 xp 58 或 xp58，不匹配 xp580
+func containsTokens(tokens []string, key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := range tokens {
+		joined := ""
+		for _, token := range tokens[i:] {
+			joined += token
+			if joined == key {
+				return true
+			}
+			if !strings.HasPrefix(key, joined) {
+				break
+			}
+		}
+	}
+	return false
+}
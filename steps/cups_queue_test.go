@@ -0,0 +1,74 @@
+package steps
+
+import (
+	"testing"
+
+	"macos-clodop-schoolpal/catalog"
+)
+
+func lookupModel(t *testing.T, name string) catalog.Model {
+	t.Helper()
+	model, err := catalog.Lookup(name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model
+}
+
+func TestModelScore(t *testing.T) {
+	tests := []struct {
+		model string
+		text  string
+		want  int
+	}{
+		{"XP-58", "usb://Xprinter/XP-58?serial=A1", 3},
+		{"XP-58", "usb://Printer/XP58", 3},
+		{"XP-58", "usb://Xprinter/XP-580?serial=A1", 1},   // XP-580 不是 XP-58
+		{"XP-58", "usb://Xprinter/XP-80?serial=58", 2},    // 只有序列号中的58
+		{"XP-58", "usb://Zebra/ZD-58?serial=1", 0},        // 其他厂商的58
+		{"HPRT_TP80B", "usb://HPRT/TP80B?serial=123", 3},  // 厂商和型号分开
+		{"HPRT_TP80B", "usb://HPRT/TP80BE?serial=123", 1}, // 型号部分不完整
+		{"HPRT_TP80B", "usb://Other/TP80B?serial=123", 0}, // 型号部分相同但不是该厂商
+		{"TM-T20", "usb://EPSON/TM-T20II?serial=X", 1},    // TM-T20II 不是 TM-T20
+		{"TM-T20", "usb://EPSON/TM-T20?serial=X", 3},
+	}
+	for _, tt := range tests {
+		if got := modelScore(tt.text, lookupModel(t, tt.model)); got != tt.want {
+			t.Errorf("modelScore(%q, %s) = %d, 期望 %d", tt.text, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestMatchDevice(t *testing.T) {
+	devices := []cupsDevice{
+		{Class: "direct", URI: "usb://Xprinter/XP-580?serial=58"},
+		{Class: "direct", URI: "usb://Xprinter/XP-58?serial=1"},
+		{Class: "network", URI: "socket://192.168.1.58"},
+	}
+	if d := matchDevice(devices, lookupModel(t, "XP-58")); d == nil || d.URI != devices[1].URI {
+		t.Errorf("XP-58 选择了 %+v", d)
+	}
+
+	// 没有完整型号时退回带厂商关键词的设备
+	if d := matchDevice(devices[:1], lookupModel(t, "XP-58")); d == nil || d.URI != devices[0].URI {
+		t.Errorf("XP-58 选择了 %+v", d)
+	}
+	if d := matchDevice(devices[2:], lookupModel(t, "XP-58")); d != nil {
+		t.Errorf("不应匹配 %+v", d)
+	}
+}
+
+func TestMatchDriver(t *testing.T) {
+	drivers := []cupsDriver{
+		{Name: "Library/Printers/PPDs/Contents/Resources/XP-580.ppd.gz", MakeAndModel: "Xprinter XP-580"},
+		{Name: "Library/Printers/PPDs/Contents/Resources/XP-58.ppd.gz", MakeAndModel: "Xprinter XP-58"},
+		{Name: "drv:///sample.drv/epson9.ppd", MakeAndModel: "Epson 9-Pin Series"},
+	}
+	if d := matchDriver(drivers, lookupModel(t, "XP-58")); d == nil || d.MakeAndModel != "Xprinter XP-58" {
+		t.Errorf("XP-58 选择了 %+v", d)
+	}
+	// 不符合PPD规则的驱动不作为候选
+	if d := matchDriver(drivers, lookupModel(t, "TM-T20")); d != nil {
+		t.Errorf("TM-T20 选择了 %+v", d)
+	}
+}
@@ -0,0 +1,139 @@
+package steps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"macos-clodop-schoolpal/config"
+	"macos-clodop-schoolpal/ipp"
+)
+
+// SharedQueueURI Windows电脑添加共享打印机时使用的地址
+func SharedQueueURI(addr, queue string) string {
+	return fmt.Sprintf("ipp://%s/printers/%s", net.JoinHostPort(addr, "631"), url.PathEscape(queue))
+}
+
+// reportSharedQueue 显示Windows电脑应使用的共享地址，并检查能否通过VPN地址访问。
+// 检查失败只记录警告，不影响步骤结果
+func reportSharedQueue(cfg *config.Config) {
+	vpn, err := currentVPNInterface(cfg)
+	if err != nil {
+		fmt.Printf("ℹ️ %v，连接VPN后再检查共享地址\n", err)
+		return
+	}
+
+	queue := sharedQueueName(cfg)
+	if queue == "" {
+		fmt.Printf("ℹ️ CUPS中还没有 %s 的打印队列，跳过共享地址检查\n", cfg.Printer.Model)
+		return
+	}
+
+	addr := vpn.Addresses[0]
+	uri := SharedQueueURI(addr, queue)
+	fmt.Printf("🌐 VPN地址: %s (%s)\n", addr, vpn.InterfaceName)
+	fmt.Printf("🪟 Windows电脑添加打印机时使用: %s\n", uri)
+
+	if err := checkSharedQueue(cfg, vpn, queue); err != nil {
+		addWarning("共享打印机 %s 无法通过VPN访问: %v", uri, err)
+		return
+	}
+	fmt.Printf("✅ 共享打印机可通过VPN地址 %s 访问\n", addr)
+}
+
+// currentVPNInterface 返回第7步记录的VPN网卡，尚未记录时按配置的名称查询
+func currentVPNInterface(cfg *config.Config) (*vpnInterfaceInfo, error) {
+	vpn := cachedVPNInterface()
+	if vpn == nil {
+		available, err := getAvailableVPNs()
+		if err != nil {
+			return nil, fmt.Errorf("无法获取VPN列表: %v", err)
+		}
+		name := findMatchingVPN(cfg.VPN.Name, available)
+		if name == "" || !isVPNConnected(name) {
+			return nil, fmt.Errorf("VPN '%s' 未连接", cfg.VPN.Name)
+		}
+		if vpn, err = getVPNInterface(name); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(vpn.Addresses) == 0 {
+		return nil, fmt.Errorf("VPN网卡 %s 没有IPv4地址", vpn.InterfaceName)
+	}
+	return vpn, nil
+}
+
+// sharedQueueName 共享给Windows的队列，优先使用配置的队列名，其次是CUPS中该型号的打印机
+func sharedQueueName(cfg *config.Config) string {
+	if queueAttributes(cfg.Printer.Queue.Name) != nil {
+		return cfg.Printer.Queue.Name
+	}
+	if printer, err := findCUPSPrinter(cfg.PrinterModel()); err == nil && printer != nil {
+		return printer.Name
+	}
+	return ""
+}
+
+// checkSharedQueue 通过VPN地址查询共享队列，确认CUPS在该地址上监听、队列已共享，
+// 并且共享范围包含Windows电脑
+func checkSharedQueue(cfg *config.Config, vpn *vpnInterfaceInfo, queue string) error {
+	addr := vpn.Addresses[0]
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := ipp.NewClient("http://" + net.JoinHostPort(addr, "631"))
+	printer, err := client.PrinterAttributes(ctx, queue)
+
+	var httpErr *ipp.HTTPError
+	var statusErr *ipp.StatusError
+	switch {
+	case errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusForbidden:
+		// 本机VPN地址不在共享范围内时CUPS会拒绝，但说明已在该地址上监听，改用本地连接确认队列状态
+		fmt.Printf("ℹ️ CUPS已在 %s 上监听，本机地址不在共享范围内，改为本地检查队列\n", addr)
+		if printer = queueAttributes(queue); printer == nil {
+			return fmt.Errorf("CUPS中没有队列 %s", queue)
+		}
+	case errors.As(err, &statusErr) && statusErr.Code == ipp.StatusNotFound:
+		return fmt.Errorf("CUPS中没有队列 %s", queue)
+	case err != nil:
+		return fmt.Errorf("无法通过 %s:631 访问CUPS，请确认第6步已开启共享: %v", addr, err)
+	}
+
+	if !printer.Shared {
+		return fmt.Errorf("队列 %s 未共享，可运行 lpadmin -p %s -o printer-is-shared=true", queue, queue)
+	}
+	if !printer.AcceptingJobs {
+		return fmt.Errorf("队列 %s 未接受任务，可运行 cupsaccept %s", queue, queue)
+	}
+
+	if !allowCovers(cfg.CUPS.AllowFrom, cfg.Network.RemoteHost, vpn.InterfaceName) {
+		return fmt.Errorf("共享范围 [%s] 不包含Windows电脑 %s，请修改 cups.allow_from",
+			strings.Join(cfg.CUPS.AllowFrom, ", "), cfg.Network.RemoteHost)
+	}
+	return nil
+}
+
+// allowCovers 判断访问规则是否允许host，@IF(接口) 按VPN网卡名比较
+func allowCovers(allow []string, host, vpnInterface string) bool {
+	ip := net.ParseIP(host)
+	for _, entry := range allow {
+		switch {
+		case strings.EqualFold(entry, host):
+			return true
+		case entry == "@IF("+vpnInterface+")":
+			return true
+		case ip != nil && net.ParseIP(entry) != nil && net.ParseIP(entry).Equal(ip):
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil && ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
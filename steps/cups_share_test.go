@@ -0,0 +1,36 @@
+package steps
+
+import "testing"
+
+func TestAllowCovers(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		host  string
+		vpn   string
+		want  bool
+	}{
+		{"主机名", []string{"shop-pc.local"}, "shop-pc.local", "utun3", true},
+		{"主机名不区分大小写", []string{"Shop-PC.local"}, "shop-pc.local", "utun3", true},
+		{"其他主机名", []string{"office-pc.local"}, "shop-pc.local", "utun3", false},
+		{"IP地址", []string{"192.168.1.200"}, "192.168.1.200", "", true},
+		{"IP地址不同写法", []string{"::ffff:192.168.1.200"}, "192.168.1.200", "", true},
+		{"其他IP", []string{"192.168.1.201"}, "192.168.1.200", "", false},
+		{"网段内", []string{"192.168.1.0/24"}, "192.168.1.200", "", true},
+		{"网段外", []string{"192.168.2.0/24"}, "192.168.1.200", "", false},
+		{"主机名不按网段比较", []string{"192.168.1.0/24"}, "shop-pc.local", "", false},
+		{"VPN网卡", []string{"@IF(utun3)"}, "192.168.1.200", "utun3", true},
+		{"其他网卡", []string{"@IF(utun4)"}, "192.168.1.200", "utun3", false},
+		{"VPN未连接", []string{"@IF(utun3)"}, "192.168.1.200", "", false},
+		{"只允许本机", []string{"@LOCAL"}, "192.168.1.200", "utun3", false},
+		{"多条规则任一匹配", []string{"@LOCAL", "10.8.0.0/24", "192.168.1.200"}, "192.168.1.200", "", true},
+		{"没有规则", nil, "192.168.1.200", "utun3", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowCovers(tt.allow, tt.host, tt.vpn); got != tt.want {
+				t.Errorf("allowCovers(%v, %q, %q) = %v，期望 %v", tt.allow, tt.host, tt.vpn, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package steps
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"macos-clodop-schoolpal/config"
+)
+
+// 诊断层级名称
+const (
+	layerDNS    = "DNS解析"
+	layerRoute  = "路由"
+	layerTCP    = "TCP连接"
+	layerTLS    = "TLS握手"
+	layerHTTP   = "HTTP状态"
+	layerScript = "Clodop脚本"
+)
+
+// diagTimeout 每一层检查的超时时间
+const diagTimeout = 5 * time.Second
+
+// DiagHop 单层诊断结果
+type DiagHop struct {
+	Layer    string
+	OK       bool
+	Skipped  bool
+	Detail   string
+	Duration time.Duration
+	Err      error
+}
+
+// DiagPath 一条访问路径（直连或经端口转发）的诊断结果
+type DiagPath struct {
+	Name string
+	Host string
+	Port string
+	Hops []DiagHop
+}
+
+// DiagReport 连接诊断报告
+type DiagReport struct {
+	Paths []*DiagPath
+}
+
+// RunDiagnostics 分层诊断直连和转发两条路径
+func RunDiagnostics(cfg *config.Config) *DiagReport {
+	report := &DiagReport{}
+
+	direct := diagnosePath("直连", cfg.Network.RemoteHost, cfg.Network.RemotePort)
+	report.Paths = append(report.Paths, direct)
+
+	forwarded := diagnosePath("转发", "localhost", cfg.Network.LocalPort)
+	report.Paths = append(report.Paths, forwarded)
+
+	return report
+}
+
+// FirstFailure 返回路径上第一个失败的层级，全部通过时返回nil
+func (p *DiagPath) FirstFailure() *DiagHop {
+	for i := range p.Hops {
+		if !p.Hops[i].OK && !p.Hops[i].Skipped {
+			return &p.Hops[i]
+		}
+	}
+	return nil
+}
+
+// String 生成可直接发给技术支持的诊断报告
+func (r *DiagReport) String() string {
+	var b strings.Builder
+	b.WriteString("📋 ========== 连接诊断报告 ==========\n")
+	for _, path := range r.Paths {
+		fmt.Fprintf(&b, "[%s] %s\n", path.Name, net.JoinHostPort(path.Host, path.Port))
+		for _, hop := range path.Hops {
+			mark := "✅"
+			detail := hop.Detail
+			switch {
+			case hop.Skipped:
+				mark = "⏭️"
+			case !hop.OK:
+				mark = "❌"
+				if hop.Err != nil {
+					detail = hop.Err.Error()
+				}
+			}
+			fmt.Fprintf(&b, "  %s %-10s %6dms  %s\n", mark, hop.Layer, hop.Duration.Milliseconds(), detail)
+		}
+	}
+	return b.String()
+}
+
+// diagnosePath 按 DNS → 路由 → TCP → TLS → HTTP → 脚本 的顺序逐层检查
+func diagnosePath(name, host, port string) *DiagPath {
+	path := &DiagPath{Name: name, Host: host, Port: port}
+	failed := false
+
+	skip := func(layer string) {
+		path.Hops = append(path.Hops, DiagHop{Layer: layer, Skipped: true, Detail: "前一层失败，跳过"})
+	}
+	run := func(layer string, check func() (string, error)) {
+		if failed {
+			skip(layer)
+			return
+		}
+		start := time.Now()
+		detail, err := check()
+		hop := DiagHop{Layer: layer, OK: err == nil, Detail: detail, Duration: time.Since(start), Err: err}
+		path.Hops = append(path.Hops, hop)
+		if err != nil {
+			failed = true
+		}
+	}
+
+	var addr string
+	run(layerDNS, func() (string, error) {
+		if ip := net.ParseIP(host); ip != nil {
+			addr = host
+			return "IP地址，无需解析", nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), diagTimeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return "", fmt.Errorf("无法解析 %s: %v", host, err)
+		}
+		addr = addrs[0]
+		return fmt.Sprintf("%s → %s", host, strings.Join(addrs, ", ")), nil
+	})
+
+	run(layerRoute, func() (string, error) {
+		route, err := getRouteToHost(addr)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("网卡 %s, 源地址 %s", route.Interface, route.SourceAddr), nil
+	})
+
+	target := net.JoinHostPort(host, port)
+	run(layerTCP, func() (string, error) {
+		conn, err := net.DialTimeout("tcp", target, diagTimeout)
+		if err != nil {
+			return "", fmt.Errorf("无法连接 %s: %v", target, err)
+		}
+		conn.Close()
+		return "端口已开放", nil
+	})
+
+	// 对方以明文回应握手时按普通HTTP端口继续检查，超时、连接被重置、协议版本不符等都是TLS故障
+	scheme := "https"
+	if !failed {
+		start := time.Now()
+		detail, err := checkTLS(target, host)
+		hop := DiagHop{Layer: layerTLS, OK: err == nil, Detail: detail, Duration: time.Since(start), Err: err}
+		if err != nil && isPlainPort(err) {
+			scheme = "http"
+			hop.OK = false
+			hop.Skipped = true
+			hop.Detail = "非TLS端口，改用HTTP"
+		}
+		path.Hops = append(path.Hops, hop)
+		if err != nil && !hop.Skipped {
+			failed = true
+		}
+	} else {
+		skip(layerTLS)
+	}
+
+	var body string
+	run(layerHTTP, func() (string, error) {
+		url := fmt.Sprintf("%s://%s/CLodopfuncs.js", scheme, target)
+		client := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+			Timeout:   diagTimeout,
+		}
+		resp, err := client.Get(url)
+		if err != nil {
+			return "", fmt.Errorf("请求 %s 失败: %v", url, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("%s 返回状态 %s", url, resp.Status)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return "", fmt.Errorf("读取 %s 失败: %v", url, err)
+		}
+		body = string(data)
+		return fmt.Sprintf("%s %s", url, resp.Status), nil
+	})
+
+	run(layerScript, func() (string, error) {
+		if !isClodopScript(body) {
+			return "", fmt.Errorf("返回内容不是Clodop脚本（%d字节），可能被网关或其他服务拦截", len(body))
+		}
+		return fmt.Sprintf("脚本正常（%d字节）", len(body)), nil
+	})
+
+	return path
+}
+
+// checkTLS 完成TLS握手并返回证书摘要，证书过期视为失败
+func checkTLS(target, host string) (string, error) {
+	dialer := &net.Dialer{Timeout: diagTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", target, &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         host,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "无证书", nil
+	}
+
+	cert := certs[0]
+	days := int(time.Until(cert.NotAfter).Hours() / 24)
+	detail := fmt.Sprintf("证书 %s (签发者 %s), 有效期至 %s, 剩余%d天",
+		cert.Subject.CommonName, cert.Issuer.CommonName, cert.NotAfter.Format("2006-01-02"), days)
+
+	if time.Now().After(cert.NotAfter) {
+		return detail, &certificateError{fmt.Sprintf("证书已于 %s 过期，浏览器将拒绝加载Clodop脚本", cert.NotAfter.Format("2006-01-02"))}
+	}
+	return detail, nil
+}
+
+// certificateError 握手成功但证书本身有问题
+type certificateError struct {
+	msg string
+}
+
+func (e *certificateError) Error() string {
+	return e.msg
+}
+
+// isPlainPort 判断握手失败是否因为端口不支持TLS：对方回应的第一个记录不是TLS记录，
+// 通常是明文HTTP服务返回的 400 Bad Request
+func isPlainPort(err error) bool {
+	var recordErr tls.RecordHeaderError
+	return errors.As(err, &recordErr)
+}
+
+// isClodopScript 检查内容是否为Clodop的JavaScript
+func isClodopScript(body string) bool {
+	return strings.Contains(body, "CLODOP") || strings.Contains(body, "getCLodop")
+}
@@ -0,0 +1,50 @@
+package steps
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckTLSPlainPort(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(plain.Close)
+
+	// 接受连接后立即关闭，握手以EOF失败
+	reset, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reset.Close() })
+	go func() {
+		for {
+			conn, err := reset.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	tests := []struct {
+		name      string
+		target    string
+		wantPlain bool
+	}{
+		{"明文HTTP端口", strings.TrimPrefix(plain.URL, "http://"), true},
+		{"连接被关闭", reset.Addr().String(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := checkTLS(tt.target, "127.0.0.1")
+			if err == nil {
+				t.Fatal("握手应当失败")
+			}
+			if got := isPlainPort(err); got != tt.wantPlain {
+				t.Errorf("isPlainPort(%v) = %v，期望 %v", err, got, tt.wantPlain)
+			}
+		})
+	}
+}
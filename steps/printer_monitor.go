@@ -0,0 +1,128 @@
+package steps
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"macos-clodop-schoolpal/config"
+	"macos-clodop-schoolpal/escpos"
+	"macos-clodop-schoolpal/ipp"
+	"macos-clodop-schoolpal/printerstatus"
+)
+
+// ippOnlyNote USB型号不查询DLE EOT，只能依靠驱动向CUPS上报的状态
+const ippOnlyNote = "仅CUPS状态：USB打印机不查询ESC/POS实时状态，驱动不上报时缺纸、开盖检测不到"
+
+// StartPrinterMonitor 每隔 printer.monitor_interval 检查一次打印机，状态变化时调用onChange。
+// 启动时立即检查一次
+func StartPrinterMonitor(cfg *config.Config, onChange func(status *printerstatus.Status)) (stop func()) {
+	if cfg.Printer.MonitorInterval <= 0 {
+		return func() {}
+	}
+
+	if cfg.Printer.RawAddress == "" {
+		fmt.Println("💡 未配置 printer.raw_address，打印机状态只来自CUPS队列。多数热敏打印机驱动不会向CUPS上报缺纸和开盖，" +
+			"此时只能发现离线和队列停止；网口型号配置地址后可用ESC/POS实时状态检测")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(cfg.Printer.MonitorInterval)
+		defer ticker.Stop()
+
+		last := ""
+		for {
+			status := checkPrinterStatus(cfg)
+			setPrinterStatus(status)
+			if key := status.Key(); key != last {
+				last = key
+				onChange(status)
+			}
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// checkPrinterStatus 读取CUPS队列的 printer-state-reasons；配置了网口地址时
+// 再读取ESC/POS实时状态，两者合并
+func checkPrinterStatus(cfg *config.Config) *printerstatus.Status {
+	status := &printerstatus.Status{Checked: time.Now()}
+
+	if queue := sharedQueueName(cfg); queue != "" {
+		status.Printer = queue
+		if printer := queueAttributes(queue); printer != nil {
+			status.Sources = append(status.Sources, printerstatus.SourceIPP)
+			status.Reasons = printer.StateReasons
+			status.Add(printerstatus.FromStateReasons(printer.StateReasons)...)
+			if printer.State == ipp.PrinterStopped {
+				status.Add(printerstatus.Offline)
+			}
+		}
+	}
+
+	if addr := cfg.Printer.RawAddress; addr != "" {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, rawPort)
+		}
+		if status.Printer == "" {
+			status.Printer = "tcp://" + addr
+		}
+
+		rt, err := queryRealtimeStatus(addr)
+		switch {
+		case err == nil:
+			status.Sources = append(status.Sources, printerstatus.SourceESCPOS)
+			status.Add(printerstatus.FromRealtime(rt)...)
+		case isDialError(err):
+			// 网口打印机连不上就是离线
+			status.Sources = append(status.Sources, printerstatus.SourceESCPOS)
+			status.Add(printerstatus.Offline)
+		case len(status.Sources) == 0:
+			// 不支持实时状态且没有CUPS队列可参考
+			status.Error = err.Error()
+		}
+	}
+
+	if len(status.Sources) == 0 && status.Error == "" {
+		status.Error = fmt.Sprintf("CUPS中没有 %s 的打印队列，也没有配置 printer.raw_address", cfg.Printer.Model)
+	}
+	if cfg.Printer.RawAddress == "" && status.Error == "" {
+		status.Note = ippOnlyNote
+	}
+	status.Normalize()
+	return status
+}
+
+// dialError 无法连接网口打印机
+type dialError struct{ err error }
+
+func (e *dialError) Error() string { return e.err.Error() }
+
+func isDialError(err error) bool {
+	_, ok := err.(*dialError)
+	return ok
+}
+
+// queryRealtimeStatus 经TCP发送 DLE EOT 读取实时状态，不支持的打印机会超时
+func queryRealtimeStatus(addr string) (*escpos.RealtimeStatus, error) {
+	conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
+	if err != nil {
+		return nil, &dialError{err}
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	rt, err := escpos.QueryStatus(conn)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取ESC/POS实时状态: %v", err)
+	}
+	return rt, nil
+}
@@ -0,0 +1,174 @@
+package steps
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"macos-clodop-schoolpal/config"
+	"macos-clodop-schoolpal/escpos"
+	"macos-clodop-schoolpal/history"
+	"macos-clodop-schoolpal/ipp"
+)
+
+// rawFormat CUPS中不经过滤器、原样发给打印机的文档类型
+const rawFormat = "application/vnd.cups-raw"
+
+// rawPort 网口小票打印机的原始打印端口
+const rawPort = "9100"
+
+// PrintRawTestTicket 绕过Clodop，把ESC/POS测试小票直接发给打印机：配置了 printer.raw_address 时
+// 经TCP 9100发送，否则作为原始任务提交到本机CUPS队列。能出纸说明打印机和驱动正常，
+// 第9步失败的原因在网络或Clodop一侧
+func PrintRawTestTicket(cfg *config.Config) error {
+	target, send, err := RawTarget(cfg, "")
+	if err != nil {
+		return err
+	}
+
+	data, err := buildRawTestTicket(cfg, target, time.Now())
+	if err != nil {
+		return fmt.Errorf("生成测试小票失败: %v", err)
+	}
+
+	fmt.Printf("🧾 直接发送ESC/POS测试小票到 %s (%d字节)...\n", target, len(data))
+	start := time.Now()
+	record := history.Record{
+		Source:  history.SourceRaw,
+		Title:   "ESC/POS直连测试",
+		Printer: target,
+		Size:    len(data),
+		Result:  "printed",
+	}
+	defer func() {
+		record.LatencyMS = time.Since(start).Milliseconds()
+		history.Add(record)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	jobID, err := send(ctx, "ESC/POS直连测试", data)
+	if err != nil {
+		record.Result, record.Error = "failed", err.Error()
+		return fmt.Errorf("直连打印失败，请检查打印机电源、纸张和连接: %v", err)
+	}
+	record.JobID = jobID
+	fmt.Println("✅ 测试小票已发送。能正常出纸说明打印机正常，测试页失败的原因在VPN、转发或Clodop")
+	return nil
+}
+
+// RawSendFunc 发送ESC/POS指令，返回任务ID；经TCP发送时没有任务ID
+type RawSendFunc func(ctx context.Context, title string, data []byte) (string, error)
+
+// RawTarget 选择发送方式，返回目标说明和发送函数。queue不为空时提交到该CUPS队列；
+// 否则配置了 printer.raw_address 时经TCP 9100发送，再否则提交到第4步创建的队列。
+// 都不可用时返回错误，例如配置尚未完成
+func RawTarget(cfg *config.Config, queue string) (string, RawSendFunc, error) {
+	if queue == "" {
+		if addr := cfg.Printer.RawAddress; addr != "" {
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				addr = net.JoinHostPort(addr, rawPort)
+			}
+			return "tcp://" + addr, func(ctx context.Context, title string, data []byte) (string, error) {
+				return "", sendRawToSocket(ctx, addr, data)
+			}, nil
+		}
+		queue = sharedQueueName(cfg)
+	}
+
+	if queue == "" {
+		return "", nil, fmt.Errorf("CUPS中没有 %s 的打印队列，也没有配置 printer.raw_address", cfg.Printer.Model)
+	}
+	return "CUPS队列 " + queue, func(ctx context.Context, title string, data []byte) (string, error) {
+		return sendRawToQueue(ctx, queue, title, data)
+	}, nil
+}
+
+// sendRawToQueue 以原始格式提交到CUPS队列，绕过PPD过滤器，返回任务ID
+func sendRawToQueue(ctx context.Context, queue, title string, data []byte) (string, error) {
+	jobID, err := ipp.NewLocalClient().PrintJob(ctx, queue, title, rawFormat, data)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%d", queue, jobID), nil
+}
+
+// sendRawToSocket 经TCP直接写入网口打印机
+func sendRawToSocket(ctx context.Context, addr string, data []byte) error {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(30 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetWriteDeadline(deadline)
+	_, err = conn.Write(data)
+	return err
+}
+
+// buildRawTestTicket 生成测试小票：中文文本、代码页、条码、二维码，最后切纸
+func buildRawTestTicket(cfg *config.Config, target string, now time.Time) ([]byte, error) {
+	// 字体A宽12点，80mm纸可打印48列，58mm纸32列
+	columns := 48
+	if paper, err := cfg.PaperProfile(); err == nil && paper.Width < 70 {
+		columns = 32
+	}
+	rule := strings.Repeat("-", columns)
+
+	e := escpos.NewEncoder().Chinese(true)
+
+	e.Align(escpos.AlignCenter).Bold(true).Size(2, 2).Line("直连打印测试")
+	e.Size(1, 1).Bold(false).Line("ESC/POS · 不经过Clodop")
+	e.Align(escpos.AlignLeft).Line(rule)
+	e.Line("型号: " + cfg.Printer.Model)
+	e.Line("目标: " + target)
+	e.Line("时间: " + now.Format("2006-01-02 15:04:05"))
+	e.Line(rule)
+
+	// 代码页测试需要退出汉字模式，否则高位字节会被当作汉字
+	e.Chinese(false).Line("ASCII:")
+	for c := 0x20; c < 0x7F; c += columns {
+		end := c + columns
+		if end > 0x7F {
+			end = 0x7F
+		}
+		line := make([]byte, 0, columns)
+		for b := c; b < end; b++ {
+			line = append(line, byte(b))
+		}
+		e.Raw(line...).Raw('\n')
+	}
+	for _, page := range []struct {
+		name string
+		code byte
+	}{{"PC437", escpos.CodePagePC437}, {"WPC1252", escpos.CodePageWPC1252}} {
+		e.CodePage(page.code).Line("Code page " + page.name + ":")
+		for row := 0x80; row < 0x100; row += 32 {
+			for b := row; b < row+32; b++ {
+				e.Raw(byte(b))
+			}
+			e.Raw('\n')
+		}
+	}
+	e.CodePage(escpos.CodePagePC437).Chinese(true)
+	e.Line("中文: 汉字打印正常，￥12.50")
+	e.Line(rule)
+
+	e.Align(escpos.AlignCenter)
+	e.Barcode(escpos.Code128, now.Format("20060102150405"), 60)
+	e.QRCode(cfg.PrinterModel().DisplayName()+" "+now.Format(time.RFC3339), 6)
+	e.Line("看到条码和二维码说明打印机正常")
+	e.Feed(3).Cut(true)
+
+	if err := e.Err(); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
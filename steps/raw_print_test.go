@@ -0,0 +1,72 @@
+package steps
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"macos-clodop-schoolpal/config"
+	"macos-clodop-schoolpal/ipp"
+	"macos-clodop-schoolpal/ipp/stub"
+)
+
+func TestSendRawToQueue(t *testing.T) {
+	server := stub.NewServer([]ipp.Printer{{Name: "HPRT_TP80B", State: ipp.PrinterIdle, AcceptingJobs: true}})
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	t.Setenv("CUPS_SERVER", strings.TrimPrefix(server.URL(), "http://"))
+
+	cfg := &config.Config{}
+	cfg.Printer.Model = "HPRT_TP80B"
+	data, err := buildRawTestTicket(cfg, "CUPS队列 HPRT_TP80B", time.Date(2024, 5, 1, 9, 30, 0, 0, time.Local))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobID, err := sendRawToQueue(context.Background(), "HPRT_TP80B", "ESC/POS直连测试", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobID != "HPRT_TP80B-1" {
+		t.Errorf("任务ID %q", jobID)
+	}
+
+	// CUPS收到的数据必须与生成的ESC/POS指令逐字节一致，不能经过过滤器转换
+	if got := server.Document(1); !bytes.Equal(got, data) {
+		t.Errorf("提交的数据与测试小票不同: %d字节，期望 %d字节", len(got), len(data))
+	}
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("收到 %d 个请求", len(requests))
+	}
+	if format := requests[0].Group(ipp.TagOperation).String("document-format"); format != rawFormat {
+		t.Errorf("document-format = %q", format)
+	}
+
+	// 小票以初始化开头、半切结尾，中间有条码和二维码
+	if !bytes.HasPrefix(data, []byte{0x1B, 0x40, 0x1C, 0x26}) || !bytes.HasSuffix(data, []byte{0x1B, 0x64, 0x03, 0x1D, 0x56, 0x42, 0x00}) {
+		t.Errorf("小票开头或结尾错误: % X ... % X", data[:4], data[len(data)-7:])
+	}
+	for _, want := range [][]byte{{0x1D, 0x6B, 73}, {0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x51, 0x30}} {
+		if !bytes.Contains(data, want) {
+			t.Errorf("小票中没有 % X", want)
+		}
+	}
+}
+
+func TestSendRawToQueueNotFound(t *testing.T) {
+	server := stub.NewServer(nil)
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	t.Setenv("CUPS_SERVER", strings.TrimPrefix(server.URL(), "http://"))
+
+	if _, err := sendRawToQueue(context.Background(), "HPRT_TP80B", "ESC/POS直连测试", []byte{0x1B, 0x40}); err == nil {
+		t.Error("队列不存在时应返回错误")
+	}
+}
@@ -0,0 +1,186 @@
+package steps
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// routeInfo 到目标主机的路由信息
+type routeInfo struct {
+	Destination string // 命中的路由目标
+	Gateway     string // 网关
+	Interface   string // 出口网卡
+	SourceAddr  string // 系统选择的源地址
+}
+
+// vpnInterfaceInfo VPN连接使用的网卡信息
+type vpnInterfaceInfo struct {
+	InterfaceName string
+	Addresses     []string
+}
+
+// parseRouteGet 解析 `route -n get <host>` 的输出
+//
+// 输出格式示例:
+//
+//	   route to: 192.168.1.252
+//	destination: 192.168.1.0
+//	       mask: 255.255.255.0
+//	  interface: en0
+func parseRouteGet(output string) (*routeInfo, error) {
+	info := &routeInfo{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "destination":
+			info.Destination = value
+		case "gateway":
+			info.Gateway = value
+		case "interface":
+			info.Interface = value
+		}
+	}
+
+	if info.Interface == "" {
+		return nil, fmt.Errorf("路由表中没有到目标主机的出口网卡")
+	}
+	return info, nil
+}
+
+// parseVPNExtendedStatus 解析 `scutil --nc status <vpn>` 输出中的IPv4网卡信息
+//
+// 输出格式示例:
+//
+//	Connected
+//	Extended Status <dictionary> {
+//	  IPv4 : <dictionary> {
+//	    Addresses : <array> {
+//	      0 : 10.8.0.6
+//	    }
+//	    InterfaceName : ppp0
+//	  }
+//	}
+func parseVPNExtendedStatus(output string) (*vpnInterfaceInfo, error) {
+	info := &vpnInterfaceInfo{}
+	inIPv4 := false
+	inAddresses := false
+	depth := 0
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "IPv4 : <dictionary>"):
+			inIPv4 = true
+			depth = 0
+		case !inIPv4:
+			continue
+		case strings.HasPrefix(line, "Addresses : <array>"):
+			inAddresses = true
+		case line == "}":
+			if inAddresses {
+				inAddresses = false
+			} else if depth == 0 {
+				inIPv4 = false
+			} else {
+				depth--
+			}
+		case strings.HasSuffix(line, "{"):
+			depth++
+		case inAddresses:
+			if _, addr, ok := strings.Cut(line, ":"); ok {
+				info.Addresses = append(info.Addresses, strings.TrimSpace(addr))
+			}
+		case strings.HasPrefix(line, "InterfaceName"):
+			if _, name, ok := strings.Cut(line, ":"); ok {
+				info.InterfaceName = strings.TrimSpace(name)
+			}
+		}
+	}
+
+	if info.InterfaceName == "" {
+		return nil, fmt.Errorf("VPN状态中没有网卡信息")
+	}
+	return info, nil
+}
+
+// getRouteToHost 获取到目标主机的出口网卡和源地址
+func getRouteToHost(host string) (*routeInfo, error) {
+	cmd := exec.Command("route", "-n", "get", host)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("无法查询到 %s 的路由: %v", host, err)
+	}
+
+	info, err := parseRouteGet(string(output))
+	if err != nil {
+		return nil, err
+	}
+
+	// UDP "连接"不会发送数据包，只让内核选出源地址
+	conn, err := net.Dial("udp", net.JoinHostPort(host, "9"))
+	if err == nil {
+		info.SourceAddr = conn.LocalAddr().(*net.UDPAddr).IP.String()
+		conn.Close()
+	}
+
+	return info, nil
+}
+
+// getVPNInterface 获取VPN连接使用的网卡和地址
+func getVPNInterface(vpnName string) (*vpnInterfaceInfo, error) {
+	cmd := exec.Command("scutil", "--nc", "status", vpnName)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("无法获取VPN '%s' 的状态: %v", vpnName, err)
+	}
+	return parseVPNExtendedStatus(string(output))
+}
+
+// checkRouteThroughVPN 比较路由结果与VPN网卡，流量不走VPN时返回错误
+func checkRouteThroughVPN(host string, route *routeInfo, vpn *vpnInterfaceInfo) error {
+	if route.Interface != vpn.InterfaceName {
+		return fmt.Errorf("到远程主机 %s 的流量将经由 %s 发出（源地址 %s），而不是VPN网卡 %s。"+
+			"请检查VPN是否为该网段下发了路由，或本地网络是否与远程网段冲突（如同为192.168.1.0/24）",
+			host, route.Interface, route.SourceAddr, vpn.InterfaceName)
+	}
+
+	if route.SourceAddr != "" && len(vpn.Addresses) > 0 {
+		for _, addr := range vpn.Addresses {
+			if addr == route.SourceAddr {
+				return nil
+			}
+		}
+		return fmt.Errorf("到远程主机 %s 的源地址 %s 不是VPN地址 %v",
+			host, route.SourceAddr, vpn.Addresses)
+	}
+
+	return nil
+}
+
+// verifyVPNRoute 验证到远程主机的流量确实经过VPN
+func verifyVPNRoute(vpnName, host string) error {
+	vpn, err := getVPNInterface(vpnName)
+	if err != nil {
+		return err
+	}
+
+	route, err := getRouteToHost(host)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("🧭 到 %s 的路由: 网卡 %s, 源地址 %s (VPN网卡 %s, 地址 %v)\n",
+		host, route.Interface, route.SourceAddr, vpn.InterfaceName, vpn.Addresses)
+
+	if err := checkRouteThroughVPN(host, route, vpn); err != nil {
+		return err
+	}
+	setVPNInterface(vpn)
+	return nil
+}
@@ -0,0 +1,193 @@
+package steps
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// `route -n get 192.168.1.252`，全局VPN，默认路由经utun
+const routeUtunDefault = `   route to: 192.168.1.252
+destination: default
+       mask: default
+    gateway: 10.8.0.1
+  interface: utun3
+      flags: <UP,GATEWAY,DONE,STATIC,PRCLONING>
+ recvpipe  sendpipe  ssthresh  rtt,msec    rttvar  hopcount      mtu     expire
+       0         0         0         0         0         0      1400         0
+`
+
+// `route -n get 192.168.1.252`，本地网络同为192.168.1.0/24，流量直接从en0发出
+const routeEn0 = `   route to: 192.168.1.252
+destination: 192.168.1.0
+       mask: 255.255.255.0
+  interface: en0
+      flags: <UP,DONE,CLONING,STATIC>
+ recvpipe  sendpipe  ssthresh  rtt,msec    rttvar  hopcount      mtu     expire
+       0         0         0         0         0         0      1500         0
+`
+
+// `route -n get 10.20.0.15`，分流VPN只为远程网段下发了路由
+const routeSplitTunnel = `   route to: 10.20.0.15
+destination: 10.20.0.0
+       mask: 255.255.0.0
+    gateway: 10.8.0.1
+  interface: ppp0
+      flags: <UP,GATEWAY,DONE,STATIC,PRCLONING>
+ recvpipe  sendpipe  ssthresh  rtt,msec    rttvar  hopcount      mtu     expire
+       0         0         0         0         0         0      1280         0
+`
+
+// `route -n get` 找不到路由时只在标准错误输出一行
+const routeNotInTable = `route: writing to routing socket: not in table
+`
+
+// `scutil --nc status`，IKEv2连接
+const vpnIKEv2Connected = `Connected
+Extended Status <dictionary> {
+  IPv4 : <dictionary> {
+    Addresses : <array> {
+      0 : 10.8.0.6
+    }
+    InterfaceName : utun3
+    Router : 10.8.0.6
+    ServerAddress : 203.0.113.10
+  }
+  IPv6 : <dictionary> {
+    InterfaceName : utun3
+  }
+  Status : 2
+}
+`
+
+// `scutil --nc status`，L2TP连接，IPv4中还有DestAddresses数组
+const vpnL2TPConnected = `Connected
+Extended Status <dictionary> {
+  IPSec : <dictionary> {
+    ConnectTime : 5123
+    Status : 2
+  }
+  IPv4 : <dictionary> {
+    Addresses : <array> {
+      0 : 10.8.0.6
+    }
+    DestAddresses : <array> {
+      0 : 10.8.0.1
+    }
+    InterfaceName : ppp0
+    Router : 10.8.0.1
+    ServerAddress : 203.0.113.10
+  }
+  PPP : <dictionary> {
+    CommRemoteAddress : 203.0.113.10
+    ConnectTime : 5123
+    Status : 8
+  }
+  Status : 2
+}
+`
+
+// `scutil --nc status`，未连接
+const vpnDisconnected = `Disconnected
+Extended Status <dictionary> {
+  Status : 0
+}
+`
+
+func TestParseRouteGet(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   *routeInfo
+	}{
+		{"utun默认路由", routeUtunDefault, &routeInfo{Destination: "default", Gateway: "10.8.0.1", Interface: "utun3"}},
+		{"en0路由", routeEn0, &routeInfo{Destination: "192.168.1.0", Interface: "en0"}},
+		{"分流", routeSplitTunnel, &routeInfo{Destination: "10.20.0.0", Gateway: "10.8.0.1", Interface: "ppp0"}},
+		{"没有路由", routeNotInTable, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRouteGet(tt.output)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("期望错误，得到 %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("得到 %+v，期望 %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVPNExtendedStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   *vpnInterfaceInfo
+	}{
+		{"IKEv2", vpnIKEv2Connected, &vpnInterfaceInfo{InterfaceName: "utun3", Addresses: []string{"10.8.0.6"}}},
+		{"L2TP", vpnL2TPConnected, &vpnInterfaceInfo{InterfaceName: "ppp0", Addresses: []string{"10.8.0.6"}}},
+		{"未连接", vpnDisconnected, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseVPNExtendedStatus(tt.output)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("期望错误，得到 %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("得到 %+v，期望 %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRouteThroughVPN(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   string
+		vpn     string
+		source  string
+		wantErr string
+	}{
+		{"全局VPN", routeUtunDefault, vpnIKEv2Connected, "10.8.0.6", ""},
+		{"分流VPN", routeSplitTunnel, vpnL2TPConnected, "10.8.0.6", ""},
+		{"本地网段冲突", routeEn0, vpnIKEv2Connected, "192.168.1.20", "经由 en0 发出"},
+		{"源地址不是VPN地址", routeUtunDefault, vpnIKEv2Connected, "10.8.0.99", "不是VPN地址"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, err := parseRouteGet(tt.route)
+			if err != nil {
+				t.Fatal(err)
+			}
+			route.SourceAddr = tt.source
+			vpn, err := parseVPNExtendedStatus(tt.vpn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = checkRouteThroughVPN("192.168.1.252", route, vpn)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("意外的错误: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("错误 %v，期望包含 %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package steps
+
+import (
+	"fmt"
+	"sync"
+
+	"macos-clodop-schoolpal/clodop"
+	"macos-clodop-schoolpal/forward"
+	"macos-clodop-schoolpal/printerstatus"
+)
+
+// runState 本次运行中各步骤共享的结果，避免后续步骤和状态显示重复探测
+var runState struct {
+	sync.Mutex
+	clodop    *ClodopEndpoint
+	integrity *clodop.Integrity // 首次校验时的指纹，用于发现之后的变化
+	forward   *forward.Proxy    // http模式下的内置转发
+	vpn       *vpnInterfaceInfo // 第7步确认的VPN网卡
+	printer   *printerstatus.Status
+	warnings  []string
+}
+
+// CachedClodopEndpoint 返回已发现的Clodop服务地址，尚未发现时返回nil
+func CachedClodopEndpoint() *ClodopEndpoint {
+	runState.Lock()
+	defer runState.Unlock()
+	return runState.clodop
+}
+
+// setClodopEndpoint 缓存发现的Clodop服务地址
+func setClodopEndpoint(endpoint *ClodopEndpoint) {
+	runState.Lock()
+	defer runState.Unlock()
+	runState.clodop = endpoint
+}
+
+// CachedForwardProxy 返回内置的HTTP转发，使用socat时返回nil
+func CachedForwardProxy() *forward.Proxy {
+	runState.Lock()
+	defer runState.Unlock()
+	return runState.forward
+}
+
+// setForwardProxy 记录内置的HTTP转发
+func setForwardProxy(proxy *forward.Proxy) {
+	runState.Lock()
+	defer runState.Unlock()
+	runState.forward = proxy
+}
+
+// cachedVPNInterface 返回第7步确认的VPN网卡，尚未连接时返回nil
+func cachedVPNInterface() *vpnInterfaceInfo {
+	runState.Lock()
+	defer runState.Unlock()
+	return runState.vpn
+}
+
+// setVPNInterface 记录VPN网卡
+func setVPNInterface(vpn *vpnInterfaceInfo) {
+	runState.Lock()
+	defer runState.Unlock()
+	runState.vpn = vpn
+}
+
+// CurrentPrinterStatus 返回最近一次检查的打印机状态，监控未启动时返回nil
+func CurrentPrinterStatus() *printerstatus.Status {
+	runState.Lock()
+	defer runState.Unlock()
+	return runState.printer
+}
+
+// setPrinterStatus 记录打印机状态
+func setPrinterStatus(status *printerstatus.Status) {
+	runState.Lock()
+	defer runState.Unlock()
+	runState.printer = status
+}
+
+// TakeWarnings 取出并清空步骤执行中产生的警告，供界面显示
+func TakeWarnings() []string {
+	runState.Lock()
+	defer runState.Unlock()
+	warnings := runState.warnings
+	runState.warnings = nil
+	return warnings
+}
+
+// addWarning 记录一条不影响步骤成功、但需要用户注意的警告
+func addWarning(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Println("⚠️ " + msg)
+
+	runState.Lock()
+	defer runState.Unlock()
+	runState.warnings = append(runState.warnings, msg)
+}
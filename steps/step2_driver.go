@@ -1,14 +1,19 @@
 package steps
 
 import (
-	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"macos-clodop-schoolpal/clodop"
 	"macos-clodop-schoolpal/config"
 	"macos-clodop-schoolpal/utils"
+	"macos-clodop-schoolpal/xar"
 )
 
 // VerifyDriver 验证驱动文件
@@ -41,52 +46,70 @@ func VerifyDriver(cfg *config.Config) error {
 		return fmt.Errorf("驱动文件大小异常，可能文件损坏: %d bytes", fileInfo.Size())
 	}
 
-	fmt.Printf("✅ 驱动文件验证成功 (大小: %.2f MB)\n", float64(fileInfo.Size())/(1024*1024))
-
-	// 计算文件MD5校验和
+	// 计算SHA-256，与驱动清单核对
 	file, err := os.Open(driverPath)
 	if err != nil {
 		return fmt.Errorf("无法打开驱动文件: %v", err)
 	}
 	defer file.Close()
 
-	hash := md5.New()
+	hash := sha256.New()
 	if _, err := io.Copy(hash, file); err != nil {
 		return fmt.Errorf("无法计算驱动文件校验和: %v", err)
 	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	fmt.Printf("🔢 SHA-256: %s\n", checksum)
 
-	checksum := fmt.Sprintf("%x", hash.Sum(nil))
-
-	// 可以在这里添加已知的校验和验证
-	// 暂时只是记录校验和用于调试
-	_ = checksum
+	// 解析pkg的xar结构，截断或替换过的文件在这里被拒绝
+	pkg, err := xar.Open(driverPath)
+	if err != nil {
+		return fmt.Errorf("驱动文件不是有效的pkg文件: %v", err)
+	}
+	defer pkg.Close()
 
-	// 验证文件是否可读
-	file.Seek(0, 0)
-	buffer := make([]byte, 512)
-	_, err = file.Read(buffer)
+	info, err := pkg.ReadPackageInfo()
 	if err != nil {
-		return fmt.Errorf("驱动文件无法读取: %v", err)
+		return fmt.Errorf("驱动文件不是有效的pkg文件: %v", err)
+	}
+	fmt.Printf("📦 安装包: %s 版本 %s\n", info.Identifier, info.Version)
+
+	name := filepath.Base(driverPath)
+	manifest, ok := cfg.Printer.Drivers[cfg.Printer.DriverFile]
+	if !ok {
+		addWarning("驱动 %s 未在 printer.drivers 中登记，无法确认是预期的版本（SHA-256 %s，%s %s）", name, checksum, info.Identifier, info.Version)
+	} else if err := checkDriverManifest(manifest, checksum, info); err != nil {
+		return fmt.Errorf("驱动 %s 与 printer.drivers 中登记的不符:\n%v", name, err)
 	}
 
-	// 简单验证这是一个pkg文件（检查文件头）
-	if !isPKGFile(buffer) {
-		return fmt.Errorf("驱动文件格式无效，不是有效的pkg文件")
+	if pkg.Signed() {
+		signature, err := pkg.VerifySignature(nil)
+		if err != nil {
+			return fmt.Errorf("驱动安装包签名验证失败: %v", err)
+		}
+		fmt.Printf("🔏 签名: %s\n", signature.Signer)
+	} else {
+		addWarning("驱动安装包 %s 没有签名，无法确认来源", name)
 	}
 
+	// 所有检查都通过后才报告成功
+	fmt.Printf("✅ 驱动文件验证成功 (大小: %.2f MB)\n", float64(fileInfo.Size())/(1024*1024))
 	return nil
 }
 
-// isPKGFile 简单检查是否为pkg文件
-func isPKGFile(data []byte) bool {
-	// pkg文件通常以特定的magic bytes开始
-	// 这里做一个简单的检查
-	if len(data) < 4 {
-		return false
+// checkDriverManifest 逐项核对SHA-256、安装包标识和版本，列出所有不符的期望值和实际值
+func checkDriverManifest(manifest config.DriverManifest, checksum string, info *xar.PackageInfo) error {
+	var mismatches []string
+	check := func(name, expected, actual string) {
+		if expected != "" && expected != actual {
+			mismatches = append(mismatches, fmt.Sprintf("%s 期望 %s，实际 %s", name, expected, actual))
+		}
 	}
+	check("SHA-256", clodop.NormalizeFingerprint(manifest.SHA256), checksum)
+	check("安装包标识", manifest.PackageID, info.Identifier)
+	check("版本", manifest.Version, info.Version)
 
-	// pkg文件通常包含xar格式的标识
-	// 检查是否包含"xar!"的标识或其他pkg相关的标识
-	content := string(data)
-	return len(content) > 0 // 简化版本，只要文件不为空就认为有效
+	if len(mismatches) > 0 {
+		return errors.New(strings.Join(mismatches, "\n"))
+	}
+	return nil
 }
@@ -14,8 +14,9 @@ import (
 // InstallDriver 安装打印机驱动
 func InstallDriver(cfg *config.Config) error {
 	// 检查驱动是否已经安装
+	model := cfg.PrinterModel()
 	if isDriverInstalled(cfg) {
-		fmt.Println("HPRT驱动已安装，跳过此步骤")
+		fmt.Printf("%s驱动已安装，跳过此步骤\n", model.DisplayName())
 		return nil
 	}
 
@@ -36,7 +37,7 @@ func InstallDriver(cfg *config.Config) error {
 		return fmt.Errorf("无法获取驱动文件绝对路径: %v", err)
 	}
 
-	fmt.Printf("🔧 正在安装HPRT驱动: %s\n", filepath.Base(absPath))
+	fmt.Printf("🔧 正在安装%s驱动: %s\n", model.DisplayName(), filepath.Base(absPath))
 
 	// 使用AppleScript请求管理员权限并安装驱动
 	script := fmt.Sprintf(`do shell script "installer -pkg '%s' -target /" with administrator privileges`, absPath)
@@ -57,20 +58,20 @@ func InstallDriver(cfg *config.Config) error {
 		return err
 	}
 
-	fmt.Println("✅ HPRT驱动安装完成")
+	fmt.Printf("✅ %s驱动安装完成\n", model.DisplayName())
 	return nil
 }
 
-// isDriverInstalled 检查驱动是否已安装
+// isDriverInstalled 按型号的PPD规则检查驱动是否已安装
 func isDriverInstalled(cfg *config.Config) bool {
+	model := cfg.PrinterModel()
+
 	// 方法1: 检查系统打印机驱动列表
-	cmd := exec.Command("lpinfo", "-m")
-	output, err := cmd.Output()
-	if err == nil {
-		outputStr := string(output)
-		// 检查是否包含HPRT相关驱动
-		if strings.Contains(strings.ToLower(outputStr), "hprt") {
-			return true
+	if drivers, err := listCUPSDrivers(); err == nil {
+		for _, d := range drivers {
+			if model.MatchPPD(d.Name + " " + d.MakeAndModel) {
+				return true
+			}
 		}
 	}
 
@@ -82,15 +83,13 @@ func isDriverInstalled(cfg *config.Config) bool {
 	}
 
 	for _, path := range driverPaths {
-		if _, err := os.Stat(path); err == nil {
-			// 检查目录下是否有HPRT相关文件
-			entries, err := os.ReadDir(path)
-			if err == nil {
-				for _, entry := range entries {
-					if strings.Contains(strings.ToLower(entry.Name()), "hprt") {
-						return true
-					}
-				}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if model.MatchPPD(entry.Name()) {
+				return true
 			}
 		}
 	}
@@ -98,25 +97,11 @@ func isDriverInstalled(cfg *config.Config) bool {
 	return false
 }
 
-// verifyDriverInstallation 验证驱动是否安装成功
+// verifyDriverInstallation 验证安装后能找到该型号的PPD
 func verifyDriverInstallation(cfg *config.Config) error {
-	// 检查驱动是否在系统中注册
-	// 这里可以检查/usr/share/cups/drv/或其他系统目录
-
-	// 简单的验证方法：检查系统打印机驱动列表
-	cmd := exec.Command("lpinfo", "-m")
-	output, err := cmd.Output()
-	if err != nil {
-		// 如果lpinfo命令失败，不认为是错误，可能是权限问题
-		return nil
-	}
-
-	// 检查输出中是否包含HPRT相关的驱动
-	outputStr := string(output)
-	if len(outputStr) > 0 {
-		// 有输出说明CUPS系统正常工作
+	if isDriverInstalled(cfg) {
 		return nil
 	}
-
-	return nil
+	model := cfg.PrinterModel()
+	return fmt.Errorf("安装完成，但没有找到与 %s 匹配的PPD驱动（ppd_pattern: %s），请检查安装包是否适用于该型号", model.DisplayName(), model.PPDPattern)
 }
@@ -1,47 +1,48 @@
 package steps
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
+	"macos-clodop-schoolpal/catalog"
 	"macos-clodop-schoolpal/config"
+	"macos-clodop-schoolpal/ipp"
 )
 
 // DetectPrinter 检测打印机连接状态
 func DetectPrinter(cfg *config.Config) error {
+	model := cfg.PrinterModel()
+
 	// 等待一段时间让系统识别打印机
 	time.Sleep(2 * time.Second)
 
-	// 检查USB设备中是否有打印机
+	// 按型号的USB厂商和产品ID查找设备
 	cmd := exec.Command("system_profiler", "SPUSBDataType")
 	output, err := cmd.Output()
 	if err != nil {
 		return fmt.Errorf("无法获取USB设备信息: %v", err)
 	}
-
-	outputStr := string(output)
-
-	// 检查是否包含HPRT或相关打印机设备
-	if strings.Contains(strings.ToLower(outputStr), "hprt") ||
-		strings.Contains(strings.ToLower(outputStr), "printer") {
-		// 找到了打印机设备
+	if name := findUSBPrinter(string(output), model); name != "" {
+		fmt.Printf("🔌 USB设备: %s\n", name)
 	} else {
-		// 即使没有检测到，也不算失败，可能是检测方法的问题
+		// 没有检测到不算失败，网口打印机或已有的CUPS队列仍可使用
+		fmt.Printf("⚠️ USB设备中没有找到 %s，请检查打印机电源和USB连接\n", model.DisplayName())
 	}
 
-	// 检查CUPS系统中的打印机
-	cmd = exec.Command("lpstat", "-p")
-	output, err = cmd.Output()
+	// 通过IPP检查CUPS系统中的打印机，不受系统语言影响
+	printer, err := findCUPSPrinter(model)
 	if err != nil {
-		// lpstat命令失败不算致命错误
+		// 查询CUPS失败不算致命错误
+		fmt.Printf("⚠️ 无法查询CUPS打印机: %v\n", err)
 		return nil
 	}
-
-	outputStr = string(output)
-	if strings.Contains(strings.ToLower(outputStr), "hprt") {
+	if printer != nil {
 		// 找到了CUPS中的打印机
+		fmt.Printf("✅ CUPS中已有打印机: %s (%s, %s)\n", printer.Name, printer.MakeAndModel, printer.StateName())
 		return nil
 	}
 
@@ -49,11 +50,68 @@ func DetectPrinter(cfg *config.Config) error {
 	return addPrinterToCUPS(cfg)
 }
 
-// addPrinterToCUPS 添加打印机到CUPS系统
-func addPrinterToCUPS(cfg *config.Config) error {
-	// 这里可以尝试自动添加打印机
-	// 由于每个打印机的具体连接方式不同，这里先返回成功
-	// 实际使用时可以根据具体的打印机型号进行配置
+// findUSBPrinter 在 system_profiler SPUSBDataType 的输出中查找该型号的设备，返回设备名称。
+// 每个设备先列出名称，再列出 Product ID 和 Vendor ID；型号未配置厂商ID时按名称和厂商关键词识别
+func findUSBPrinter(output string, model catalog.Model) string {
+	var name string
+	var product catalog.USBID
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		key, value, ok := strings.Cut(line, ":")
+		switch {
+		case !ok:
+			continue
+		case value == "":
+			name, product = key, 0
+		case key == "Product ID":
+			product = parseUSBID(value)
+		case key == "Vendor ID":
+			vendor := parseUSBID(value)
+			if model.MatchUSB(vendor, product) {
+				return name
+			}
+			// 如 "0x20d1  (HPRT)"
+			if model.USBVendorID == 0 && model.MatchName(name+" "+value) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// parseUSBID 解析 "0x7007" 或 "0x20d1  (HPRT)"，无法解析时返回0
+func parseUSBID(value string) catalog.USBID {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(fields[0], "0x"), 16, 16)
+	if err != nil {
+		return 0
+	}
+	return catalog.USBID(n)
+}
+
+// findCUPSPrinter 查找名称、型号描述带有该型号厂商关键词或符合其PPD规则的CUPS打印机，
+// 配置的队列优先，没有时返回nil
+func findCUPSPrinter(model catalog.Model) (*ipp.Printer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	return nil
+	printers, err := ipp.NewLocalClient().Printers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *ipp.Printer
+	for i := range printers {
+		p := &printers[i]
+		if catalog.Normalize(p.Name) == catalog.Normalize(model.Name) {
+			return p, nil
+		}
+		if found == nil && (model.MatchName(p.Name) || model.MatchName(p.MakeAndModel) || model.MatchPPD(p.MakeAndModel)) {
+			found = p
+		}
+	}
+	return found, nil
 }
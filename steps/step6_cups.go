@@ -1,6 +1,7 @@
 package steps
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"macos-clodop-schoolpal/config"
+	"macos-clodop-schoolpal/ipp"
 )
 
 // ConfigureCUPS 配置CUPS打印服务
@@ -16,11 +18,11 @@ func ConfigureCUPS(cfg *config.Config) error {
 	fmt.Println("🖨️ ========== CUPS打印服务配置 ==========")
 
 	// 检查是否已经配置过
-	if isCUPSConfigured() {
+	if isCUPSConfigured(cfg) {
 		fmt.Println("✅ CUPS已经配置完成")
 
 		// 显示详细状态信息
-		err := showCUPSStatus()
+		err := showCUPSStatus(cfg)
 		if err != nil {
 			fmt.Printf("⚠️ 获取CUPS状态时出错: %v\n", err)
 		}
@@ -38,32 +40,29 @@ func ConfigureCUPS(cfg *config.Config) error {
 		fmt.Println("✅ CUPS服务启动成功")
 	}
 
-	fmt.Println("🔧 配置CUPS共享设置...")
-
-	// 使用osascript执行需要管理员权限的命令
-	script := `
-	do shell script "cupsctl WebInterface=yes" with administrator privileges
-	do shell script "cupsctl --remote-admin --remote-any --share-printers" with administrator privileges
-	do shell script "launchctl stop org.cups.cupsd; launchctl start org.cups.cupsd" with administrator privileges
-	`
+	// 只向配置的地址共享，不再使用 --remote-any 对所在网络全部开放
+	fmt.Printf("🔧 配置CUPS共享范围: %s\n", strings.Join(cfg.CUPS.AllowFrom, ", "))
+	if cfg.CUPS.RemoteAdmin {
+		fmt.Println("⚠️ 已允许上述地址远程管理CUPS")
+	}
 
-	cmd := exec.Command("osascript", "-e", script)
-	output, err := cmd.CombinedOutput()
+	backup, err := applyCUPSSharing(cfg)
 	if err != nil {
-		if strings.Contains(string(output), "User canceled") {
-			return fmt.Errorf("用户取消了权限授权")
-		}
-		return fmt.Errorf("配置CUPS失败: %v\n输出: %s", err, string(output))
+		return fmt.Errorf("配置CUPS失败: %v", err)
 	}
 
-	fmt.Println("✅ CUPS配置完成")
-
 	// 等待服务重启
 	fmt.Println("⏳ 等待CUPS服务重启...")
 	time.Sleep(3 * time.Second)
 
+	logCUPSChanges(backup)
+	if err := verifyCUPSSharing(cfg); err != nil {
+		return fmt.Errorf("CUPS共享范围与配置不符: %v\n可在\"CUPS备份\"中恢复 %s", err, backup.ID)
+	}
+	fmt.Println("✅ CUPS配置完成")
+
 	// 显示详细状态信息
-	err = showCUPSStatus()
+	err = showCUPSStatus(cfg)
 	if err != nil {
 		fmt.Printf("⚠️ 获取CUPS状态时出错: %v\n", err)
 	}
@@ -72,25 +71,29 @@ func ConfigureCUPS(cfg *config.Config) error {
 }
 
 // showCUPSStatus 显示CUPS详细状态信息
-func showCUPSStatus() error {
+func showCUPSStatus(cfg *config.Config) error {
 	fmt.Println("\n📊 ========== CUPS状态信息 ==========")
 
-	// 1. 获取本机IP地址
+	// 1. 获取本机局域网IP地址，仅用于远程管理
 	localIP, err := getLocalIP()
 	if err != nil {
 		fmt.Printf("⚠️ 无法获取本机IP: %v\n", err)
 		localIP = "localhost"
 	} else {
-		fmt.Printf("🌐 本机IP地址: %s\n", localIP)
+		fmt.Printf("🌐 本机局域网地址: %s\n", localIP)
 	}
 
-	// 2. CUPS管理界面
-	cupsAdminURL := fmt.Sprintf("http://%s:631", localIP)
+	// 2. CUPS管理界面，未开启远程管理时只能从本机访问
+	cupsAdminURL := "http://localhost:631"
+	if cfg.CUPS.RemoteAdmin {
+		cupsAdminURL = fmt.Sprintf("http://%s:631", localIP)
+	}
 	fmt.Printf("🖥️ CUPS管理界面: %s\n", cupsAdminURL)
+	fmt.Printf("🔒 允许访问共享打印机: %s\n", strings.Join(cfg.CUPS.AllowFrom, ", "))
 
 	// 3. 测试CUPS管理界面是否可访问
 	fmt.Printf("🔍 测试CUPS管理界面访问性...")
-	if testCUPSAccess(localIP) {
+	if testCUPSAccess("localhost") {
 		fmt.Println(" ✅ 可访问")
 	} else {
 		fmt.Println(" ❌ 无法访问")
@@ -101,22 +104,19 @@ func showCUPSStatus() error {
 	if err != nil {
 		fmt.Printf("⚠️ 获取打印机列表失败: %v\n", err)
 	} else if len(printers) > 0 {
-		fmt.Println("🖨️ 已安装的打印机:")
-		for _, printer := range printers {
-			printerURL := fmt.Sprintf("ipp://%s:631/printers/%s", localIP, printer)
-			fmt.Printf("   • %s\n", printer)
-			fmt.Printf("     📡 共享地址: %s\n", printerURL)
-			fmt.Printf("     🪟 Windows添加: http://%s:631/printers/%s\n", localIP, printer)
-		}
+		fmt.Printf("🖨️ 已安装的打印机: %s\n", strings.Join(printers, ", "))
 	} else {
 		fmt.Println("ℹ️ 暂无已安装的打印机")
 	}
 
+	// Windows电脑经VPN访问本机，共享地址必须是VPN地址而不是局域网地址
+	reportSharedQueue(cfg)
+
 	// 5. 提供操作提示
 	fmt.Println("\n💡 ========== 使用提示 ==========")
 	fmt.Printf("1. 在浏览器中打开: %s\n", cupsAdminURL)
 	fmt.Println("2. 在CUPS管理界面中添加和管理打印机")
-	fmt.Println("3. Windows电脑添加网络打印机时使用上述共享地址")
+	fmt.Println("3. Windows电脑添加网络打印机时使用上述ipp://共享地址")
 	fmt.Println("4. 确保防火墙允许631端口访问")
 
 	return nil
@@ -187,38 +187,26 @@ func testCUPSAccess(ip string) bool {
 	return resp.StatusCode == 200
 }
 
-// getInstalledPrinters 获取已安装的打印机列表
+// getInstalledPrinters 通过IPP获取已安装的打印机列表
 func getInstalledPrinters() ([]string, error) {
-	cmd := exec.Command("lpstat", "-p")
-	output, err := cmd.Output()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	printers, err := ipp.NewLocalClient().Printers(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	var printers []string
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "printer ") {
-			// 格式: printer PrinterName is idle. ...
-			parts := strings.Fields(line)
-			if len(parts) >= 2 {
-				printers = append(printers, parts[1])
-			}
-		}
+	names := make([]string, 0, len(printers))
+	for _, p := range printers {
+		names = append(names, p.Name)
 	}
-
-	return printers, nil
+	return names, nil
 }
 
-// OpenCUPSAdmin 打开CUPS管理界面
+// OpenCUPSAdmin 打开CUPS管理界面，管理页面默认只允许本机访问
 func OpenCUPSAdmin() error {
-	localIP, err := getLocalIP()
-	if err != nil {
-		localIP = "localhost"
-	}
-
-	url := fmt.Sprintf("http://%s:631", localIP)
+	url := "http://localhost:631"
 	fmt.Printf("🌐 正在打开CUPS管理界面: %s\n", url)
 
 	cmd := exec.Command("open", url)
@@ -246,17 +234,39 @@ func startCUPS() error {
 	return nil
 }
 
-// isCUPSConfigured 检查CUPS是否已经配置
-func isCUPSConfigured() bool {
-	// 检查WebInterface是否启用
+// isCUPSConfigured 检查CUPS是否已按配置的范围共享
+func isCUPSConfigured(cfg *config.Config) bool {
+	settings, err := readCUPSSettings()
+	if err != nil || settings["WebInterface"] != "yes" {
+		return false
+	}
+	if err := verifyCUPSSharing(cfg); err != nil {
+		fmt.Printf("ℹ️ %v，将重新配置\n", err)
+		return false
+	}
+	return true
+}
+
+// readCUPSSettings 读取cupsctl输出的 key=value 设置，键名不随系统语言变化
+func readCUPSSettings() (map[string]string, error) {
 	cmd := exec.Command("cupsctl")
 	output, err := cmd.Output()
 	if err != nil {
-		return false
+		return nil, fmt.Errorf("无法读取CUPS设置: %v", err)
 	}
+	return parseCUPSSettings(string(output)), nil
+}
 
-	configOutput := string(output)
-	return strings.Contains(configOutput, "WebInterface=yes")
+// parseCUPSSettings 解析cupsctl的输出，如 _share_printers=1
+func parseCUPSSettings(output string) map[string]string {
+	settings := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && key != "" {
+			settings[key] = value
+		}
+	}
+	return settings
 }
 
 // restartCUPS 重启CUPS服务
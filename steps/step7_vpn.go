@@ -45,7 +45,7 @@ func ConnectVPN(cfg *config.Config) error {
 	// 检查VPN是否已连接
 	if isVPNConnected(actualVPNName) {
 		fmt.Printf("✅ VPN '%s' 已连接，跳过此步骤\n", actualVPNName)
-		return nil
+		return finishVPN(cfg, actualVPNName)
 	}
 
 	fmt.Printf("🔗 正在连接VPN '%s'...\n", actualVPNName)
@@ -68,7 +68,9 @@ func ConnectVPN(cfg *config.Config) error {
 		if strings.Contains(status, "Connected") {
 			fmt.Println()
 			fmt.Printf("✅ VPN '%s' 连接成功\n", actualVPNName)
-			return nil
+
+			// 已连接不代表到远程主机的流量会走VPN
+			return finishVPN(cfg, actualVPNName)
 		}
 
 		// 检查是否有连接错误
@@ -82,6 +84,15 @@ func ConnectVPN(cfg *config.Config) error {
 	return fmt.Errorf("VPN连接超时，请检查VPN配置和网络状况")
 }
 
+// finishVPN 确认到远程主机的流量经过VPN，再检查共享打印机能否通过VPN地址访问
+func finishVPN(cfg *config.Config, vpnName string) error {
+	if err := verifyVPNRoute(vpnName, cfg.Network.RemoteHost); err != nil {
+		return err
+	}
+	reportSharedQueue(cfg)
+	return nil
+}
+
 // getAvailableVPNs 获取所有可用的VPN连接
 func getAvailableVPNs() ([]string, error) {
 	// 使用networksetup获取VPN列表
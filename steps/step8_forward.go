@@ -3,10 +3,14 @@ package steps
 import (
 	"context"
 	"fmt"
+	"net"
 	"os/exec"
+	"strings"
 	"time"
 
 	"macos-clodop-schoolpal/config"
+	"macos-clodop-schoolpal/forward"
+	"macos-clodop-schoolpal/utils"
 )
 
 // StartPortForward 启动端口转发服务
@@ -15,6 +19,10 @@ func StartPortForward(cfg *config.Config) error {
 	remoteHost := cfg.Network.RemoteHost
 	remotePort := cfg.Network.RemotePort
 
+	if cfg.Network.ForwardMode == config.ForwardModeHTTP {
+		return startHTTPForward(cfg)
+	}
+
 	// 获取socat路径（优先使用预装版本）
 	socatPath, err := GetSocatPath()
 	if err != nil {
@@ -79,3 +87,55 @@ func stopExistingPortForward(port string) {
 		exec.Command("kill", "-9", pid).Run()
 	}
 }
+
+// startHTTPForward 使用内置的HTTP感知转发，在本地缓存Clodop脚本
+func startHTTPForward(cfg *config.Config) error {
+	localPort := cfg.Network.LocalPort
+	upstream := net.JoinHostPort(cfg.Network.RemoteHost, cfg.Network.RemotePort)
+
+	// 重新执行时先关闭本进程内的转发，避免下面按端口结束进程时误伤自己
+	if previous := CachedForwardProxy(); previous != nil {
+		previous.Close()
+		setForwardProxy(nil)
+	}
+	if isPortInUse(localPort) {
+		fmt.Printf("⚠️ 端口 %s 已被占用，尝试停止现有服务...\n", localPort)
+		stopExistingPortForward(localPort)
+	}
+
+	opts := forward.Options{
+		Listen:     net.JoinHostPort("127.0.0.1", localPort),
+		Upstream:   upstream,
+		CacheTTL:   cfg.Network.ScriptCacheTTL,
+		ScriptPins: cfg.Clodop.Pin.ScriptSHA256,
+	}
+	if cfg.Network.ForwardTLSCert != "" {
+		certPath, err := utils.GetResourcePath(cfg.Network.ForwardTLSCert)
+		if err != nil {
+			return fmt.Errorf("无法定位转发证书: %v", err)
+		}
+		keyPath, err := utils.GetResourcePath(cfg.Network.ForwardTLSKey)
+		if err != nil {
+			return fmt.Errorf("无法定位转发私钥: %v", err)
+		}
+		opts.TLSCert, opts.TLSKey = certPath, keyPath
+	}
+
+	proxy, err := forward.New(opts)
+	if err != nil {
+		return err
+	}
+	if err := proxy.Start(); err != nil {
+		return fmt.Errorf("启动端口转发失败: %v", err)
+	}
+	setForwardProxy(proxy)
+
+	fmt.Printf("🔗 启动HTTP转发: %s -> %s (脚本缓存 %v)\n", opts.Listen, proxy.Upstream(), opts.CacheTTL)
+	if opts.TLSCert == "" && strings.HasPrefix(proxy.Upstream(), "https://") {
+		// 测试页和网页都优先使用HTTPS，此时所有请求都原样转发，http模式等同于tcp模式
+		fmt.Println("⚠️ 远程Clodop使用HTTPS但未配置forward_tls_cert，HTTPS连接将原样转发")
+		addWarning("HTTP转发模式下未配置 network.forward_tls_cert，远程Clodop使用HTTPS，脚本缓存和打印记录都不会生效")
+	}
+	fmt.Printf("✅ 端口转发已启动，缓存统计: http://%s%s\n", opts.Listen, forward.StatsPath)
+	return nil
+}
@@ -0,0 +1,59 @@
+package steps
+
+import (
+	"fmt"
+	"time"
+
+	"macos-clodop-schoolpal/clodop"
+	"macos-clodop-schoolpal/config"
+	"macos-clodop-schoolpal/layout"
+	"macos-clodop-schoolpal/utils"
+)
+
+// testPrintJob 按纸张规格和测试页模板生成测试打印任务，浏览器和Go客户端共用
+func testPrintJob(cfg *config.Config, clodopPort string) (*clodop.Job, error) {
+	profile, err := cfg.PaperProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	tpl, err := testTemplate(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := map[string]string{
+		"title": cfg.TestPage.Title,
+		"time":  time.Now().Format("2006-01-02 15:04:05"),
+		"model": cfg.Printer.Model,
+		"paper": profile.Name,
+		"port":  clodopPort,
+	}
+	return tpl.Render(profile, vars), nil
+}
+
+// testTemplate 读取配置的测试页模板，未配置时由标题和字段生成默认模板
+func testTemplate(cfg *config.Config) (*layout.Template, error) {
+	if cfg.TestPage.Template != "" {
+		path, err := utils.GetResourcePath(cfg.TestPage.Template)
+		if err != nil {
+			return nil, fmt.Errorf("无法定位测试页模板: %v", err)
+		}
+		return layout.LoadTemplate(path)
+	}
+
+	tpl := &layout.Template{Title: "${title}"}
+	tpl.Items = append(tpl.Items,
+		layout.Item{Type: layout.ItemText, Text: "${title}", Align: "center", FontSize: 14, Bold: true},
+		layout.Item{Type: layout.ItemLine},
+	)
+	for _, field := range cfg.TestPage.Fields {
+		tpl.Items = append(tpl.Items, layout.Item{Type: layout.ItemText, Text: field})
+	}
+	tpl.Items = append(tpl.Items,
+		layout.Item{Type: layout.ItemLine},
+		layout.Item{Type: layout.ItemText, Text: "测试时间: ${time}"},
+		layout.Item{Type: layout.ItemText, Text: "型号: ${model}  纸张: ${paper}"},
+	)
+	return tpl, nil
+}
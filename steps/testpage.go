@@ -0,0 +1,136 @@
+package steps
+
+import (
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"macos-clodop-schoolpal/clodop"
+	"macos-clodop-schoolpal/config"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// testPageTemplate 浏览器中执行测试打印的页面
+var testPageTemplate = template.Must(template.ParseFS(templateFS, "templates/test_page.html"))
+
+// testPageData 测试页模板参数
+type testPageData struct {
+	Title    string
+	Port     string
+	Printer  string      // 目标打印机名称的正则，空表示使用默认打印机
+	Getter   string      // 优先使用的获取函数，空表示依次尝试
+	Priority bool        // 是否优先加载 CLodopfuncs.js?priority=1
+	PrintJS  template.JS // 由打印任务生成的LODOP调用
+}
+
+// newTestPageData 根据配置生成测试页参数，flavour为按远程版本选出的写法，nil时使用兼容所有版本的默认顺序
+func newTestPageData(cfg *config.Config, clodopPort string, flavour *config.ClodopFlavour) (testPageData, error) {
+	job, err := testPrintJob(cfg, clodopPort)
+	if err != nil {
+		return testPageData{}, fmt.Errorf("无法生成测试打印内容: %v", err)
+	}
+
+	// 打印机列表只能在浏览器中经LODOP获取，由页面按配置的名称匹配
+	pattern := ""
+	if cfg.Printer.RemoteName != "" {
+		pattern = clodop.PrinterPattern(cfg.Printer.RemoteName).String()
+	}
+
+	data := testPageData{
+		Title:    cfg.TestPage.Title,
+		Port:     clodopPort,
+		Printer:  pattern,
+		Priority: true,
+		PrintJS:  template.JS(job.JS("LODOP")),
+	}
+	if flavour != nil {
+		data.Getter = flavour.Getter
+		data.Priority = flavour.Priority
+	}
+	return data, nil
+}
+
+// testPageServer 只在本机回环地址上提供测试页的临时服务
+type testPageServer struct {
+	server   *http.Server
+	URL      string
+	outcomes chan testPrintOutcome
+}
+
+// startTestPageServer 在随机端口启动测试页服务，路径带随机令牌防止被其他页面猜到
+func startTestPageServer(data testPageData) (*testPageServer, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("无法生成测试页令牌: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("无法启动测试服务器: %v", err)
+	}
+
+	s := &testPageServer{
+		URL:      fmt.Sprintf("http://127.0.0.1:%d/%s/test", listener.Addr().(*net.TCPAddr).Port, token),
+		outcomes: make(chan testPrintOutcome, 1),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+token+"/test", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := testPageTemplate.Execute(w, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/"+token+"/result", s.handleResult)
+
+	s.server = &http.Server{Handler: mux}
+	go s.server.Serve(listener)
+
+	return s, nil
+}
+
+// handleResult 接收测试页回传的打印结果
+func (s *testPageServer) handleResult(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var outcome testPrintOutcome
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&outcome); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case s.outcomes <- outcome:
+	default:
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Close 关闭测试页服务
+func (s *testPageServer) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	s.server.Shutdown(ctx)
+}
+
+// randomToken 生成随机路径令牌
+func randomToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,101 @@
+package steps
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"macos-clodop-schoolpal/clodop"
+	"macos-clodop-schoolpal/config"
+)
+
+func TestTestPrintOutcomeErr(t *testing.T) {
+	tests := []struct {
+		name    string
+		outcome testPrintOutcome
+		wantErr bool
+	}{
+		{"脚本未加载", testPrintOutcome{Error: "所有Clodop URL都加载失败"}, true},
+		{"没有LODOP对象", testPrintOutcome{ScriptLoaded: true, Error: "getCLodop/getLodop均未定义"}, true},
+		{"打印异常", testPrintOutcome{ScriptLoaded: true, LodopOK: true, Error: "PRINT is not a function"}, true},
+		{"PRINT返回false", testPrintOutcome{ScriptLoaded: true, LodopOK: true, PrintResult: "false"}, true},
+		{"只有任务号未确认", testPrintOutcome{ScriptLoaded: true, LodopOK: true, PrintResult: "mock_1"}, true},
+		{"On_Return返回失败", testPrintOutcome{ScriptLoaded: true, LodopOK: true, PrintResult: "false", Confirmed: true}, true},
+		{"On_Return确认", testPrintOutcome{ScriptLoaded: true, LodopOK: true, PrintResult: "true", Confirmed: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.outcome.err("HPRT*"); (err != nil) != tt.wantErr {
+				t.Errorf("err() = %v", err)
+			}
+		})
+	}
+}
+
+func TestTestPrintOutcomePrinterMissing(t *testing.T) {
+	outcome := testPrintOutcome{
+		ScriptLoaded:   true,
+		LodopOK:        true,
+		Printers:       []string{"Microsoft Print to PDF", "Fax"},
+		PrinterMissing: true,
+	}
+	var notFound *clodop.PrinterNotFoundError
+	if err := outcome.err("HPRT*"); !errors.As(err, &notFound) {
+		t.Fatalf("err() = %v", err)
+	}
+	if notFound.Name != "HPRT*" || len(notFound.Printers) != 2 {
+		t.Errorf("%+v", notFound)
+	}
+}
+
+func TestTestPageServer(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Printer.Model = "HPRT_TP80B"
+	cfg.Printer.RemoteName = "HPRT TP80B*"
+	cfg.TestPage.Title = "测试页"
+	data, err := newTestPageData(cfg, "8443", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := startTestPageServer(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// 页面中带有按配置名称生成的打印机正则
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), `printer: "^HPRT TP80B.*$"`) {
+		t.Errorf("页面中没有打印机正则")
+	}
+
+	// 页面找不到打印机时回传的结果
+	resultURL := strings.TrimSuffix(server.URL, "test") + "result"
+	body := `{"scriptLoaded":true,"lodopOk":true,"printers":["Fax"],"printerMissing":true,"printResult":"","confirmed":false,"error":""}`
+	resp, err = http.Post(resultURL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("回传结果返回 %d", resp.StatusCode)
+	}
+
+	select {
+	case outcome := <-server.outcomes:
+		var notFound *clodop.PrinterNotFoundError
+		if err := outcome.err(cfg.Printer.RemoteName); !errors.As(err, &notFound) || notFound.Printers[0] != "Fax" {
+			t.Errorf("err() = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("没有收到结果")
+	}
+}
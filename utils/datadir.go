@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// appDataName 程序数据目录名
+const appDataName = "macos-clodop-schoolpal"
+
+// GetDataDir 获取程序数据目录 ~/Library/Application Support/macos-clodop-schoolpal[/sub...]，
+// 不存在时创建。打印队列等需要在重启后保留的数据都放在这里。
+func GetDataDir(sub ...string) (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(append([]string{base, appDataName}, sub...)...)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
@@ -0,0 +1,94 @@
+package xar
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// PackageInfo 安装包的标识和版本
+type PackageInfo struct {
+	Identifier string // 如 com.hprt.pkg.printerdriver
+	Version    string
+	Source     string // 从哪个文件读出，Distribution 或 xxx.pkg/PackageInfo
+}
+
+// ReadPackageInfo 读取安装包的标识和版本。
+// 产品包(productbuild)以Distribution中的 product 或第一个 pkg-ref 为准，组件包(pkgbuild)读取根目录的PackageInfo；
+// 两者都没有时不是安装包
+func (r *Reader) ReadPackageInfo() (*PackageInfo, error) {
+	var infos []*File
+	var distribution *File
+	for _, f := range r.Files {
+		switch {
+		case f.Name == "Distribution":
+			distribution = f
+		case path.Base(f.Name) == "PackageInfo" && strings.Count(f.Name, "/") <= 1:
+			infos = append(infos, f)
+		}
+	}
+	if distribution == nil && len(infos) == 0 {
+		return nil, errors.New("归档中没有Distribution或PackageInfo，不是macOS安装包")
+	}
+
+	if distribution != nil {
+		data, err := r.ReadFile(distribution)
+		if err != nil {
+			return nil, err
+		}
+		info, err := parseDistribution(data)
+		if err != nil {
+			return nil, fmt.Errorf("Distribution: %v", err)
+		}
+		if info != nil {
+			return info, nil
+		}
+	}
+
+	for _, f := range infos {
+		data, err := r.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var doc struct {
+			Identifier string `xml:"identifier,attr"`
+			Version    string `xml:"version,attr"`
+		}
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		if doc.Identifier != "" {
+			return &PackageInfo{Identifier: doc.Identifier, Version: doc.Version, Source: f.Name}, nil
+		}
+	}
+	return nil, errors.New("安装包中没有标识(identifier)")
+}
+
+// parseDistribution 从Distribution中读取标识和版本，都没有时返回nil
+func parseDistribution(data []byte) (*PackageInfo, error) {
+	var doc struct {
+		Product struct {
+			ID      string `xml:"id,attr"`
+			Version string `xml:"version,attr"`
+		} `xml:"product"`
+		PkgRefs []struct {
+			ID      string `xml:"id,attr"`
+			Version string `xml:"version,attr"`
+		} `xml:"pkg-ref"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Product.ID != "" {
+		return &PackageInfo{Identifier: doc.Product.ID, Version: doc.Product.Version, Source: "Distribution"}, nil
+	}
+	// choice中的 pkg-ref 只有id，带版本的才是实际安装的组件
+	for _, ref := range doc.PkgRefs {
+		if ref.ID != "" && ref.Version != "" {
+			return &PackageInfo{Identifier: ref.ID, Version: ref.Version, Source: "Distribution"}, nil
+		}
+	}
+	return nil, nil
+}
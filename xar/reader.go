@@ -0,0 +1,407 @@
+// Package xar 读取macOS安装包(.pkg)使用的xar归档：校验文件头和目录(TOC)的校验和，
+// 列出并读取其中的文件，验证签名证书链。
+//
+// 文件布局: 28字节以上的文件头 | zlib压缩的XML目录 | 堆(heap)。目录中的偏移都相对于堆的起点。
+package xar
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/zlib"
+	"crypto"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// Magic 文件头开头的 "xar!"
+const Magic = 0x78617221
+
+// headerSize 文件头最小长度
+const headerSize = 28
+
+// 读取上限，防止损坏的文件声明超大长度
+const (
+	maxTOCSize  = 16 << 20
+	maxFileSize = 64 << 20
+)
+
+// 文件头中的校验算法
+const (
+	checksumNone  = 0
+	checksumSHA1  = 1
+	checksumMD5   = 2
+	checksumOther = 3 // 算法名称写在文件头第28字节之后
+)
+
+// Header xar文件头，字段均为大端序
+type Header struct {
+	Magic            uint32
+	HeaderSize       uint16
+	Version          uint16
+	TOCCompressed    uint64
+	TOCUncompressed  uint64
+	ChecksumAlgo     uint32
+	ChecksumAlgoName string // ChecksumAlgo为3时的算法名称，如 sha256
+}
+
+// File 归档中的一个文件或目录
+type File struct {
+	ID   string
+	Name string // 完整路径，如 hprt.pkg/PackageInfo
+	Type string // file、directory、symlink
+	data *tocData
+}
+
+// Reader 一个已校验过目录的xar归档
+type Reader struct {
+	Header Header
+	Files  []*File
+
+	r          io.ReaderAt
+	size       int64
+	heap       int64  // 堆的起始位置
+	tocRaw     []byte // 压缩的目录，签名和校验和针对它计算
+	toc        *tocXML
+	closer     io.Closer
+	checksumFn func() hash.Hash
+	hashID     crypto.Hash
+}
+
+// Open 打开并校验xar文件
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := NewReader(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.closer = f
+	return r, nil
+}
+
+// Close 关闭Open打开的文件
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// NewReader 解析文件头和目录，并核对目录的校验和
+func NewReader(ra io.ReaderAt, size int64) (*Reader, error) {
+	r := &Reader{r: ra, size: size}
+	if err := r.readHeader(); err != nil {
+		return nil, err
+	}
+	if err := r.readTOC(); err != nil {
+		return nil, err
+	}
+	if err := r.verifyTOCChecksum(); err != nil {
+		return nil, err
+	}
+
+	for i := range r.toc.TOC.Files {
+		if err := r.addFiles(&r.toc.TOC.Files[i], ""); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// readHeader 读取并检查文件头
+func (r *Reader) readHeader() error {
+	if r.size < headerSize {
+		return fmt.Errorf("文件只有%d字节，不是xar归档", r.size)
+	}
+	buf := make([]byte, headerSize)
+	if _, err := r.r.ReadAt(buf, 0); err != nil {
+		return fmt.Errorf("无法读取文件头: %v", err)
+	}
+
+	h := &r.Header
+	h.Magic = binary.BigEndian.Uint32(buf[0:4])
+	h.HeaderSize = binary.BigEndian.Uint16(buf[4:6])
+	h.Version = binary.BigEndian.Uint16(buf[6:8])
+	h.TOCCompressed = binary.BigEndian.Uint64(buf[8:16])
+	h.TOCUncompressed = binary.BigEndian.Uint64(buf[16:24])
+	h.ChecksumAlgo = binary.BigEndian.Uint32(buf[24:28])
+
+	switch {
+	case h.Magic != Magic:
+		return fmt.Errorf("文件头不是 xar! (0x%08x)", h.Magic)
+	case h.Version != 1:
+		return fmt.Errorf("不支持的xar版本 %d", h.Version)
+	case h.HeaderSize < headerSize:
+		return fmt.Errorf("文件头长度 %d 无效", h.HeaderSize)
+	case h.TOCCompressed == 0 || h.TOCCompressed > maxTOCSize || h.TOCUncompressed > maxTOCSize:
+		return fmt.Errorf("目录长度无效 (压缩 %d, 解压 %d)", h.TOCCompressed, h.TOCUncompressed)
+	case int64(h.HeaderSize)+int64(h.TOCCompressed) > r.size:
+		return fmt.Errorf("文件被截断: 目录需要 %d 字节，文件只有 %d 字节", int64(h.HeaderSize)+int64(h.TOCCompressed), r.size)
+	}
+
+	if h.ChecksumAlgo == checksumOther && h.HeaderSize > headerSize {
+		name := make([]byte, h.HeaderSize-headerSize)
+		if _, err := r.r.ReadAt(name, headerSize); err != nil {
+			return fmt.Errorf("无法读取校验算法名称: %v", err)
+		}
+		h.ChecksumAlgoName = strings.TrimRight(string(name), "\x00")
+	}
+
+	r.heap = int64(h.HeaderSize) + int64(h.TOCCompressed)
+	return nil
+}
+
+// readTOC 解压并解析XML目录
+func (r *Reader) readTOC() error {
+	r.tocRaw = make([]byte, r.Header.TOCCompressed)
+	if _, err := r.r.ReadAt(r.tocRaw, int64(r.Header.HeaderSize)); err != nil {
+		return fmt.Errorf("无法读取目录: %v", err)
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(r.tocRaw))
+	if err != nil {
+		return fmt.Errorf("目录不是zlib压缩数据: %v", err)
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(io.LimitReader(zr, maxTOCSize+1))
+	if err != nil {
+		return fmt.Errorf("无法解压目录: %v", err)
+	}
+	if uint64(len(data)) != r.Header.TOCUncompressed {
+		return fmt.Errorf("目录解压后长度 %d 与文件头中的 %d 不符", len(data), r.Header.TOCUncompressed)
+	}
+
+	r.toc = &tocXML{}
+	if err := xml.Unmarshal(data, r.toc); err != nil {
+		return fmt.Errorf("无法解析目录: %v", err)
+	}
+	return nil
+}
+
+// verifyTOCChecksum 堆中保存的校验和必须等于压缩目录的摘要
+func (r *Reader) verifyTOCChecksum() error {
+	algo := r.Header.ChecksumAlgo
+	if algo == checksumNone {
+		return nil
+	}
+
+	name := map[uint32]string{checksumSHA1: "sha1", checksumMD5: "md5"}[algo]
+	if algo == checksumOther {
+		name = r.Header.ChecksumAlgoName
+	}
+	newHash, id, err := hashByName(name)
+	if err != nil {
+		return err
+	}
+	r.checksumFn, r.hashID = newHash, id
+
+	c := r.toc.TOC.Checksum
+	if c == nil {
+		return fmt.Errorf("文件头声明了 %s 校验，但目录中没有校验和", name)
+	}
+	stored, err := r.readHeap(c.Offset, c.Size)
+	if err != nil {
+		return fmt.Errorf("无法读取目录校验和: %v", err)
+	}
+
+	h := newHash()
+	h.Write(r.tocRaw)
+	if !bytes.Equal(h.Sum(nil), stored) {
+		return fmt.Errorf("目录校验和不符，文件可能损坏或被修改")
+	}
+	return nil
+}
+
+// addFiles 展开嵌套的目录项，并检查数据范围
+func (r *Reader) addFiles(f *tocFile, parent string) error {
+	name := f.Name
+	if parent != "" {
+		name = parent + "/" + f.Name
+	}
+	if f.Data != nil && !r.inHeap(f.Data.Offset, f.Data.Length) {
+		return fmt.Errorf("文件 %s 的数据超出归档范围，文件可能被截断", name)
+	}
+	r.Files = append(r.Files, &File{ID: f.ID, Name: name, Type: f.Type, data: f.Data})
+
+	for i := range f.Files {
+		if err := r.addFiles(&f.Files[i], name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// File 按完整路径查找文件，不存在时返回nil
+func (r *Reader) File(name string) *File {
+	for _, f := range r.Files {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// ReadFile 读取文件内容，解压并核对解压前后的校验和
+func (r *Reader) ReadFile(f *File) ([]byte, error) {
+	if f.data == nil {
+		return nil, fmt.Errorf("%s 不是普通文件", f.Name)
+	}
+	d := f.data
+	if d.Size > maxFileSize {
+		return nil, fmt.Errorf("%s 过大 (%d字节)", f.Name, d.Size)
+	}
+
+	archived, err := r.readHeap(d.Offset, d.Length)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取 %s: %v", f.Name, err)
+	}
+	if err := checkSum(d.ArchivedChecksum, archived); err != nil {
+		return nil, fmt.Errorf("%s 压缩数据%v", f.Name, err)
+	}
+
+	var rd io.Reader = bytes.NewReader(archived)
+	switch d.Encoding.Style {
+	case "", "application/octet-stream":
+	case "application/x-gzip": // xar中的gzip实际是zlib格式
+		zr, err := zlib.NewReader(rd)
+		if err != nil {
+			return nil, fmt.Errorf("无法解压 %s: %v", f.Name, err)
+		}
+		defer zr.Close()
+		rd = zr
+	case "application/x-bzip2":
+		rd = bzip2.NewReader(rd)
+	default:
+		return nil, fmt.Errorf("%s 使用了不支持的编码 %s", f.Name, d.Encoding.Style)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(rd, maxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("无法解压 %s: %v", f.Name, err)
+	}
+	if int64(len(data)) != d.Size {
+		return nil, fmt.Errorf("%s 解压后长度 %d 与目录中的 %d 不符", f.Name, len(data), d.Size)
+	}
+	if err := checkSum(d.ExtractedChecksum, data); err != nil {
+		return nil, fmt.Errorf("%s %v", f.Name, err)
+	}
+	return data, nil
+}
+
+// readHeap 读取堆中的一段数据
+func (r *Reader) readHeap(offset, length int64) ([]byte, error) {
+	if length > maxFileSize || !r.inHeap(offset, length) {
+		return nil, errors.New("超出归档范围")
+	}
+	buf := make([]byte, length)
+	if _, err := r.r.ReadAt(buf, r.heap+offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// inHeap 判断堆中的一段数据是否在归档范围内。
+// 偏移和长度来自目录，可能接近int64上限，用减法比较以免相加溢出
+func (r *Reader) inHeap(offset, length int64) bool {
+	avail := r.size - r.heap
+	return offset >= 0 && length >= 0 && offset <= avail && length <= avail-offset
+}
+
+// checkSum 按目录中的算法核对数据，未声明校验和时跳过
+func checkSum(c tocSum, data []byte) error {
+	if c.Value == "" {
+		return nil
+	}
+	newHash, _, err := hashByName(c.Style)
+	if err != nil {
+		return err
+	}
+	h := newHash()
+	h.Write(data)
+	if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), strings.TrimSpace(c.Value)) {
+		return fmt.Errorf("校验和不符")
+	}
+	return nil
+}
+
+// hashByName 按xar中的算法名称返回摘要函数
+func hashByName(name string) (func() hash.Hash, crypto.Hash, error) {
+	switch strings.ToLower(name) {
+	case "sha1":
+		return sha1.New, crypto.SHA1, nil
+	case "md5":
+		return md5.New, crypto.MD5, nil
+	case "sha256":
+		return sha256.New, crypto.SHA256, nil
+	case "sha512":
+		return sha512.New, crypto.SHA512, nil
+	}
+	return nil, 0, fmt.Errorf("不支持的校验算法 %q", name)
+}
+
+// tocXML 目录的XML结构
+type tocXML struct {
+	XMLName xml.Name `xml:"xar"`
+	TOC     struct {
+		CreationTime string        `xml:"creation-time"`
+		Checksum     *tocChecksum  `xml:"checksum"`
+		Signature    *tocSignature `xml:"signature"`
+		Files        []tocFile     `xml:"file"`
+	} `xml:"toc"`
+}
+
+type tocChecksum struct {
+	Style  string `xml:"style,attr"`
+	Offset int64  `xml:"offset"`
+	Size   int64  `xml:"size"`
+}
+
+type tocSignature struct {
+	Style        string   `xml:"style,attr"`
+	Offset       int64    `xml:"offset"`
+	Size         int64    `xml:"size"`
+	Certificates []string `xml:"KeyInfo>X509Data>X509Certificate"`
+}
+
+type tocFile struct {
+	ID    string    `xml:"id,attr"`
+	Name  string    `xml:"name"`
+	Type  string    `xml:"type"`
+	Data  *tocData  `xml:"data"`
+	Files []tocFile `xml:"file"`
+}
+
+type tocData struct {
+	Offset   int64 `xml:"offset"`
+	Size     int64 `xml:"size"`   // 解压后长度
+	Length   int64 `xml:"length"` // 堆中的长度
+	Encoding struct {
+		Style string `xml:"style,attr"`
+	} `xml:"encoding"`
+	ArchivedChecksum  tocSum `xml:"archived-checksum"`
+	ExtractedChecksum tocSum `xml:"extracted-checksum"`
+}
+
+type tocSum struct {
+	Style string `xml:"style,attr"`
+	Value string `xml:",chardata"`
+}
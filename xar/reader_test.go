@@ -0,0 +1,310 @@
+package xar
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixtureFile 测试归档中的一个文件，name中的 / 表示放在一层目录下
+type fixtureFile struct {
+	name string
+	data string
+
+	// 不为0时替换目录中的偏移和长度，用来构造越界的归档
+	offset, length int64
+}
+
+// fixture 在内存中构造xar归档: sha1目录校验和放在堆的开头，其后是签名和文件数据
+type fixture struct {
+	files []fixtureFile
+	key   *rsa.PrivateKey
+	cert  *x509.Certificate
+}
+
+// build 生成归档，返回内容和目录校验和在文件中的位置
+func (f *fixture) build(t *testing.T) ([]byte, int) {
+	t.Helper()
+
+	heapPos := int64(sha1.Size)
+	sigXML := ""
+	if f.key != nil {
+		sigXML = fmt.Sprintf(`<signature style="RSA"><offset>%d</offset><size>%d</size>`+
+			`<KeyInfo><X509Data><X509Certificate>%s</X509Certificate></X509Data></KeyInfo></signature>`,
+			heapPos, f.key.Size(), base64.StdEncoding.EncodeToString(f.cert.Raw))
+		heapPos += int64(f.key.Size())
+	}
+
+	var data bytes.Buffer
+	byDir := map[string][]string{}
+	var dirs []string
+	for _, file := range f.files {
+		offset, length := heapPos+int64(data.Len()), int64(len(file.data))
+		if file.offset != 0 || file.length != 0 {
+			offset, length = file.offset, file.length
+		}
+		data.WriteString(file.data)
+		sum := sha1.Sum([]byte(file.data))
+		dir, base := "", file.name
+		if i := strings.Index(file.name, "/"); i >= 0 {
+			dir, base = file.name[:i], file.name[i+1:]
+		}
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], fmt.Sprintf(`<file><name>%s</name><type>file</type><data>`+
+			`<offset>%d</offset><size>%d</size><length>%d</length><encoding style="application/octet-stream"/>`+
+			`<extracted-checksum style="sha1">%s</extracted-checksum></data></file>`,
+			base, offset, len(file.data), length, hex.EncodeToString(sum[:])))
+	}
+	var filesXML strings.Builder
+	for _, dir := range dirs {
+		if dir == "" {
+			filesXML.WriteString(strings.Join(byDir[dir], ""))
+			continue
+		}
+		fmt.Fprintf(&filesXML, `<file><name>%s</name><type>directory</type>%s</file>`, dir, strings.Join(byDir[dir], ""))
+	}
+
+	toc := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?><xar><toc>`+
+		`<creation-time>2024-05-01T09:30:00</creation-time>`+
+		`<checksum style="sha1"><offset>0</offset><size>%d</size></checksum>%s%s</toc></xar>`,
+		sha1.Size, sigXML, filesXML.String())
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write([]byte(toc))
+	zw.Close()
+
+	digest := sha1.Sum(compressed.Bytes())
+	var heap bytes.Buffer
+	heap.Write(digest[:])
+	if f.key != nil {
+		sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA1, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		heap.Write(sig)
+	}
+	heap.Write(data.Bytes())
+
+	header := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(header[0:4], Magic)
+	binary.BigEndian.PutUint16(header[4:6], headerSize)
+	binary.BigEndian.PutUint16(header[6:8], 1)
+	binary.BigEndian.PutUint64(header[8:16], uint64(compressed.Len()))
+	binary.BigEndian.PutUint64(header[16:24], uint64(len(toc)))
+	binary.BigEndian.PutUint32(header[24:28], checksumSHA1)
+
+	out := append(header, compressed.Bytes()...)
+	return append(out, heap.Bytes()...), headerSize + compressed.Len()
+}
+
+// open 构造归档并解析
+func (f *fixture) open(t *testing.T) (*Reader, error) {
+	t.Helper()
+	data, _ := f.build(t)
+	return NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// newSigner 生成自签名证书，返回证书和只信任它的根证书池
+func newSigner(t *testing.T) (*rsa.PrivateKey, *x509.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Developer ID Installer: Test (ABCDE12345)"},
+		NotBefore:             time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return key, cert, roots
+}
+
+const distribution = `<?xml version="1.0" encoding="utf-8"?>
+<installer-gui-script minSpecVersion="2">
+  <choice id="default"><pkg-ref id="com.hprt.pkg.printerdriver"/></choice>
+  <pkg-ref id="com.hprt.pkg.printerdriver" version="1.2.3">#hprt.pkg</pkg-ref>
+</installer-gui-script>`
+
+const packageInfo = `<pkg-info identifier="com.hprt.pkg.printerdriver" version="1.2.3"/>`
+
+func TestNewReaderRejectsBrokenArchives(t *testing.T) {
+	valid := &fixture{files: []fixtureFile{{name: "Distribution", data: distribution}}}
+
+	tests := []struct {
+		name   string
+		mutate func(data []byte, checksumPos int) []byte
+		want   string
+	}{
+		{"文件头截断", func(data []byte, _ int) []byte { return data[:20] }, "不是xar归档"},
+		{"目录截断", func(data []byte, _ int) []byte { return data[:headerSize+4] }, "文件被截断"},
+		{"魔数错误", func(data []byte, _ int) []byte {
+			copy(data, "xar?")
+			return data
+		}, "文件头不是 xar!"},
+		{"目录校验和不符", func(data []byte, pos int) []byte {
+			data[pos] ^= 0xFF
+			return data
+		}, "目录校验和不符"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, pos := valid.build(t)
+			data = tt.mutate(data, pos)
+			_, err := NewReader(bytes.NewReader(data), int64(len(data)))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("错误 %v，期望包含 %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewReaderHeapBounds(t *testing.T) {
+	tests := []struct {
+		name           string
+		offset, length int64
+	}{
+		{"偏移越界", 1 << 20, 10},
+		{"长度越界", 0, 1 << 20},
+		{"负偏移", -1, 10},
+		{"相加溢出", math.MaxInt64 - 5, 10},
+		{"长度接近上限", 10, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fixture{files: []fixtureFile{{name: "Distribution", data: distribution, offset: tt.offset, length: tt.length}}}
+			_, err := f.open(t)
+			if err == nil || !strings.Contains(err.Error(), "超出归档范围") {
+				t.Errorf("错误 %v，期望数据超出归档范围", err)
+			}
+		})
+	}
+}
+
+func TestReadPackageInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      []fixtureFile
+		wantSource string
+		wantErr    string
+	}{
+		{"产品包", []fixtureFile{{name: "Distribution", data: distribution}, {name: "hprt.pkg/PackageInfo", data: packageInfo}}, "Distribution", ""},
+		{"组件包", []fixtureFile{{name: "PackageInfo", data: packageInfo}}, "PackageInfo", ""},
+		{"产品包中的组件", []fixtureFile{{name: "hprt.pkg/PackageInfo", data: packageInfo}}, "hprt.pkg/PackageInfo", ""},
+		{"不是安装包", []fixtureFile{{name: "readme.txt", data: "hello"}}, "", "不是macOS安装包"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := (&fixture{files: tt.files}).open(t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := r.ReadPackageInfo()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("错误 %v，期望包含 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Identifier != "com.hprt.pkg.printerdriver" || info.Version != "1.2.3" || info.Source != tt.wantSource {
+				t.Errorf("安装包信息 %+v，期望来源 %s", info, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	files := []fixtureFile{{name: "Distribution", data: distribution}}
+
+	t.Run("未签名", func(t *testing.T) {
+		r, err := (&fixture{files: files}).open(t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Signed() {
+			t.Error("未签名的归档被认为已签名")
+		}
+		sig, err := r.VerifySignature(x509.NewCertPool())
+		if sig != nil || err != nil {
+			t.Errorf("未签名时返回 %v, %v", sig, err)
+		}
+	})
+
+	key, cert, roots := newSigner(t)
+	signed := &fixture{files: files, key: key, cert: cert}
+
+	t.Run("已签名", func(t *testing.T) {
+		r, err := signed.open(t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !r.Signed() {
+			t.Fatal("已签名的归档被认为未签名")
+		}
+		sig, err := r.VerifySignature(roots)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig.Signer != cert.Subject.CommonName {
+			t.Errorf("签名者 %q", sig.Signer)
+		}
+		// 证书已过期，按目录中的创建时间验证
+		if want := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC); !sig.SigningTime.Equal(want) {
+			t.Errorf("签名时间 %v，期望 %v", sig.SigningTime, want)
+		}
+	})
+
+	t.Run("证书不受信任", func(t *testing.T) {
+		r, err := signed.open(t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.VerifySignature(x509.NewCertPool()); err == nil || !strings.Contains(err.Error(), "不受信任") {
+			t.Errorf("错误 %v，期望证书不受信任", err)
+		}
+	})
+
+	t.Run("签名被修改", func(t *testing.T) {
+		data, pos := signed.build(t)
+		data[pos+sha1.Size] ^= 0xFF
+		r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.VerifySignature(roots); err == nil || !strings.Contains(err.Error(), "签名与内容不符") {
+			t.Errorf("错误 %v，期望签名与内容不符", err)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package xar
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// oidDeveloperIDInstaller Apple在Developer ID Installer证书中标记为关键的扩展，
+// crypto/x509不认识它，会以 unhandled critical extension 拒绝整个证书
+var oidDeveloperIDInstaller = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 1, 14}
+
+// Signature 验证通过的签名
+type Signature struct {
+	Signer       string              // 签名证书的通用名称，如 Developer ID Installer: ...
+	Certificates []*x509.Certificate // 归档中附带的证书，第一张是签名证书
+	Chain        []*x509.Certificate // 验证得到的证书链，最后一张是根证书
+	SigningTime  time.Time           // 按此时间验证证书有效期
+}
+
+// Signed 归档是否带有签名
+func (r *Reader) Signed() bool {
+	return r.toc.TOC.Signature != nil
+}
+
+// VerifySignature 验证签名和证书链。未签名时返回nil, nil；roots为nil时使用系统根证书。
+//
+// xar的签名是对目录校验和做的RSA签名，因此先核对签名、再验证签名证书能否链到受信任的根证书。
+// 安装包证书过期后已发布的pkg仍然有效，证书有效期按目录中的创建时间判断
+func (r *Reader) VerifySignature(roots *x509.CertPool) (*Signature, error) {
+	s := r.toc.TOC.Signature
+	if s == nil {
+		return nil, nil
+	}
+	if !strings.EqualFold(s.Style, "RSA") {
+		return nil, fmt.Errorf("不支持的签名方式 %q", s.Style)
+	}
+	if r.checksumFn == nil || r.toc.TOC.Checksum == nil {
+		return nil, errors.New("签名的归档缺少目录校验和")
+	}
+	if len(s.Certificates) == 0 {
+		return nil, errors.New("签名中没有证书")
+	}
+
+	certs := make([]*x509.Certificate, 0, len(s.Certificates))
+	for i, text := range s.Certificates {
+		der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		if err != nil {
+			return nil, fmt.Errorf("第%d张证书无法解码: %v", i+1, err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("第%d张证书无法解析: %v", i+1, err)
+		}
+		cert.UnhandledCriticalExtensions = withoutOID(cert.UnhandledCriticalExtensions, oidDeveloperIDInstaller)
+		certs = append(certs, cert)
+	}
+	leaf := certs[0]
+
+	digest, err := r.readHeap(r.toc.TOC.Checksum.Offset, r.toc.TOC.Checksum.Size)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取目录校验和: %v", err)
+	}
+	sig, err := r.readHeap(s.Offset, s.Size)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取签名: %v", err)
+	}
+	pub, ok := leaf.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("签名证书不是RSA密钥")
+	}
+	if err := rsa.VerifyPKCS1v15(pub, r.hashID, digest, sig); err != nil {
+		return nil, fmt.Errorf("签名与内容不符，文件可能被修改: %v", err)
+	}
+
+	signingTime := r.creationTime()
+	if signingTime.IsZero() || signingTime.Before(leaf.NotBefore) || signingTime.After(leaf.NotAfter) {
+		signingTime = time.Now()
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   signingTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny}, // 安装包证书使用Apple自定义的用途
+	})
+	if err != nil {
+		return nil, fmt.Errorf("签名证书 %q 不受信任: %v", leaf.Subject.CommonName, err)
+	}
+
+	return &Signature{
+		Signer:       leaf.Subject.CommonName,
+		Certificates: certs,
+		Chain:        chains[0],
+		SigningTime:  signingTime,
+	}, nil
+}
+
+// creationTime 目录中的创建时间，无法解析时返回零值
+func (r *Reader) creationTime() time.Time {
+	text := strings.TrimSpace(r.toc.TOC.CreationTime)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// withoutOID 从列表中去掉指定的OID
+func withoutOID(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) []asn1.ObjectIdentifier {
+	var kept []asn1.ObjectIdentifier
+	for _, o := range oids {
+		if !o.Equal(oid) {
+			kept = append(kept, o)
+		}
+	}
+	return kept
+}